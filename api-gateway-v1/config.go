@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Environment variables read by the gateway
+var settings = config.Settings{
+	{Name: "LISTEN_ADDR", Default: ":8080", Validate: config.Addr},
+	{Name: "LOG_FORMAT", Default: "json", Validate: config.Enum(logging.Formats...)},
+	{Name: "LOG_LEVEL", Default: "info", Validate: config.Enum(logging.Levels...)},
+	{Name: "SHUTDOWN_TIMEOUT", Default: "15s", Validate: config.Duration},
+	{Name: "SHUTDOWN_DELAY", Default: "0s", Validate: config.DurationOrZero},
+	{Name: "WATCHDOG_THRESHOLD", Default: "10s", Validate: config.Duration},
+}
@@ -1,21 +1,25 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
 )
 
-type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	Description string  `json:"description"`
-}
+// Product is the catalog model shared by all services
+type Product = models.Product
 
 type ProductDetails struct {
 	Product         Product   `json:"product"`
@@ -32,8 +36,14 @@ var httpClient = &http.Client{
 	Timeout: 30 * time.Second, // Long timeout that will cause cascading failure
 }
 
-func getProductDetails(productID string) (*Product, error) {
-	resp, err := httpClient.Get(fmt.Sprintf("%s/product/%s", productServiceURL, productID))
+func getProductDetails(ctx context.Context, productID string) (*Product, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/product/%s", productServiceURL, productID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(logging.RequestIDHeader, logging.RequestIDFrom(ctx))
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -51,9 +61,16 @@ func getProductDetails(productID string) (*Product, error) {
 	return &product, nil
 }
 
-func getRecommendations(productID string) ([]Product, error) {
+func getRecommendations(ctx context.Context, productID string) ([]Product, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/recommendations/%s", recommendationsServiceURL, productID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(logging.RequestIDHeader, logging.RequestIDFrom(ctx))
 	// This call will hang for 30 seconds when the service is in failure mode
-	resp, err := httpClient.Get(fmt.Sprintf("%s/recommendations/%s", recommendationsServiceURL, productID))
+	// (unless the client gives up first, which cancels it)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +91,7 @@ func getRecommendations(productID string) ([]Product, error) {
 
 func productDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+	logger := logging.For(r.Context(), slog.Default())
 
 	// Extract ID from path
 	path := strings.TrimPrefix(r.URL.Path, "/product-details/")
@@ -85,17 +103,17 @@ func productDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get product details from product service
-	product, err := getProductDetails(id)
+	product, err := getProductDetails(r.Context(), id)
 	if err != nil {
-		log.Printf("Error getting product: %v", err)
+		logger.Error("Error getting product", "product_id", id, "error", err)
 		http.Error(w, "Failed to get product details", http.StatusInternalServerError)
 		return
 	}
 
 	// Get recommendations - THIS WILL HANG AND CAUSE CASCADING FAILURE
-	recommendations, err := getRecommendations(id)
+	recommendations, err := getRecommendations(r.Context(), id)
 	if err != nil {
-		log.Printf("Error getting recommendations: %v", err)
+		logger.Error("Error getting recommendations", "product_id", id, "error", err)
 		// Without circuit breaker, we fail the entire request
 		http.Error(w, "Failed to get recommendations", http.StatusInternalServerError)
 		return
@@ -109,24 +127,26 @@ func productDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	duration := time.Since(startTime)
-	log.Printf("Request completed in %v", duration)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+	logger.Info("Request completed", "product_id", id, "duration_ms", duration.Milliseconds())
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	jsonutil.Write(w, http.StatusOK, response)
 }
 
 func main() {
+	flag.Parse()
+	logging.Setup("api-gateway-v1")
+	config.RunSelfCheck(settings, map[string]string{
+		"product-service":         productServiceURL,
+		"recommendations-service": recommendationsServiceURL,
+	})
+	settings.MustValidate()
+
 	http.HandleFunc("/product-details/", productDetailsHandler)
-	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/health", httpserver.HealthHandler)
+	http.HandleFunc("/debug/runtime", httpserver.RuntimeHandler)
 
-	log.Println("API Gateway (NO CIRCUIT BREAKER) starting on :8080")
-	log.Println("⚠️  This version will crash when recommendations service fails!")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
-	}
+	addr := settings.Value("LISTEN_ADDR")
+	slog.Info("API Gateway (NO CIRCUIT BREAKER) starting", "addr", addr)
+	slog.Warn("This version will crash when recommendations service fails!")
+	httpserver.Run(addr, logging.RequestID(httpserver.Watchdog(http.DefaultServeMux)))
 }
\ No newline at end of file
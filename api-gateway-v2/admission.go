@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// Admission control. Every upstream gets a health score in [0, 1] built
+// from its recent error rate, latency against a target and breaker state.
+// With ADMISSION_CONTROL=true the gateway admits calls to a dependency with
+// probability equal to its score: product requests are rejected (503) and
+// recommendations are skipped (degraded) in proportion to how unhealthy
+// they are, so load ramps back gradually instead of flipping with the
+// breaker.
+//
+//	ADMISSION_CONTROL            true|false (default false)
+//	ADMISSION_LATENCY_TARGET_MS  latency at which the score starts dropping (default 500)
+//
+// Scores are always tracked and served on /debug/health-scores.
+var admission = struct {
+	enabled       bool
+	latencyTarget time.Duration
+}{latencyTarget: 500 * time.Millisecond}
+
+const (
+	healthAlpha = 0.2              // EWMA weight of each new observation
+	healthDecay = 10 * time.Second // Error rate halves every healthDecay without calls
+	minScore    = 0.05             // Always admit some calls so recovery is observed
+)
+
+var errAdmissionShed = errors.New("shed by admission control")
+
+func loadAdmissionControlFromEnv() {
+	admission.enabled = settings.Value("ADMISSION_CONTROL") == "true"
+	if v, err := strconv.Atoi(settings.Value("ADMISSION_LATENCY_TARGET_MS")); err == nil && v > 0 {
+		admission.latencyTarget = time.Duration(v) * time.Millisecond
+	}
+	if admission.enabled {
+		slog.Info("Admission control enabled", "latency_target", admission.latencyTarget.String())
+	}
+}
+
+// upstreamHealth tracks one dependency's recent behaviour
+type upstreamHealth struct {
+	mu      sync.Mutex
+	errRate float64 // EWMA of failures (0-1)
+	latency float64 // EWMA of call latency, seconds
+	updated time.Time
+}
+
+// decayed returns the error rate faded by the time since the last call, so
+// a dependency that is no longer called drifts back toward healthy
+func (h *upstreamHealth) decayed(now time.Time) float64 {
+	if h.updated.IsZero() {
+		return 0
+	}
+	return h.errRate * math.Pow(0.5, now.Sub(h.updated).Seconds()/healthDecay.Seconds())
+}
+
+func (h *upstreamHealth) observe(d time.Duration, failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	outcome := 0.0
+	if failed {
+		outcome = 1
+	}
+	h.errRate = h.decayed(now)*(1-healthAlpha) + outcome*healthAlpha
+	if h.latency == 0 {
+		h.latency = d.Seconds()
+	} else {
+		h.latency = h.latency*(1-healthAlpha) + d.Seconds()*healthAlpha
+	}
+	h.updated = now
+}
+
+// score combines error rate, latency and breaker state. An OPEN breaker
+// already fails fast and must keep seeing calls to schedule its half-open
+// trial, so only HALF-OPEN lowers the score.
+func (h *upstreamHealth) score(state circuitbreaker.State) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	score := 1 - h.decayed(time.Now())
+	if target := admission.latencyTarget.Seconds(); h.latency > target {
+		score *= target / h.latency
+	}
+	if state == circuitbreaker.StateHalfOpen {
+		score *= 0.5
+	}
+	return max(score, minScore)
+}
+
+// healthRegistry holds one tracker per dependency, keyed like the breakers
+type healthRegistry struct {
+	mu       sync.Mutex
+	trackers map[string]*upstreamHealth
+}
+
+func newHealthRegistry() *healthRegistry {
+	return &healthRegistry{trackers: map[string]*upstreamHealth{}}
+}
+
+func (r *healthRegistry) get(name string) *upstreamHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.trackers[name]
+	if !ok {
+		h = &upstreamHealth{}
+		r.trackers[name] = h
+	}
+	return h
+}
+
+// observe records a call to dependency name that started at start. Calls
+// the caller abandoned say nothing about the dependency and are skipped.
+func (s *Server) observe(name string, start time.Time, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, circuitbreaker.ErrCallerAbandoned) {
+		return
+	}
+	d := time.Since(start)
+	s.health.get(name).observe(d, err != nil)
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	if errors.Is(err, errPinMismatch) {
+		s.metrics.pinFailures.inc("upstream", name)
+	}
+	s.metrics.upstreamDuration.observe(d.Seconds(), "upstream", name, "outcome", outcome)
+}
+
+// admit decides whether a call to dependency name may proceed
+func (s *Server) admit(name string) bool {
+	if !admission.enabled {
+		return true
+	}
+	score := s.health.get(name).score(s.Breakers.Get(name).State())
+	return rand.Float64() < score
+}
+
+func (s *Server) healthScoresHandler(w http.ResponseWriter, r *http.Request) {
+	type dependencyHealth struct {
+		Score        float64 `json:"score"`
+		ErrorRate    float64 `json:"error_rate"`
+		LatencyMs    float64 `json:"latency_ms"`
+		CircuitState string  `json:"circuit_state"`
+	}
+
+	s.health.mu.Lock()
+	names := make([]string, 0, len(s.health.trackers))
+	for name := range s.health.trackers {
+		names = append(names, name)
+	}
+	s.health.mu.Unlock()
+
+	scores := map[string]dependencyHealth{}
+	for _, name := range names {
+		h := s.health.get(name)
+		state := s.Breakers.Get(name).State()
+		score := h.score(state)
+		h.mu.Lock()
+		scores[name] = dependencyHealth{
+			Score:        math.Round(score*1000) / 1000,
+			ErrorRate:    math.Round(h.decayed(time.Now())*1000) / 1000,
+			LatencyMs:    math.Round(h.latency * 1000),
+			CircuitState: state.String(),
+		}
+		h.mu.Unlock()
+	}
+	jsonutil.Write(w, http.StatusOK, map[string]interface{}{
+		"admission_control": admission.enabled,
+		"dependencies":      scores,
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+)
+
+// Batch envelope for GET /product-details/batch?ids=1,2,3
+//
+// One failed item doesn't fail the batch. Each item carries its own HTTP
+// status; items are returned in request order:
+//
+//	{
+//	  "items": [
+//	    {"id": "1", "status": 200, "data": {...ProductDetails...}},
+//	    {"id": "9", "status": 404, "error": {"type": "/problems/product-not-found", "title": "Product not found", "status": 404}}
+//	  ],
+//	  "summary": {"total": 2, "succeeded": 1, "failed": 1}
+//	}
+//
+// The response status is 200 when every item succeeded and 207 (Multi-Status)
+// otherwise, including when every item failed.
+type BatchResponse struct {
+	Items   []BatchItem  `json:"items"`
+	Summary BatchSummary `json:"summary"`
+}
+
+type BatchItem struct {
+	ID     string             `json:"id"`
+	Status int                `json:"status"`
+	Data   *ProductDetails    `json:"data,omitempty"`
+	Error  *apperrors.Problem `json:"error,omitempty"`
+}
+
+type BatchSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+func (s *Server) productDetailsBatchHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	ids := parseBulkIDs(r)
+	if len(ids) == 0 {
+		http.Error(w, "ids query parameter required", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxBulkIDs {
+		http.Error(w, "Too many ids (max 100)", http.StatusBadRequest)
+		return
+	}
+
+	runRequestHooks("/product-details/batch", r)
+
+	items := make([]BatchItem, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			details, err := s.composeProductDetails(r, id)
+			if err != nil {
+				s.log(r.Context()).Error("Error getting product", "product_id", id, "error", err)
+				problem := lookupErrorMapping(err).problem()
+				items[i] = BatchItem{ID: id, Status: problem.Status, Error: &problem}
+				return
+			}
+			runResponseHooks("/product-details/batch", r, http.Header{}, details)
+			items[i] = BatchItem{ID: id, Status: http.StatusOK, Data: details}
+		}(i, id)
+	}
+	wg.Wait()
+
+	resp := BatchResponse{Items: items, Summary: BatchSummary{Total: len(items)}}
+	for _, item := range items {
+		if item.Status == http.StatusOK {
+			resp.Summary.Succeeded++
+		} else {
+			resp.Summary.Failed++
+		}
+	}
+
+	status := http.StatusOK
+	if resp.Summary.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	s.log(r.Context()).Info("Batch completed", "items", len(ids),
+		"duration_ms", time.Since(startTime).Milliseconds(), "failed", resp.Summary.Failed)
+
+	runResponseHooks("/product-details/batch", r, w.Header(), nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	jsonEncoder{}.Encode(w, resp)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// batchProducts answers "missing" with a 404, "broken" with a 500 and
+// anything else with a product
+var batchProducts = ProductClientFunc(func(ctx context.Context, id string) (*Product, error) {
+	switch id {
+	case "missing":
+		return nil, &UpstreamError{Upstream: productUpstream, StatusCode: http.StatusNotFound}
+	case "broken":
+		return nil, &UpstreamError{Upstream: productUpstream, StatusCode: http.StatusInternalServerError}
+	}
+	return &Product{ID: id, Name: "Product " + id, Price: 10}, nil
+})
+
+func getBatch(t *testing.T, ids string) (int, BatchResponse) {
+	t.Helper()
+	s := newTestServer(batchProducts, stubRecommendations)
+	rec := httptest.NewRecorder()
+	s.productDetailsBatchHandler(rec, httptest.NewRequest(http.MethodGet, "/product-details/batch?ids="+ids, nil))
+	var resp BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d, body %q: %v", rec.Code, rec.Body, err)
+	}
+	return rec.Code, resp
+}
+
+func TestBatchMixedOutcomes(t *testing.T) {
+	status, resp := getBatch(t, "1,missing,broken,2")
+	if status != http.StatusMultiStatus {
+		t.Errorf("status = %d, want 207", status)
+	}
+	want := []struct {
+		id      string
+		status  int
+		problem string
+	}{
+		{"1", http.StatusOK, ""},
+		{"missing", http.StatusNotFound, "/problems/product-not-found"},
+		{"broken", http.StatusBadGateway, "/problems/upstream-error"},
+		{"2", http.StatusOK, ""},
+	}
+	if len(resp.Items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(resp.Items), len(want))
+	}
+	for i, w := range want {
+		item := resp.Items[i]
+		if item.ID != w.id || item.Status != w.status {
+			t.Errorf("item %d = %s %d, want %s %d (request order)", i, item.ID, item.Status, w.id, w.status)
+			continue
+		}
+		switch {
+		case w.problem == "" && (item.Data == nil || item.Data.Product.ID != w.id || item.Error != nil):
+			t.Errorf("item %s: want data for the product and no error, got %+v", w.id, item)
+		case w.problem != "" && (item.Error == nil || item.Error.Type != w.problem || item.Data != nil):
+			t.Errorf("item %s: want problem %s and no data, got %+v", w.id, w.problem, item)
+		}
+	}
+	if resp.Summary != (BatchSummary{Total: 4, Succeeded: 2, Failed: 2}) {
+		t.Errorf("summary = %+v, want 4 total, 2 succeeded, 2 failed", resp.Summary)
+	}
+}
+
+func TestBatchStatus(t *testing.T) {
+	tests := []struct {
+		ids  string
+		want int
+	}{
+		{"1,2", http.StatusOK},
+		{"missing,broken", http.StatusMultiStatus}, // Even when every item failed
+	}
+	for _, tt := range tests {
+		if status, _ := getBatch(t, tt.ids); status != tt.want {
+			t.Errorf("ids %s: status = %d, want %d", tt.ids, status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// Manual breaker control for incident response and testing (admin token
+// required):
+//
+//	POST /admin/circuit/{name}/open   hold the breaker OPEN: calls fail fast, no half-open trials
+//	POST /admin/circuit/{name}/close  hold it CLOSED: failures never trip it
+//	POST /admin/circuit/{name}/reset  release it, CLOSED with clean counters
+//
+// Names are the ones /circuit-status lists, e.g. product-service or
+// recommendations-service/primary (the slash may be sent as is or as %2F).
+// Forced breakers are listed under "forced" in /circuit-status until reset.
+func (s *Server) circuitAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Breaker names can contain slashes; the action is the last segment
+	rest := strings.TrimPrefix(r.URL.Path, "/admin/circuit/")
+	i := strings.LastIndex(rest, "/")
+	if i < 0 {
+		apperrors.Write(w, fmt.Errorf("expected /admin/circuit/{name}/{action}: %w", apperrors.ErrValidation))
+		return
+	}
+	name, action := rest[:i], rest[i+1:]
+	cb, known := s.Breakers.Lookup(name)
+	if !known && name == productUpstream {
+		// Created on first use; it may not have seen traffic yet
+		cb, known = s.Breakers.Get(name), true
+	}
+	if !known {
+		apperrors.Write(w, fmt.Errorf("circuit breaker %q: %w", name, apperrors.ErrNotFound))
+		return
+	}
+
+	switch action {
+	case "open":
+		cb.Force(circuitbreaker.StateOpen)
+	case "close":
+		cb.Force(circuitbreaker.StateClosed)
+	case "reset":
+		cb.Reset()
+	default:
+		apperrors.Write(w, fmt.Errorf("action must be open, close or reset: %w", apperrors.ErrValidation))
+		return
+	}
+
+	s.log(r.Context()).Warn("Circuit breaker changed by operator", "audit", true, "remote_addr", r.RemoteAddr,
+		"breaker", name, "action", action, "state", cb.GetState())
+	jsonutil.Write(w, http.StatusOK, map[string]interface{}{
+		"breaker": name,
+		"state":   cb.GetState(),
+		"forced":  cb.Forced(),
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+)
+
+// Live breaker state. GET /circuit-status/stream is a Server-Sent Events
+// stream of breaker transitions, so a dashboard can show breakers opening
+// and closing as it happens instead of polling /circuit-status:
+//
+//	event: snapshot
+//	data: {"dependencies": {"product-service": "CLOSED", ...}, "forced": {...}}
+//
+//	id: 7
+//	event: transition
+//	data: {"breaker": "recommendations-service/primary", "from": "CLOSED", "to": "OPEN", "time": "...", "failures_total": 12, "max_failures": 3}
+//
+// The snapshot comes first on every connection. failures_total counts every
+// failure the breaker has recorded since the gateway started. A client that
+// reconnects with Last-Event-ID gets the transitions it missed, as long as
+// they are among the last breakerStreamBacklog. Idle streams get a comment
+// line every breakerStreamHeartbeat to keep proxies from closing them.
+// Subscribers that fall behind lose events rather than slowing breakers.
+
+const (
+	breakerStreamBacklog   = 64
+	breakerStreamBuffer    = 16
+	breakerStreamHeartbeat = 15 * time.Second
+)
+
+// BreakerTransition is one transition event on the stream
+type BreakerTransition struct {
+	ID            int64     `json:"-"`
+	Breaker       string    `json:"breaker"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	Time          time.Time `json:"time"`
+	FailuresTotal int64     `json:"failures_total"`
+	MaxFailures   int       `json:"max_failures"`
+}
+
+// breakerStream fans transitions out to the connected streams
+type breakerStream struct {
+	mu      sync.Mutex
+	lastID  int64
+	backlog []BreakerTransition
+	subs    map[chan BreakerTransition]struct{}
+}
+
+func newBreakerStream() *breakerStream {
+	return &breakerStream{subs: map[chan BreakerTransition]struct{}{}}
+}
+
+// publish is called from OnStateChange with the breaker's lock held, so it
+// never blocks
+func (b *breakerStream) publish(name string, from, to circuitbreaker.State, cb *circuitbreaker.CircuitBreaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	ev := BreakerTransition{
+		ID:            b.lastID,
+		Breaker:       name,
+		From:          from.String(),
+		To:            to.String(),
+		Time:          time.Now().UTC(),
+		FailuresTotal: cb.Failures(),
+		MaxFailures:   cb.Config().MaxFailures,
+	}
+	b.backlog = append(b.backlog, ev)
+	if len(b.backlog) > breakerStreamBacklog {
+		b.backlog = b.backlog[1:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// subscribe returns the backlog after lastSeen and a channel for what
+// follows; cancel unsubscribes
+func (b *breakerStream) subscribe(lastSeen int64) (missed []BreakerTransition, events <-chan BreakerTransition, cancel func()) {
+	ch := make(chan BreakerTransition, breakerStreamBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ev := range b.backlog {
+		if ev.ID > lastSeen {
+			missed = append(missed, ev)
+		}
+	}
+	b.subs[ch] = struct{}{}
+	return missed, ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (s *Server) circuitStatusStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	httpserver.LongLived(r.Context())
+	lastSeen, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	missed, events, cancel := s.breakerEvents.subscribe(lastSeen)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(write func(io.Writer) error) bool {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		err := write(w)
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			s.log(r.Context()).Info("Circuit status stream closed", "error", err)
+			return false
+		}
+		return true
+	}
+
+	snapshot := map[string]interface{}{"dependencies": s.Breakers.States(), "forced": s.Breakers.Forced()}
+	if !send(func(w io.Writer) error { return writeSSE(w, 0, "snapshot", snapshot) }) {
+		return
+	}
+	for _, ev := range missed {
+		if !send(func(w io.Writer) error { return writeSSE(w, ev.ID, "transition", ev) }) {
+			return
+		}
+	}
+
+	// Ticks once a second so the stream ends promptly when the gateway
+	// starts draining, instead of holding up shutdown
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			if !send(func(w io.Writer) error { return writeSSE(w, ev.ID, "transition", ev) }) {
+				return
+			}
+			lastWrite = time.Now()
+		case <-ticker.C:
+			if httpserver.Draining() {
+				return
+			}
+			if time.Since(lastWrite) >= breakerStreamHeartbeat {
+				if !send(func(w io.Writer) error { _, err := io.WriteString(w, ": heartbeat\n\n"); return err }) {
+					return
+				}
+				lastWrite = time.Now()
+			}
+		}
+	}
+}
+
+// writeSSE writes one event; id 0 means none
+func writeSSE(w io.Writer, id int64, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
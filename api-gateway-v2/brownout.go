@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Brownout. Under load the gateway drops the optional, expensive parts of
+// composed responses before it has to drop requests, and restores them as
+// load falls:
+//
+//	level 0  full responses
+//	level 1  bundle components aren't expanded (?expand=bundle is ignored)
+//	level 2  recommendations aren't fetched either; they are served empty
+//
+// Load is requests in flight over BROWNOUT_CAPACITY, smoothed over a few
+// seconds. A level is entered when load reaches its threshold and left only
+// once load is brownoutHysteresis below it, so the level doesn't flap.
+//
+//	BROWNOUT             true|false (default false)
+//	BROWNOUT_CAPACITY    requests in flight that count as full load (default 100)
+//	BROWNOUT_THRESHOLDS  load at which levels 1 and 2 start (default "0.6,0.8")
+//
+// The level is on /metrics (gateway_brownout_level) and, while enabled, in
+// the meta block as brownout_level. Responses it trimmed are partial, with
+// fallback_tier "brownout". The gateway serves no reviews or images, so
+// there is nothing further to drop.
+var brownout = struct {
+	enabled    bool
+	capacity   float64
+	thresholds []float64 // Load at which level i+1 starts
+}{capacity: 100, thresholds: []float64{0.6, 0.8}}
+
+const (
+	brownoutSmoothing  = 3 * time.Second // Time constant of the load average
+	brownoutHysteresis = 0.1
+)
+
+func loadBrownoutFromEnv() {
+	brownout.enabled = settings.Value("BROWNOUT") == "true"
+	if v, err := strconv.Atoi(settings.Value("BROWNOUT_CAPACITY")); err == nil && v > 0 {
+		brownout.capacity = float64(v)
+	}
+	if t, err := parseBrownoutThresholds(settings.Value("BROWNOUT_THRESHOLDS")); err == nil && t != nil {
+		brownout.thresholds = t
+	}
+	if brownout.enabled {
+		slog.Info("Brownout enabled", "capacity", brownout.capacity, "thresholds", brownout.thresholds)
+	}
+}
+
+// parseBrownoutThresholds reads "t1,t2"; empty means the default
+func parseBrownoutThresholds(v string) ([]float64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("want two thresholds, for levels 1 and 2")
+	}
+	t := make([]float64, len(parts))
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("threshold %q is not a positive number", p)
+		}
+		if i > 0 && f <= t[i-1] {
+			return nil, fmt.Errorf("thresholds must increase")
+		}
+		t[i] = f
+	}
+	return t, nil
+}
+
+// validBrownoutThresholds is the BROWNOUT_THRESHOLDS setting validator
+func validBrownoutThresholds(v string) error {
+	_, err := parseBrownoutThresholds(v)
+	return err
+}
+
+// brownoutController tracks load and the brownout level. The load average
+// is updated lazily when the level is read, so an idle gateway runs no
+// timer.
+type brownoutController struct {
+	inFlight atomic.Int64
+
+	mu      sync.Mutex
+	load    float64
+	level   int
+	sampled time.Time
+}
+
+func newBrownoutController() *brownoutController {
+	return &brownoutController{}
+}
+
+// track counts requests in flight. Upgrades (/ws) aren't counted: a
+// socket held open for hours is not load.
+func (b *brownoutController) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		b.inFlight.Add(1)
+		defer b.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// current returns the brownout level, 0 when disabled
+func (b *brownoutController) current() int {
+	if !brownout.enabled {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	instant := float64(b.inFlight.Load()) / brownout.capacity
+	if b.sampled.IsZero() {
+		b.load = instant
+	} else {
+		alpha := 1 - math.Exp(-now.Sub(b.sampled).Seconds()/brownoutSmoothing.Seconds())
+		b.load += alpha * (instant - b.load)
+	}
+	b.sampled = now
+
+	level := b.level
+	for level < len(brownout.thresholds) && b.load >= brownout.thresholds[level] {
+		level++
+	}
+	for level > 0 && b.load < brownout.thresholds[level-1]-brownoutHysteresis {
+		level--
+	}
+	if level != b.level {
+		log := slog.Info
+		if level > b.level {
+			log = slog.Warn
+		}
+		log("Brownout level changed", "from", b.level, "to", level, "load", math.Round(b.load*100)/100)
+		b.level = level
+	}
+	return level
+}
+
+func (b *brownoutController) write(w io.Writer) {
+	level := b.current()
+	b.mu.Lock()
+	load := b.load
+	b.mu.Unlock()
+	fmt.Fprint(w, "# HELP gateway_brownout_level Brownout level: 0 full responses, 1 no bundle expansion, 2 no recommendations.\n# TYPE gateway_brownout_level gauge\n")
+	fmt.Fprintf(w, "gateway_brownout_level %d\n", level)
+	fmt.Fprint(w, "# HELP gateway_brownout_load Smoothed requests in flight over BROWNOUT_CAPACITY.\n# TYPE gateway_brownout_load gauge\n")
+	fmt.Fprintf(w, "gateway_brownout_load %s\n", strconv.FormatFloat(load, 'f', 3, 64))
+}
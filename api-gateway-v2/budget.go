@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Per-branch latency budgets within one composition, so a slow branch
+// can't consume the whole request deadline. Each branch's context expires
+// after its budget or with the overall deadline (X-Timeout-Ms), whichever
+// comes first. A budget of 0 disables it; both are off unless set.
+//
+//	PRODUCT_BUDGET_MS          default 0 (off)
+//	RECOMMENDATIONS_BUDGET_MS  default 0 (off)
+var (
+	productBudget         time.Duration
+	recommendationsBudget time.Duration
+)
+
+// errBranchBudget is the context cause when a branch overruns its budget
+var errBranchBudget = errors.New("branch latency budget exceeded")
+
+func loadBranchBudgetsFromEnv() {
+	if v, err := strconv.Atoi(settings.Value("PRODUCT_BUDGET_MS")); err == nil && v >= 0 {
+		productBudget = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.Atoi(settings.Value("RECOMMENDATIONS_BUDGET_MS")); err == nil && v >= 0 {
+		recommendationsBudget = time.Duration(v) * time.Millisecond
+	}
+	slog.Info("Branch budgets", "product", productBudget.String(), "recommendations", recommendationsBudget.String())
+}
+
+// withBranchBudget derives the context for one branch of a composition
+func withBranchBudget(ctx context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, budget, errBranchBudget)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Bulkheads. Each upstream gets a semaphore capping the calls the gateway
+// has in flight to it, so a slow dependency ties up a bounded number of
+// goroutines and connections instead of all of them. A call that finds the
+// bulkhead full waits up to BULKHEAD_QUEUE_TIMEOUT_MS for a slot (0 fails
+// fast) and is then rejected: product requests answer 503, recommendations
+// degrade. Each recommendations set has its own bulkhead. Both are off
+// unless set.
+//
+//	MAX_CONCURRENT_PRODUCTS    in-flight product-service calls (default 0 = unlimited)
+//	MAX_CONCURRENT_RECS        in-flight calls per recommendations set (default 0 = unlimited)
+//	BULKHEAD_QUEUE_TIMEOUT_MS  how long a call waits for a slot (default 0)
+//
+// A slot is held for the whole call including retries.
+var bulkheads struct {
+	maxProducts  int
+	maxRecs      int
+	queueTimeout time.Duration
+}
+
+var errBulkheadFull = errors.New("too many concurrent calls")
+
+func loadBulkheadsFromEnv() {
+	if v, err := strconv.Atoi(settings.Value("MAX_CONCURRENT_PRODUCTS")); err == nil && v >= 0 {
+		bulkheads.maxProducts = v
+	}
+	if v, err := strconv.Atoi(settings.Value("MAX_CONCURRENT_RECS")); err == nil && v >= 0 {
+		bulkheads.maxRecs = v
+	}
+	if v, err := strconv.Atoi(settings.Value("BULKHEAD_QUEUE_TIMEOUT_MS")); err == nil && v >= 0 {
+		bulkheads.queueTimeout = time.Duration(v) * time.Millisecond
+	}
+	slog.Info("Upstream bulkheads", "max_products", bulkheads.maxProducts, "max_recs", bulkheads.maxRecs,
+		"queue_timeout", bulkheads.queueTimeout.String())
+}
+
+// bulkheadLimit is the concurrency cap for dependency name
+func bulkheadLimit(name string) int {
+	if name == productUpstream {
+		return bulkheads.maxProducts
+	}
+	return bulkheads.maxRecs
+}
+
+// bulkheadRegistry holds one semaphore per dependency, keyed like the
+// breakers
+type bulkheadRegistry struct {
+	mu       sync.Mutex
+	slots    map[string]chan struct{}
+	rejected *counterVec
+}
+
+func newBulkheadRegistry() *bulkheadRegistry {
+	return &bulkheadRegistry{slots: map[string]chan struct{}{}, rejected: newCounterVec()}
+}
+
+func (b *bulkheadRegistry) get(name string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slots, ok := b.slots[name]
+	if !ok {
+		slots = make(chan struct{}, bulkheadLimit(name))
+		b.slots[name] = slots
+	}
+	return slots
+}
+
+// acquire takes a slot for a call to dependency name. The returned release
+// must be called when the call is done. It fails with errBulkheadFull when
+// no slot frees up within the queue timeout, or with ctx's error.
+func (b *bulkheadRegistry) acquire(ctx context.Context, name string) (release func(), err error) {
+	if bulkheadLimit(name) == 0 {
+		return func() {}, nil
+	}
+	slots := b.get(name)
+	release = func() { <-slots }
+
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if bulkheads.queueTimeout > 0 {
+		timer := time.NewTimer(bulkheads.queueTimeout)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+			return release, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	b.rejected.inc("upstream", name)
+	return nil, fmt.Errorf("%w (limit %d)", errBulkheadFull, cap(slots))
+}
+
+func (b *bulkheadRegistry) write(w io.Writer) {
+	b.mu.Lock()
+	fmt.Fprint(w, "# HELP gateway_bulkhead_in_flight Upstream calls in flight, by dependency.\n# TYPE gateway_bulkhead_in_flight gauge\n")
+	for _, name := range sortedKeys(b.slots) {
+		fmt.Fprintf(w, "gateway_bulkhead_in_flight{%s} %d\n", labels("upstream", name), len(b.slots[name]))
+	}
+	b.mu.Unlock()
+	b.rejected.write(w, "gateway_bulkhead_rejected_total", "Upstream calls rejected by a full bulkhead.")
+}
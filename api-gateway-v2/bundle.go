@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+)
+
+// Bundle expansion. product-service returns a bundle with its component
+// IDs only (product.components); ?expand=bundle adds the full component
+// products to the response, fetched concurrently through the same breaker,
+// budget and memo as the product itself. Nested bundles are expanded one
+// level: their own components stay as IDs.
+
+// BundleItem is one expanded bundle component
+type BundleItem struct {
+	Quantity int     `json:"quantity" xml:"quantity"`
+	Product  Product `json:"product" xml:"product"`
+}
+
+// expandRequested reports whether the comma-separated ?expand= list names
+// what
+func expandRequested(r *http.Request, what string) bool {
+	for _, v := range r.URL.Query()["expand"] {
+		for _, item := range strings.Split(v, ",") {
+			if strings.TrimSpace(item) == what {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandBundle fetches every component of bundle. Any failure fails the
+// expansion: a bundle shown with parts missing would misstate what it
+// contains.
+func (s *Server) expandBundle(ctx context.Context, bundle *Product) ([]BundleItem, error) {
+	items := make([]BundleItem, len(bundle.Components))
+	errs := make([]error, len(bundle.Components))
+	var wg sync.WaitGroup
+	for i, c := range bundle.Components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := s.fetchProduct(ctx, c.ProductID)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			items[i] = BundleItem{Quantity: c.Quantity, Product: *p}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		// A dangling component is the catalog's inconsistency, not a
+		// missing product from the client's point of view
+		if errors.Is(err, apperrors.ErrNotFound) {
+			err = &UpstreamError{Upstream: productUpstream,
+				Err: fmt.Errorf("bundle %s: component %s not found", bundle.ID, bundle.Components[i].ProductID)}
+		}
+		return nil, err
+	}
+	return items, nil
+}
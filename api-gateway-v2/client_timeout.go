@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+)
+
+// Upper bound for X-Timeout-Ms (MAX_CLIENT_TIMEOUT_MS). Clients can ask for
+// a faster deadline, never a longer one.
+var maxClientTimeout = 5 * time.Second
+
+// errClientTimeout is the context cause when a client-supplied deadline
+// expires. Upstream calls cut short by it reflect the client's latency
+// budget, not dependency health.
+var errClientTimeout = errors.New("client timeout hint (X-Timeout-Ms) exceeded")
+
+func loadClientTimeoutFromEnv() {
+	if v, err := strconv.Atoi(settings.Value("MAX_CLIENT_TIMEOUT_MS")); err == nil && v > 0 {
+		maxClientTimeout = time.Duration(v) * time.Millisecond
+	}
+	slog.Info("Client timeout hints capped", "max", maxClientTimeout.String())
+}
+
+// withClientTimeout applies the X-Timeout-Ms request header as the overall
+// deadline for the request's composition, capped by maxClientTimeout
+func withClientTimeout(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hint := r.Header.Get("X-Timeout-Ms")
+		if hint == "" {
+			next(w, r)
+			return
+		}
+
+		ms, err := strconv.Atoi(hint)
+		if err != nil || ms <= 0 {
+			apperrors.Write(w, fmt.Errorf("X-Timeout-Ms must be a positive integer: %w", apperrors.ErrValidation))
+			return
+		}
+		timeout := min(time.Duration(ms)*time.Millisecond, maxClientTimeout)
+
+		ctx, cancel := context.WithTimeoutCause(r.Context(), timeout, errClientTimeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// excludeClientTimeout marks errors caused by the client's own deadline so
+// the circuit breaker doesn't hold them against the dependency
+func excludeClientTimeout(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), errClientTimeout) {
+		return fmt.Errorf("%w: %w", circuitbreaker.ErrCallerAbandoned, err)
+	}
+	return err
+}
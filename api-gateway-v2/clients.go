@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Upstream clients. Handlers depend on these interfaces rather than on HTTP
+// directly, so they can be exercised with stubs and alternative transports
+// can be swapped in.
+
+// ProductClient fetches catalog entries
+type ProductClient interface {
+	GetProduct(ctx context.Context, productID string) (*Product, error)
+}
+
+// RecommendationsClient fetches recommendations for a product, returning at
+// most maxRecommendations items and the total number available
+type RecommendationsClient interface {
+	GetRecommendations(ctx context.Context, productID string) ([]Product, int, error)
+}
+
+// ProductClientFunc adapts a function to ProductClient (handy as a stub)
+type ProductClientFunc func(ctx context.Context, productID string) (*Product, error)
+
+func (f ProductClientFunc) GetProduct(ctx context.Context, productID string) (*Product, error) {
+	return f(ctx, productID)
+}
+
+// RecommendationsClientFunc adapts a function to RecommendationsClient
+type RecommendationsClientFunc func(ctx context.Context, productID string) ([]Product, int, error)
+
+func (f RecommendationsClientFunc) GetRecommendations(ctx context.Context, productID string) ([]Product, int, error) {
+	return f(ctx, productID)
+}
+
+// HTTPProductClient talks to product-service over HTTP
+type HTTPProductClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPProductClient(baseURL string, client *http.Client) *HTTPProductClient {
+	return &HTTPProductClient{baseURL: baseURL, client: client}
+}
+
+func (c *HTTPProductClient) GetProduct(ctx context.Context, productID string) (*Product, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/product/%s", c.baseURL, url.PathEscape(productID)), nil)
+	if err != nil {
+		return nil, err
+	}
+	applyPropagatedHeaders(ctx, req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, &UpstreamError{Upstream: "product-service", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &UpstreamError{Upstream: "product-service", StatusCode: resp.StatusCode}
+	}
+
+	// Either product model version decodes (internal/models/version.go)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, classifyDecodeError("product-service", err)
+	}
+	product, err := models.DecodeProduct(data, rejectUnknownUpstreamFields)
+	if err != nil {
+		return nil, classifyDecodeError("product-service", err)
+	}
+	if err := validateProduct("product-service", &product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// Ping checks product-service's /health, for readiness probes
+func (c *HTTPProductClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return &UpstreamError{Upstream: "product-service", Err: err}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &UpstreamError{Upstream: "product-service", StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// HTTPRecommendationsClient talks to one recommendations-service deployment
+type HTTPRecommendationsClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPRecommendationsClient(baseURL string, client *http.Client) *HTTPRecommendationsClient {
+	return &HTTPRecommendationsClient{baseURL: baseURL, client: client}
+}
+
+func (c *HTTPRecommendationsClient) GetRecommendations(ctx context.Context, productID string) ([]Product, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/recommendations/%s", c.baseURL, url.PathEscape(productID)), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	applyPropagatedHeaders(ctx, req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, &UpstreamError{Upstream: "recommendations-service", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, &UpstreamError{Upstream: "recommendations-service", StatusCode: resp.StatusCode}
+	}
+
+	return decodeRecommendations(resp.Body, maxRecommendations, maxRecommendationsBytes)
+}
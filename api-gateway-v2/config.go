@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Environment variables read by the gateway. The loaders in each feature
+// file read their variables through settings.Value, so the defaults here
+// are the only ones; the table is validated by --check and again at
+// startup, so new variables must be added here.
+var settings = config.Settings{
+	{Name: "LISTEN_ADDR", Default: ":8080", Validate: config.Addr},
+	{Name: "ADMIN_TOKEN", Secret: true}, // Bearer token for the /admin/ endpoints (unset = disabled)
+	{Name: "LOG_FORMAT", Default: "json", Validate: config.Enum(logging.Formats...)},
+	{Name: "LOG_LEVEL", Default: "info", Validate: config.Enum(logging.Levels...)},
+	{Name: "SHUTDOWN_TIMEOUT", Default: "15s", Validate: config.Duration},
+	{Name: "SHUTDOWN_DELAY", Default: "0s", Validate: config.DurationOrZero},
+	{Name: "WATCHDOG_THRESHOLD", Default: "10s", Validate: config.Duration},
+	{Name: "DEGRADED_LOG_PATH", Default: "", Validate: config.Optional(config.WritablePath)},
+	{Name: "DEGRADED_LOG_MAX_BYTES", Default: "10485760", Validate: config.Int(1)},
+	{Name: "DEGRADED_LOG_MAX_FILES", Default: "5", Validate: config.Int(1)},
+	{Name: "MAX_RECOMMENDATIONS", Default: "20", Validate: config.Int(0)},
+	{Name: "MAX_RECOMMENDATIONS_BYTES", Default: "1048576", Validate: config.Int(1)},
+	{Name: "UPSTREAM_UNKNOWN_FIELDS", Default: "ignore", Validate: config.Enum("ignore", "reject")},
+	{Name: "HOOK_RESPONSE_HEADERS", Default: "", Validate: config.KeyValueList},
+	{Name: "HOOK_REDACT_DESCRIPTIONS", Default: "false", Validate: config.Bool},
+	{Name: "DEBUG_CAPTURE_SAMPLE", Default: "0", Validate: config.Float(0, 1)},
+	{Name: "DEBUG_CAPTURE_REDACT_HEADERS"},
+	{Name: "DEBUG_CAPTURE_REDACT_FIELDS"},
+	{Name: "PROPAGATE_HEADERS"},
+	{Name: "ERROR_MAPPING_FILE", Default: "", Validate: validErrorMappingFile},
+	{Name: "MAX_CLIENT_TIMEOUT_MS", Default: "5000", Validate: config.Int(1)},
+	{Name: "PRODUCT_BUDGET_MS", Default: "0", Validate: config.Int(0)},
+	{Name: "RECOMMENDATIONS_BUDGET_MS", Default: "0", Validate: config.Int(0)},
+	{Name: "ADMISSION_CONTROL", Default: "false", Validate: config.Bool},
+	{Name: "ADMISSION_LATENCY_TARGET_MS", Default: "500", Validate: config.Int(1)},
+	{Name: "WARMUP_PERIOD", Default: "", Validate: config.Optional(config.Duration)},
+	{Name: "WARMUP_INITIAL_RPS", Default: "5", Validate: config.Float(0.1, 1e6)},
+	{Name: "WARMUP_MAX_RPS", Default: "200", Validate: config.Float(0.1, 1e6)},
+	{Name: "MAX_CONCURRENT_PRODUCTS", Default: "0", Validate: config.Int(0)},
+	{Name: "MAX_CONCURRENT_RECS", Default: "0", Validate: config.Int(0)},
+	{Name: "BULKHEAD_QUEUE_TIMEOUT_MS", Default: "0", Validate: config.Int(0)},
+	{Name: "RATE_LIMIT_RPS", Default: "0", Validate: config.Float(0, 1e6)},
+	{Name: "RATE_LIMIT_BURST", Default: "10", Validate: config.Float(1, 1e6)},
+	{Name: "RATE_LIMIT_ROUTES", Default: "", Validate: config.KeyValueList},
+	{Name: "RATE_LIMIT_GLOBAL_RPS", Default: "0", Validate: config.Float(0, 1e6)},
+	{Name: "RATE_LIMIT_MAX_IN_FLIGHT", Default: "0", Validate: config.Int(0)},
+	{Name: "RETRY_MAX_ATTEMPTS", Default: "3", Validate: config.Int(1)},
+	{Name: "RETRY_BASE_DELAY_MS", Default: "50", Validate: config.Int(1)},
+	{Name: "RETRY_MAX_DELAY_MS", Default: "1000", Validate: config.Int(1)},
+	{Name: "RETRY_BREAKER_MODE", Default: "once", Validate: config.Enum("once", "each")},
+	{Name: "BROWNOUT", Default: "false", Validate: config.Bool},
+	{Name: "BROWNOUT_CAPACITY", Default: "100", Validate: config.Int(1)},
+	{Name: "BROWNOUT_THRESHOLDS", Default: "0.6,0.8", Validate: validBrownoutThresholds},
+	{Name: "RESPONSE_META", Default: "basic", Validate: config.Enum("off", "basic", "full")},
+	{Name: "PRODUCT_SERVICE_URL", Default: productServiceURL, Validate: config.URL},
+	{Name: "RECOMMENDATIONS_URL", Default: recommendationsServiceURL, Validate: config.URL},
+	{Name: "RECOMMENDATIONS_SECONDARY_URL", Default: "", Validate: config.URL},
+	{Name: "UPSTREAM_TLS_PINS", Default: "", Validate: validUpstreamPins},
+	{Name: "BREAKER_WEBHOOK_URL", Default: "", Validate: config.URL},
+	{Name: "BREAKER_WEBHOOK_FORMAT", Default: "json", Validate: config.Enum("json", "slack")},
+	{Name: "BREAKER_WEBHOOK_BREAKERS"},
+	{Name: "HEALTH_PROBE_INTERVAL", Default: "5s", Validate: config.Duration},
+}
+
+// Dependencies probed by --check-deps
+func dependencies() map[string]string {
+	deps := map[string]string{
+		"product-service":         settings.Value("PRODUCT_SERVICE_URL"),
+		"recommendations-service": settings.Value("RECOMMENDATIONS_URL"),
+	}
+	if v := settings.Value("RECOMMENDATIONS_SECONDARY_URL"); v != "" {
+		deps["recommendations-service (secondary)"] = v
+	}
+	return deps
+}
+
+func validErrorMappingFile(v string) error {
+	if v == "" {
+		return nil
+	}
+	data, err := os.ReadFile(v)
+	if err != nil {
+		return err
+	}
+	var rules []ErrorMapping
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	for i, rule := range rules {
+		if rule.Status < 100 || rule.Status > 599 {
+			return fmt.Errorf("rule %d: invalid status %d", i, rule.Status)
+		}
+	}
+	return nil
+}
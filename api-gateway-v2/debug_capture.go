@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Opt-in debug capture of sampled request/response bodies. Everything that
+// reaches the log goes through the redaction config first so PII (auth
+// headers, cookies, configured JSON fields) never lands in logs.
+//
+//	DEBUG_CAPTURE_SAMPLE=0.01                          fraction of requests captured (0 = off)
+//	DEBUG_CAPTURE_REDACT_HEADERS=X-User-Email          extra headers to redact
+//	DEBUG_CAPTURE_REDACT_FIELDS=product.price,recommendations.*.id
+//	                                                   JSON field paths to redact ("*" = any key/index)
+
+const (
+	debugCaptureMaxBody = 64 * 1024 // Bytes of each body kept for the capture
+	redactedValue       = "[REDACTED]"
+)
+
+type debugCaptureConfig struct {
+	sample        float64
+	redactHeaders map[string]bool
+	redactFields  [][]string
+}
+
+var debugCapture = debugCaptureConfig{
+	redactHeaders: map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+		"X-Api-Key":           true,
+	},
+}
+
+func loadDebugCaptureFromEnv() {
+	if v, err := strconv.ParseFloat(settings.Value("DEBUG_CAPTURE_SAMPLE"), 64); err == nil && v > 0 {
+		debugCapture.sample = v
+	}
+	for _, h := range strings.Split(settings.Value("DEBUG_CAPTURE_REDACT_HEADERS"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			debugCapture.redactHeaders[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+	for _, f := range strings.Split(settings.Value("DEBUG_CAPTURE_REDACT_FIELDS"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			debugCapture.redactFields = append(debugCapture.redactFields, strings.Split(f, "."))
+		}
+	}
+	if debugCapture.sample > 0 {
+		slog.Info("Debug capture enabled", "sample", debugCapture.sample)
+	}
+}
+
+type capturedMessage struct {
+	Headers map[string][]string `json:"headers"`
+	Body    json.RawMessage     `json:"body,omitempty"`
+	Status  int                 `json:"status,omitempty"`
+}
+
+type debugCaptureRecord struct {
+	Timestamp string          `json:"timestamp"` // Request start, for replay pacing
+	Method    string          `json:"method"`
+	URL       string          `json:"url"`
+	Request   capturedMessage `json:"request"`
+	Response  capturedMessage `json:"response"`
+}
+
+// captureWriter tees the response (up to debugCaptureMaxBody) while passing
+// it through unchanged
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	cw.status = status
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	if room := debugCaptureMaxBody - cw.body.Len(); room > 0 {
+		cw.body.Write(p[:min(len(p), room)])
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach Flush/SetWriteDeadline
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *captureWriter) Flush() {
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// withDebugCapture wraps next, logging a sanitized capture of a sampled
+// fraction of requests
+func withDebugCapture(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if debugCapture.sample <= 0 || rand.Float64() >= debugCapture.sample {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var reqBody []byte
+		if r.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(r.Body, debugCaptureMaxBody))
+			// Hand the handler the bytes we consumed followed by any remainder
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+		}
+
+		startTime := time.Now()
+		cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+
+		record := debugCaptureRecord{
+			Timestamp: startTime.Format(time.RFC3339Nano),
+			Method:    r.Method,
+			URL:       r.URL.RequestURI(),
+			Request: capturedMessage{
+				Headers: redactHeaders(r.Header),
+				Body:    redactBody(reqBody),
+			},
+			Response: capturedMessage{
+				Headers: redactHeaders(w.Header()),
+				Body:    redactBody(cw.body.Bytes()),
+				Status:  cw.status,
+			},
+		}
+		if line, err := json.Marshal(record); err == nil {
+			logging.For(r.Context(), slog.Default()).Info("debug-capture", "capture", json.RawMessage(line))
+		}
+	})
+}
+
+func redactHeaders(h http.Header) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		if debugCapture.redactHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = []string{redactedValue}
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// redactBody applies the field redactions to a JSON body. Bodies that
+// aren't valid JSON (HTML pages, NDJSON, binary encodings, truncated
+// captures) can't be redacted field by field, so only their size is kept.
+func redactBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		placeholder, _ := json.Marshal("[" + strconv.Itoa(len(body)) + " bytes, not JSON]")
+		return placeholder
+	}
+	for _, path := range debugCapture.redactFields {
+		doc = redactPath(doc, path)
+	}
+	out, _ := json.Marshal(doc)
+	return out
+}
+
+func redactPath(node interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redactedValue
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if path[0] == "*" || path[0] == k {
+				n[k] = redactPath(v, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, v := range n {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				n[i] = redactPath(v, path[1:])
+			}
+		}
+	}
+	return node
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Fallback tiers recorded when a degraded response is served
+const (
+	fallbackTierEmpty    = "empty"    // getFallbackRecommendations() - empty list
+	fallbackTierBrownout = "brownout" // Recommendations skipped under load (brownout.go)
+)
+
+// DegradedEvent captures what a user saw when we served a degraded response
+type DegradedEvent struct {
+	Timestamp    string `json:"timestamp"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	ProductID    string `json:"product_id"`
+	RemoteAddr   string `json:"remote_addr"`
+	UserAgent    string `json:"user_agent"`
+	FallbackTier string `json:"fallback_tier"`
+	CircuitState string `json:"circuit_state"`
+	Error        string `json:"error"`
+	RequestID    string `json:"request_id,omitempty"`
+}
+
+// DegradedLog asynchronously appends degraded events to a size-rotated
+// JSON-lines file so postmortems can replay exactly what users received.
+// Recording never blocks the request path: events are dropped when the
+// buffer is full.
+type DegradedLog struct {
+	mu       sync.RWMutex // Guards closed against Record racing Close
+	closed   bool
+	done     chan struct{}
+	events   chan DegradedEvent
+	path     string
+	maxBytes int64
+	maxFiles int
+	dropped  atomic.Int64
+
+	file *os.File
+	size int64
+}
+
+// NewDegradedLogFromEnv returns nil (recording disabled) unless
+// DEGRADED_LOG_PATH is set.
+func NewDegradedLogFromEnv() *DegradedLog {
+	path := settings.Value("DEGRADED_LOG_PATH")
+	if path == "" {
+		return nil
+	}
+
+	dl := &DegradedLog{
+		events:   make(chan DegradedEvent, 1024),
+		done:     make(chan struct{}),
+		path:     path,
+		maxBytes: 10 * 1024 * 1024, // Rotate every 10MB
+		maxFiles: 5,                // Keep degraded.log.1 ... degraded.log.5
+	}
+	if v, err := strconv.ParseInt(settings.Value("DEGRADED_LOG_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		dl.maxBytes = v
+	}
+	if v, err := strconv.Atoi(settings.Value("DEGRADED_LOG_MAX_FILES")); err == nil && v > 0 {
+		dl.maxFiles = v
+	}
+
+	go dl.run()
+	slog.Info("Recording degraded responses", "path", path)
+	return dl
+}
+
+// Record queues an event without blocking. Safe to call on a nil log.
+func (dl *DegradedLog) Record(ev DegradedEvent) {
+	if dl == nil {
+		return
+	}
+	dl.mu.RLock()
+	defer dl.mu.RUnlock()
+	if dl.closed {
+		return
+	}
+	select {
+	case dl.events <- ev:
+	default:
+		if n := dl.dropped.Add(1); n%100 == 1 {
+			slog.Warn("Degraded log buffer full", "dropped_total", n)
+		}
+	}
+}
+
+// Close writes out queued events and closes the file. Events recorded
+// afterwards are discarded. Safe to call on a nil log.
+func (dl *DegradedLog) Close() {
+	if dl == nil {
+		return
+	}
+	dl.mu.Lock()
+	if !dl.closed {
+		dl.closed = true
+		close(dl.events)
+	}
+	dl.mu.Unlock()
+	<-dl.done
+}
+
+func (dl *DegradedLog) run() {
+	defer close(dl.done)
+	defer func() {
+		if dl.file != nil {
+			dl.file.Close()
+		}
+	}()
+	for ev := range dl.events {
+		line, err := json.Marshal(ev)
+		if err != nil {
+			continue
+		}
+		line = append(line, '\n')
+
+		if err := dl.write(line); err != nil {
+			slog.Error("Error writing degraded log", "error", err)
+		}
+	}
+}
+
+func (dl *DegradedLog) write(line []byte) error {
+	if dl.file != nil && dl.size+int64(len(line)) > dl.maxBytes {
+		if err := dl.rotate(); err != nil {
+			return err
+		}
+	}
+	if dl.file == nil {
+		f, err := os.OpenFile(dl.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		dl.file = f
+		dl.size = info.Size()
+	}
+
+	n, err := dl.file.Write(line)
+	dl.size += int64(n)
+	return err
+}
+
+// rotate shifts degraded.log -> degraded.log.1 -> ... and drops the oldest
+func (dl *DegradedLog) rotate() error {
+	dl.file.Close()
+	dl.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", dl.path, dl.maxFiles))
+	for i := dl.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", dl.path, i), fmt.Sprintf("%s.%d", dl.path, i+1))
+	}
+	return os.Rename(dl.path, dl.path+".1")
+}
+
+func newDegradedEvent(r *http.Request, productID, tier, state string, err error) DegradedEvent {
+	ev := DegradedEvent{
+		Timestamp:    time.Now().Format(time.RFC3339Nano),
+		Method:       r.Method,
+		Path:         r.URL.RequestURI(),
+		ProductID:    productID,
+		RemoteAddr:   r.RemoteAddr,
+		UserAgent:    r.UserAgent(),
+		FallbackTier: tier,
+		CircuitState: state,
+		RequestID:    logging.RequestIDFrom(r.Context()),
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	return ev
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conditional and delta responses for clients polling /product-details.
+//
+// The ETag is built from a hash per section, W/"p<product>-r<recommendations>",
+// so a client that sends its last ETag back as ?since= gets only the
+// sections that changed. Degraded responses carry no validators: their
+// recommendations reflect an outage, not the catalog.
+
+// DeltaResponse is returned for ?since= requests when something changed.
+// Unchanged sections are omitted and listed in Unchanged.
+type DeltaResponse struct {
+	ETag            string     `json:"etag"`
+	Changed         []string   `json:"changed"`
+	Unchanged       []string   `json:"unchanged"`
+	Product         *Product   `json:"product,omitempty"`
+	Recommendations *[]Product `json:"recommendations,omitempty"`
+	Timestamp       string     `json:"timestamp"`
+}
+
+type sectionHashes struct {
+	product         string
+	recommendations string
+}
+
+func hashSection(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+func hashDetails(d *ProductDetails) sectionHashes {
+	// Expanded bundle components count as part of the product section
+	var product interface{} = d.Product
+	if len(d.BundleComponents) > 0 {
+		product = []interface{}{d.Product, d.BundleComponents}
+	}
+	return sectionHashes{
+		product:         hashSection(product),
+		recommendations: hashSection(d.Recommendations),
+	}
+}
+
+func (h sectionHashes) etag() string {
+	return `W/"p` + h.product + `-r` + h.recommendations + `"`
+}
+
+// parseETag extracts section hashes from an ETag we issued
+func parseETag(tag string) (sectionHashes, bool) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	tag = strings.Trim(tag, `"`)
+	p, r, ok := strings.Cut(tag, "-r")
+	if !ok || !strings.HasPrefix(p, "p") {
+		return sectionHashes{}, false
+	}
+	return sectionHashes{product: p[1:], recommendations: r}, true
+}
+
+// Last-Modified is approximated as the first time this gateway saw the
+// current content for a product, since the backends don't expose
+// modification times
+var lastModified = struct {
+	mu      sync.Mutex
+	entries map[string]lastModifiedEntry
+}{entries: map[string]lastModifiedEntry{}}
+
+type lastModifiedEntry struct {
+	etag string
+	at   time.Time
+}
+
+const maxLastModifiedEntries = 10000
+
+func observeLastModified(id, etag string) time.Time {
+	lastModified.mu.Lock()
+	defer lastModified.mu.Unlock()
+
+	if e, ok := lastModified.entries[id]; ok && e.etag == etag {
+		return e.at
+	}
+	if len(lastModified.entries) >= maxLastModifiedEntries {
+		lastModified.entries = map[string]lastModifiedEntry{}
+	}
+	now := time.Now().Truncate(time.Second) // HTTP dates have 1s resolution
+	lastModified.entries[id] = lastModifiedEntry{etag: etag, at: now}
+	return now
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Weak comparison (RFC 9110 section 8.8.3.2)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConditional handles validators and ?since= for a composed response.
+// It returns true if it wrote the response (304 or delta); otherwise the
+// caller writes the full representation, with validators already set.
+func writeConditional(w http.ResponseWriter, r *http.Request, id string, details *ProductDetails) bool {
+	if details.DegradedMode {
+		w.Header().Set("Cache-Control", "no-store")
+		return false
+	}
+
+	hashes := hashDetails(details)
+	etag := hashes.etag()
+	modified := observeLastModified(id, etag)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+
+	// If-None-Match takes precedence over If-Modified-Since
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil && !modified.After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		return false
+	}
+	prev, ok := parseETag(since)
+	if !ok {
+		// Unknown baseline: the full representation is the delta
+		return false
+	}
+	if prev == hashes {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	delta := DeltaResponse{
+		ETag:      etag,
+		Changed:   []string{},
+		Unchanged: []string{},
+		Timestamp: details.Timestamp,
+	}
+	if prev.product != hashes.product {
+		delta.Changed = append(delta.Changed, "product")
+		delta.Product = &details.Product
+	} else {
+		delta.Unchanged = append(delta.Unchanged, "product")
+	}
+	if prev.recommendations != hashes.recommendations {
+		delta.Changed = append(delta.Changed, "recommendations")
+		delta.Recommendations = &details.Recommendations
+	} else {
+		delta.Unchanged = append(delta.Unchanged, "recommendations")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonEncoder{}.Encode(w, delta)
+	return true
+}
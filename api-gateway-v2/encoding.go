@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResponseEncoder serializes gateway responses for one media type
+type ResponseEncoder interface {
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string { return "application/json" }
+
+func (jsonEncoder) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) ContentType() string { return "application/xml" }
+
+func (xmlEncoder) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) ContentType() string { return "application/msgpack" }
+
+func (msgpackEncoder) Encode(w io.Writer, v interface{}) error {
+	b, err := marshalMsgpack(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Encoder registry. The first registered encoder is the default used when
+// the client doesn't send an Accept header (or accepts anything).
+var (
+	encoderOrder []string
+	encoders     = map[string]ResponseEncoder{}
+)
+
+// RegisterEncoder adds (or replaces) the encoder for its content type
+func RegisterEncoder(enc ResponseEncoder) {
+	ct := enc.ContentType()
+	if _, exists := encoders[ct]; !exists {
+		encoderOrder = append(encoderOrder, ct)
+	}
+	encoders[ct] = enc
+}
+
+func init() {
+	RegisterEncoder(jsonEncoder{})
+	RegisterEncoder(xmlEncoder{})
+	RegisterEncoder(msgpackEncoder{})
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges in the Accept header ordered by
+// preference (q-value, then order of appearance). Ranges with q=0 are dropped.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	return ranges
+}
+
+// negotiateEncoder picks the registered encoder that best matches the
+// request's Accept header, or returns nil if none is acceptable.
+func negotiateEncoder(r *http.Request) ResponseEncoder {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return encoders[encoderOrder[0]]
+	}
+
+	for _, ar := range parseAccept(header) {
+		switch {
+		case ar.mediaType == "*/*":
+			return encoders[encoderOrder[0]]
+		case strings.HasSuffix(ar.mediaType, "/*"):
+			prefix := strings.TrimSuffix(ar.mediaType, "*")
+			for _, ct := range encoderOrder {
+				if strings.HasPrefix(ct, prefix) {
+					return encoders[ct]
+				}
+			}
+		default:
+			if enc, ok := encoders[ar.mediaType]; ok {
+				return enc
+			}
+		}
+	}
+	return nil
+}
+
+// writeNegotiated encodes v in the format the client asked for, or responds
+// 406 listing the supported types.
+func writeNegotiated(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	enc := negotiateEncoder(r)
+	if enc == nil {
+		http.Error(w, "Not Acceptable; supported types: "+strings.Join(encoderOrder, ", "),
+			http.StatusNotAcceptable)
+		return
+	}
+
+	w.Header().Set("Content-Type", enc.ContentType())
+	if err := enc.Encode(w, v); err != nil {
+		slog.Error("Error encoding response", "content_type", enc.ContentType(), "error", err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+func sampleDetails() ProductDetails {
+	return ProductDetails{
+		Product: Product{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop", Category: "computers"},
+		Recommendations: []Product{
+			{ID: "2", Name: "Mouse", Price: 29.99, Category: "accessories"},
+			{ID: "3", Name: "Keyboard", Price: 79.99, Category: "accessories",
+				Availability: &models.Availability{Status: models.StatusAvailable}},
+		},
+		Timestamp:            "2026-01-02T03:04:05Z",
+		DegradedMode:         true,
+		RecommendationsTotal: 12,
+	}
+}
+
+func TestJSONEncoderRoundTrip(t *testing.T) {
+	want := sampleDetails()
+	var buf bytes.Buffer
+	if err := (jsonEncoder{}).Encode(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	var got ProductDetails
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestXMLEncoderRoundTrip(t *testing.T) {
+	want := sampleDetails()
+	var buf bytes.Buffer
+	if err := (xmlEncoder{}).Encode(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(xml.Header)) {
+		t.Errorf("missing XML declaration: %q", buf.String())
+	}
+	var got ProductDetails
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	got.XMLName = xml.Name{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+// The msgpack encoder follows the json tags, so decoding its output
+// generically must give what decoding the JSON encoding does
+func TestMsgpackEncoderRoundTrip(t *testing.T) {
+	for _, v := range []interface{}{
+		sampleDetails(),
+		map[string]interface{}{"empty": []Product{}, "nil": nil, "n": -3, "ok": false},
+		[]string{"a", string(bytes.Repeat([]byte("x"), 300))},
+		// json.Marshalers: encoded from their JSON, not their fields
+		graphqlResponse{Data: gqlObject{{"product", gqlObject{{"id", "1"}, {"price", 999.99}}}}},
+		map[string]interface{}{"at": time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), "raw": json.RawMessage(`{"n":[1,2.5,null]}`)},
+	} {
+		var buf bytes.Buffer
+		if err := (msgpackEncoder{}).Encode(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		decoded, err := decodeMsgpack(&data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 0 {
+			t.Errorf("%d trailing bytes", len(data))
+		}
+		if got, want := viaJSON(t, decoded), viaJSON(t, v); !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip:\n got %v\nwant %v", got, want)
+		}
+	}
+}
+
+// A json.Marshaler that orders its keys keeps that order
+func TestMsgpackEncoderMarshalerKeyOrder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (msgpackEncoder{}).Encode(&buf, gqlObject{{"b", 1}, {"a", true}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x82, 0xa1, 'b', 0xd3, 0, 0, 0, 0, 0, 0, 0, 1, 0xa1, 'a', 0xc3}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got % x\nwant % x", buf.Bytes(), want)
+	}
+}
+
+func TestNegotiateEncoder(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string // "" means 406
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"application/msgpack", "application/msgpack"},
+		{"text/html, application/xml;q=0.9, */*;q=0.1", "application/xml"},
+		{"application/json;q=0.5, application/msgpack", "application/msgpack"},
+		{"application/xml;q=0, application/*", "application/json"},
+		{"APPLICATION/XML", "application/xml"},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/product-details/1", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		writeNegotiated(rec, req, sampleDetails())
+
+		if tt.want == "" {
+			if rec.Code != http.StatusNotAcceptable {
+				t.Errorf("Accept %q: status %d, want 406", tt.accept, rec.Code)
+			}
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || got != tt.want {
+			t.Errorf("Accept %q: %d %s, want 200 %s", tt.accept, rec.Code, got, tt.want)
+		}
+		if rec.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: Vary = %q, want Accept", tt.accept, rec.Header().Get("Vary"))
+		}
+	}
+}
+
+// viaJSON normalizes v to what encoding/json decodes it to
+func viaJSON(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// decodeMsgpack decodes the subset of MessagePack marshalMsgpack writes,
+// consuming it from the front of data
+func decodeMsgpack(data *[]byte) (interface{}, error) {
+	take := func(n int) ([]byte, error) {
+		if len(*data) < n {
+			return nil, fmt.Errorf("truncated: need %d bytes, have %d", n, len(*data))
+		}
+		b := (*data)[:n]
+		*data = (*data)[n:]
+		return b, nil
+	}
+	length := func(size int) (int, error) {
+		b, err := take(size)
+		if err != nil {
+			return 0, err
+		}
+		switch size {
+		case 1:
+			return int(b[0]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(b)), nil
+		default:
+			return int(binary.BigEndian.Uint32(b)), nil
+		}
+	}
+	collection := func(n int, isMap bool) (interface{}, error) {
+		if !isMap {
+			arr := make([]interface{}, n)
+			for i := range arr {
+				v, err := decodeMsgpack(data)
+				if err != nil {
+					return nil, err
+				}
+				arr[i] = v
+			}
+			return arr, nil
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := decodeMsgpack(data)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a string", k)
+			}
+			if m[key], err = decodeMsgpack(data); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	b, err := take(1)
+	if err != nil {
+		return nil, err
+	}
+	switch c := b[0]; {
+	case c == 0xc0:
+		return nil, nil
+	case c == 0xc2, c == 0xc3:
+		return c == 0xc3, nil
+	case c == 0xd3, c == 0xcf, c == 0xcb:
+		b, err := take(8)
+		if err != nil {
+			return nil, err
+		}
+		u := binary.BigEndian.Uint64(b)
+		switch c {
+		case 0xd3:
+			return int64(u), nil
+		case 0xcf:
+			return u, nil
+		}
+		return math.Float64frombits(u), nil
+	case c&0xe0 == 0xa0, c == 0xd9, c == 0xda, c == 0xdb:
+		n := int(c & 0x1f)
+		if c >= 0xd9 {
+			if n, err = length(1 << (c - 0xd9)); err != nil {
+				return nil, err
+			}
+		}
+		s, err := take(n)
+		return string(s), err
+	case c&0xf0 == 0x90:
+		return collection(int(c&0x0f), false)
+	case c&0xf0 == 0x80:
+		return collection(int(c&0x0f), true)
+	case c == 0xdc, c == 0xdd, c == 0xde, c == 0xdf:
+		n, err := length(2 << ((c - 0xdc) % 2))
+		if err != nil {
+			return nil, err
+		}
+		return collection(n, c >= 0xde)
+	}
+	return nil, fmt.Errorf("unexpected msgpack type byte %#x", b[0])
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// UpstreamError attributes a failed upstream call to its dependency.
+// StatusCode is set when the upstream answered with a non-200 status and
+// zero for transport-level failures (refused, reset, timeout).
+type UpstreamError struct {
+	Upstream   string
+	StatusCode int
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s returned status %d", e.Upstream, e.StatusCode)
+	}
+	return fmt.Sprintf("%s: %v", e.Upstream, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Is classifies the failure against the shared domain errors: a 404 is
+// ErrNotFound, a transport timeout ErrUpstreamTimeout, anything else
+// ErrUpstreamUnavailable
+func (e *UpstreamError) Is(target error) bool {
+	switch target {
+	case apperrors.ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case apperrors.ErrUpstreamTimeout:
+		return e.StatusCode == 0 && isTimeout(e.Err)
+	case apperrors.ErrUpstreamUnavailable:
+		return e.StatusCode != http.StatusNotFound && !(e.StatusCode == 0 && isTimeout(e.Err))
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// ErrorMapping translates one class of upstream failure into the response
+// the gateway sends. Match is an exact status ("404"), a status class
+// ("5xx"), "timeout", "unavailable", "invalid_response", "circuit_open",
+// "shed", "bulkhead_full", "pin_mismatch" or "*".
+type ErrorMapping struct {
+	Upstream    string `json:"upstream"` // Dependency name or "*"
+	Match       string `json:"match"`
+	Status      int    `json:"status"`
+	ProblemType string `json:"problem_type"`
+	Title       string `json:"title"`
+}
+
+// Default mapping, replacing the blanket 500s. Rules are evaluated in
+// order; the first match wins.
+var defaultErrorMappings = []ErrorMapping{
+	{"product-service", "404", http.StatusNotFound, "/problems/product-not-found", "Product not found"},
+	{"*", "shed", http.StatusServiceUnavailable, "/problems/load-shed", "Request shed to protect an unhealthy dependency"},
+	{"*", "bulkhead_full", http.StatusServiceUnavailable, "/problems/bulkhead-full", "Too many concurrent calls to dependency"},
+	{"*", "pin_mismatch", http.StatusBadGateway, "/problems/upstream-pin-mismatch", "Upstream failed certificate pinning"},
+	{"*", "circuit_open", http.StatusServiceUnavailable, "/problems/circuit-open", "Dependency temporarily disabled"},
+	{"*", "timeout", http.StatusGatewayTimeout, "/problems/upstream-timeout", "Upstream timed out"},
+	{"*", "invalid_response", http.StatusBadGateway, "/problems/upstream-invalid-response", "Upstream returned an invalid response"},
+	{"*", "4xx", http.StatusBadGateway, "/problems/upstream-rejected", "Upstream rejected the request"},
+	{"*", "5xx", http.StatusBadGateway, "/problems/upstream-error", "Upstream error"},
+	{"*", "unavailable", http.StatusBadGateway, "/problems/upstream-unavailable", "Upstream unavailable"},
+	{"*", "*", http.StatusInternalServerError, "/problems/internal", "Internal error"},
+}
+
+var errorMappings = struct {
+	mu    sync.RWMutex
+	rules []ErrorMapping
+}{rules: defaultErrorMappings}
+
+// loadErrorMappingsFromEnv replaces the default table with the JSON array in
+// ERROR_MAPPING_FILE, if set. A catch-all rule is appended when missing.
+func loadErrorMappingsFromEnv() {
+	path := settings.Value("ERROR_MAPPING_FILE")
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("Error reading ERROR_MAPPING_FILE", "error", err)
+		os.Exit(1)
+	}
+	var rules []ErrorMapping
+	if err := json.Unmarshal(data, &rules); err != nil {
+		slog.Error("Error parsing ERROR_MAPPING_FILE", "error", err)
+		os.Exit(1)
+	}
+	if n := len(rules); n == 0 || rules[n-1].Upstream != "*" || rules[n-1].Match != "*" {
+		rules = append(rules, defaultErrorMappings[len(defaultErrorMappings)-1])
+	}
+
+	errorMappings.mu.Lock()
+	errorMappings.rules = rules
+	errorMappings.mu.Unlock()
+	slog.Info("Loaded error mapping rules", "count", len(rules), "path", path)
+}
+
+// classifyUpstreamError returns the dependency and failure class of err
+func classifyUpstreamError(err error) (upstream string, class string) {
+	var schemaErr *SchemaError
+	var upErr *UpstreamError
+	switch {
+	case errors.As(err, &schemaErr):
+		upstream = schemaErr.Upstream
+	case errors.As(err, &upErr):
+		upstream = upErr.Upstream
+		if upErr.StatusCode != 0 {
+			return upstream, strconv.Itoa(upErr.StatusCode)
+		}
+	}
+
+	switch {
+	case errors.Is(err, errAdmissionShed):
+		return upstream, "shed"
+	case errors.Is(err, errBulkheadFull):
+		return upstream, "bulkhead_full"
+	case errors.Is(err, errPinMismatch):
+		return upstream, "pin_mismatch"
+	case errors.Is(err, apperrors.ErrCircuitOpen):
+		return upstream, "circuit_open"
+	case errors.Is(err, apperrors.ErrInvalidResponse):
+		return upstream, "invalid_response"
+	case errors.Is(err, apperrors.ErrUpstreamTimeout), errors.Is(err, context.DeadlineExceeded):
+		return upstream, "timeout"
+	case errors.Is(err, apperrors.ErrUpstreamUnavailable):
+		return upstream, "unavailable"
+	}
+	return upstream, ""
+}
+
+func (m ErrorMapping) matches(upstream, class string) bool {
+	if m.Upstream != "*" && m.Upstream != upstream {
+		return false
+	}
+	switch {
+	case m.Match == "*" || m.Match == class:
+		return true
+	case len(m.Match) == 3 && m.Match[1:] == "xx" && len(class) == 3:
+		// Status class: "5xx" matches "503"
+		return m.Match[0] == class[0] && class[1] >= '0' && class[1] <= '9'
+	}
+	return false
+}
+
+func (m ErrorMapping) problem() apperrors.Problem {
+	return apperrors.Problem{Type: m.ProblemType, Title: m.Title, Status: m.Status}
+}
+
+func lookupErrorMapping(err error) ErrorMapping {
+	upstream, class := classifyUpstreamError(err)
+
+	errorMappings.mu.RLock()
+	defer errorMappings.mu.RUnlock()
+	for _, m := range errorMappings.rules {
+		if m.matches(upstream, class) {
+			return m
+		}
+	}
+	return defaultErrorMappings[len(defaultErrorMappings)-1]
+}
+
+// writeUpstreamError responds with the mapped status and a problem document
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	apperrors.WriteProblem(w, lookupErrorMapping(err).problem())
+}
+
+// errorMappingHandler exposes the active mapping table (admin token
+// required)
+func errorMappingHandler(w http.ResponseWriter, r *http.Request) {
+	errorMappings.mu.RLock()
+	rules := append([]ErrorMapping(nil), errorMappings.rules...)
+	errorMappings.mu.RUnlock()
+
+	jsonutil.Write(w, http.StatusOK, rules)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// Primary/secondary upstream sets with health-based failover. Each set has
+// its own circuit breaker, so an outage in one region doesn't poison the
+// breaker state of the other.
+
+// UpstreamSet is one deployment (e.g. region) of a dependency
+type UpstreamSet struct {
+	Name    string // "primary" or "secondary"
+	URL     string
+	Client  RecommendationsClient
+	Breaker *CircuitBreaker
+
+	mu      sync.Mutex
+	healthy bool // Result of the last active health probe
+}
+
+func newUpstreamSet(upstream, name, baseURL string, client *http.Client, breakers *circuitbreaker.Registry) *UpstreamSet {
+	return &UpstreamSet{
+		Name:    name,
+		URL:     baseURL,
+		Client:  NewHTTPRecommendationsClient(baseURL, client),
+		Breaker: breakers.Get(upstream + "/" + name), // Same key as its health tracker
+		healthy: true,
+	}
+}
+
+func (s *UpstreamSet) setHealthy(healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthy = healthy
+}
+
+func (s *UpstreamSet) isHealthy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthy && s.Breaker.State() != circuitbreaker.StateOpen
+}
+
+// FailoverUpstream routes calls for one dependency to its primary set while
+// that set is healthy, falling over to the secondary (if configured) when
+// the primary's breaker opens or its health probe fails
+type FailoverUpstream struct {
+	Name      string
+	Primary   *UpstreamSet
+	Secondary *UpstreamSet // nil when no secondary is configured
+
+	mu       sync.Mutex
+	override string // "", "primary" or "secondary" (admin forced)
+	active   string // Last set returned by Active, for transition logging
+}
+
+// NewFailoverUpstream builds the sets for dependency name. Their breakers
+// are registered in breakers as "<name>/primary" and "<name>/secondary".
+func NewFailoverUpstream(name, primaryURL, secondaryURL string, client *http.Client, breakers *circuitbreaker.Registry) *FailoverUpstream {
+	u := &FailoverUpstream{
+		Name:    name,
+		Primary: newUpstreamSet(name, "primary", primaryURL, client, breakers),
+		active:  "primary",
+	}
+	if secondaryURL != "" {
+		u.Secondary = newUpstreamSet(name, "secondary", secondaryURL, client, breakers)
+	}
+	return u
+}
+
+// Active returns the set calls should currently go to
+func (u *FailoverUpstream) Active() *UpstreamSet {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	set := u.Primary
+	switch {
+	case u.override == "secondary" && u.Secondary != nil:
+		set = u.Secondary
+	case u.override == "primary":
+	case u.Secondary != nil && !u.Primary.isHealthy() && u.Secondary.isHealthy():
+		set = u.Secondary
+	}
+
+	if set.Name != u.active {
+		slog.Info("Failover routing changed", "upstream", u.Name, "set", set.Name, "url", set.URL)
+		u.active = set.Name
+	}
+	return set
+}
+
+// SetOverride forces a set ("primary"/"secondary") or restores automatic
+// failover ("auto")
+func (u *FailoverUpstream) SetOverride(mode string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	switch mode {
+	case "auto":
+		u.override = ""
+	case "primary":
+		u.override = mode
+	case "secondary":
+		if u.Secondary == nil {
+			return fmt.Errorf("%s has no secondary set configured", u.Name)
+		}
+		u.override = mode
+	default:
+		return fmt.Errorf("unknown mode %q (want primary, secondary or auto)", mode)
+	}
+	slog.Info("Failover override set", "upstream", u.Name, "mode", mode)
+	return nil
+}
+
+// probeHealth polls each set's /health endpoint until the process exits
+func (u *FailoverUpstream) probeHealth(interval time.Duration) {
+	client := &http.Client{Timeout: 2 * time.Second, Transport: upstreamTransport}
+	probe := func(s *UpstreamSet) {
+		resp, err := client.Get(s.URL + "/health")
+		healthy := err == nil && resp.StatusCode == http.StatusOK
+		if resp != nil {
+			resp.Body.Close()
+		}
+		s.setHealthy(healthy)
+	}
+
+	for range time.Tick(interval) {
+		probe(u.Primary)
+		if u.Secondary != nil {
+			probe(u.Secondary)
+		}
+	}
+}
+
+type upstreamSetStatus struct {
+	URL          string `json:"url"`
+	Healthy      bool   `json:"healthy"`
+	CircuitState string `json:"circuit_state"`
+}
+
+type failoverStatus struct {
+	Active    string             `json:"active"`
+	Override  string             `json:"override"`
+	Primary   upstreamSetStatus  `json:"primary"`
+	Secondary *upstreamSetStatus `json:"secondary,omitempty"`
+}
+
+func (u *FailoverUpstream) Status() failoverStatus {
+	setStatus := func(s *UpstreamSet) upstreamSetStatus {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return upstreamSetStatus{URL: s.URL, Healthy: s.healthy, CircuitState: s.Breaker.GetState()}
+	}
+
+	active := u.Active().Name
+	u.mu.Lock()
+	override := u.override
+	u.mu.Unlock()
+	if override == "" {
+		override = "auto"
+	}
+
+	st := failoverStatus{Active: active, Override: override, Primary: setStatus(u.Primary)}
+	if u.Secondary != nil {
+		sec := setStatus(u.Secondary)
+		st.Secondary = &sec
+	}
+	return st
+}
+
+// newRecommendationsUpstreamFromEnv builds the upstream sets for the
+// recommendations dependency:
+//
+//	RECOMMENDATIONS_URL            primary set (default recommendationsServiceURL)
+//	RECOMMENDATIONS_SECONDARY_URL  optional secondary set
+//	HEALTH_PROBE_INTERVAL          e.g. 5s (default)
+func newRecommendationsUpstreamFromEnv(client *http.Client, breakers *circuitbreaker.Registry) *FailoverUpstream {
+	primary := recommendationsServiceURL
+	if v := settings.Value("RECOMMENDATIONS_URL"); v != "" {
+		primary = strings.TrimSuffix(v, "/")
+	}
+	secondary := strings.TrimSuffix(settings.Value("RECOMMENDATIONS_SECONDARY_URL"), "/")
+	upstream := NewFailoverUpstream("recommendations-service", primary, secondary, client, breakers)
+
+	interval, err := time.ParseDuration(settings.Value("HEALTH_PROBE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		slog.Error("Invalid HEALTH_PROBE_INTERVAL", "value", settings.Value("HEALTH_PROBE_INTERVAL"))
+		os.Exit(1)
+	}
+	if secondary != "" {
+		slog.Info("Recommendations failover configured", "primary", primary, "secondary", secondary)
+		go upstream.probeHealth(interval)
+	}
+	return upstream
+}
+
+// upstreamsAdminHandler serves GET /admin/upstreams (status of every set)
+// and POST /admin/upstreams?name=recommendations-service&mode=primary|secondary|auto
+// (admin token required)
+func (s *Server) upstreamsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	upstreams := map[string]*FailoverUpstream{
+		s.Recommendations.Name: s.Recommendations,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		u, ok := upstreams[r.URL.Query().Get("name")]
+		if !ok {
+			http.Error(w, "Unknown upstream", http.StatusNotFound)
+			return
+		}
+		if err := u.SetOverride(r.URL.Query().Get("mode")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := map[string]failoverStatus{}
+	for name, u := range upstreams {
+		status[name] = u.Status()
+	}
+	jsonutil.Write(w, http.StatusOK, status)
+}
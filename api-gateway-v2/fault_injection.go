@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// Gateway-side fault injection, so consumers of the gateway can test their
+// own resilience against it. Rules are managed at runtime on /admin/faults
+// (admin token required):
+//
+//	POST   /admin/faults  {"route": "/product-details/", "percent": 25, "delay_ms": 2000, "status": 503, "ttl_seconds": 300}
+//	GET    /admin/faults  active rules
+//	DELETE /admin/faults?route=/product-details/   (no route clears all)
+//
+// route is the mux pattern the request matched. An affected request is
+// delayed by delay_ms, then answered with status (if non-zero) instead of
+// reaching the handler. Rules expire after ttl_seconds so a forgotten
+// experiment can't outlive the demo; /admin/ routes are never affected.
+
+const (
+	defaultFaultTTL = 5 * time.Minute
+	maxFaultTTL     = time.Hour
+)
+
+type FaultRule struct {
+	Route      string    `json:"route"`
+	Percent    float64   `json:"percent"` // Share of requests affected, 0-100
+	DelayMs    int       `json:"delay_ms,omitempty"`
+	Status     int       `json:"status,omitempty"` // 0 = delay only
+	TTLSeconds int       `json:"ttl_seconds,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (f FaultRule) validate() error {
+	switch {
+	case f.Route == "":
+		return fmt.Errorf("route is required")
+	case strings.HasPrefix(f.Route, "/admin/"):
+		return fmt.Errorf("admin routes can't be faulted")
+	case f.Percent <= 0 || f.Percent > 100:
+		return fmt.Errorf("percent must be in (0, 100]")
+	case f.DelayMs < 0:
+		return fmt.Errorf("delay_ms must be >= 0")
+	case f.Status != 0 && (f.Status < 400 || f.Status > 599):
+		return fmt.Errorf("status must be a 4xx or 5xx code")
+	case f.DelayMs == 0 && f.Status == 0:
+		return fmt.Errorf("rule needs delay_ms or status")
+	}
+	return nil
+}
+
+// faultInjector holds one gateway instance's active rules
+type faultInjector struct {
+	mu    sync.Mutex
+	rules map[string]FaultRule // Keyed by route
+}
+
+func newFaultInjector() *faultInjector {
+	return &faultInjector{rules: map[string]FaultRule{}}
+}
+
+// lookup returns the live rule for route, dropping it if it has expired
+func (fi *faultInjector) lookup(route string) (FaultRule, bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	rule, ok := fi.rules[route]
+	if ok && time.Now().After(rule.ExpiresAt) {
+		delete(fi.rules, route)
+		slog.Info("Fault expired", "route", route)
+		return FaultRule{}, false
+	}
+	return rule, ok
+}
+
+func (fi *faultInjector) set(rule FaultRule) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rules[rule.Route] = rule
+}
+
+func (fi *faultInjector) clear(route string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if route == "" {
+		clear(fi.rules)
+		return
+	}
+	delete(fi.rules, route)
+}
+
+func (fi *faultInjector) list() []FaultRule {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	now := time.Now()
+	rules := []FaultRule{}
+	for route, rule := range fi.rules {
+		if now.After(rule.ExpiresAt) {
+			delete(fi.rules, route)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Route < rules[j].Route })
+	return rules
+}
+
+// withFaultInjection applies the active rule for the route mux would
+// dispatch r to
+func (s *Server) withFaultInjection(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		rule, ok := s.faults.lookup(route)
+		if !ok || rand.Float64()*100 >= rule.Percent {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		if rule.DelayMs > 0 {
+			select {
+			case <-time.After(time.Duration(rule.DelayMs) * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if rule.Status == 0 {
+			w.Header().Set("X-Injected-Fault", "delay")
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-Injected-Fault", "error")
+		apperrors.WriteProblem(w, apperrors.Problem{
+			Type:   "/problems/injected-fault",
+			Title:  "Injected fault",
+			Status: rule.Status,
+			Detail: "fault injection is active on " + route,
+		})
+	})
+}
+
+func (s *Server) faultsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var rule FaultRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := rule.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl := defaultFaultTTL
+		if rule.TTLSeconds > 0 {
+			ttl = min(time.Duration(rule.TTLSeconds)*time.Second, maxFaultTTL)
+		}
+		rule.TTLSeconds = int(ttl / time.Second)
+		rule.ExpiresAt = time.Now().Add(ttl)
+		s.faults.set(rule)
+		s.log(r.Context()).Info("Fault set", "route", rule.Route, "percent", rule.Percent,
+			"delay_ms", rule.DelayMs, "status", rule.Status, "ttl", ttl.String())
+	case http.MethodDelete:
+		route := r.URL.Query().Get("route")
+		s.faults.clear(route)
+		s.log(r.Context()).Info("Faults cleared", "route", route)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonutil.Write(w, http.StatusOK, s.faults.list())
+}
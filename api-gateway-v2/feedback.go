@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Recommendation feedback. Clients report clicks and purchases on
+// recommended products:
+//
+//	POST /feedback  {"product_id": "1", "recommended_id": "3", "event": "click", "strategy": "default"}
+//
+// The gateway counts them against the impressions it served, per strategy
+// (gateway_recommendation_ctr on /metrics), and forwards them to the active
+// recommendations set, which uses them to reorder future recommendations.
+// Forwarding is best effort: the answer is 202 either way, since clients
+// shouldn't retry click tracking. There is no experiment framework yet, so
+// impressions are all counted under the default strategy.
+
+const feedbackForwardTimeout = 2 * time.Second
+
+// Strategies the gateway serves; feedback naming any other is counted as
+// "unknown"
+var knownStrategies = map[string]bool{models.DefaultStrategy: true}
+
+// feedbackSender is implemented by recommendations clients that can
+// forward feedback upstream
+type feedbackSender interface {
+	SendFeedback(ctx context.Context, fb models.Feedback) error
+}
+
+func (c *HTTPRecommendationsClient) SendFeedback(ctx context.Context, fb models.Feedback) error {
+	body, err := json.Marshal(fb)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/feedback", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	applyPropagatedHeaders(ctx, req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return &UpstreamError{Upstream: "recommendations-service", Err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &UpstreamError{Upstream: "recommendations-service", StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// recommendationStats tallies impressions and feedback per strategy
+type recommendationStats struct {
+	mu          sync.Mutex
+	impressions map[string]float64
+	feedback    map[string]map[string]float64 // strategy -> event -> count
+}
+
+func newRecommendationStats() *recommendationStats {
+	return &recommendationStats{impressions: map[string]float64{}, feedback: map[string]map[string]float64{}}
+}
+
+func (rs *recommendationStats) impression(strategy string, n int) {
+	rs.mu.Lock()
+	rs.impressions[strategy] += float64(n)
+	rs.mu.Unlock()
+}
+
+func (rs *recommendationStats) event(strategy, event string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.feedback[strategy] == nil {
+		rs.feedback[strategy] = map[string]float64{}
+	}
+	rs.feedback[strategy][event]++
+}
+
+func (rs *recommendationStats) write(w io.Writer) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	fmt.Fprint(w, "# HELP gateway_recommendation_impressions_total Recommended items served, by strategy.\n# TYPE gateway_recommendation_impressions_total counter\n")
+	for _, st := range sortedKeys(rs.impressions) {
+		fmt.Fprintf(w, "gateway_recommendation_impressions_total{%s} %g\n", labels("strategy", st), rs.impressions[st])
+	}
+	fmt.Fprint(w, "# HELP gateway_recommendation_feedback_total Clicks and purchases on recommended items.\n# TYPE gateway_recommendation_feedback_total counter\n")
+	for _, st := range sortedKeys(rs.feedback) {
+		for _, ev := range sortedKeys(rs.feedback[st]) {
+			fmt.Fprintf(w, "gateway_recommendation_feedback_total{%s} %g\n", labels("strategy", st, "event", ev), rs.feedback[st][ev])
+		}
+	}
+	for _, g := range []struct{ name, event, help string }{
+		{"gateway_recommendation_ctr", models.FeedbackClick, "Clicks per recommended item served."},
+		{"gateway_recommendation_conversion_rate", models.FeedbackPurchase, "Purchases per recommended item served."},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, st := range sortedKeys(rs.impressions) {
+			if n := rs.impressions[st]; n > 0 {
+				fmt.Fprintf(w, "%s{%s} %g\n", g.name, labels("strategy", st), rs.feedback[st][g.event]/n)
+			}
+		}
+	}
+}
+
+func (s *Server) feedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var fb models.Feedback
+	if err := json.NewDecoder(r.Body).Decode(&fb); err != nil {
+		apperrors.Write(w, fmt.Errorf("invalid JSON: %v: %w", err, apperrors.ErrValidation))
+		return
+	}
+	if fb.ProductID == "" || fb.RecommendedID == "" ||
+		(fb.Event != models.FeedbackClick && fb.Event != models.FeedbackPurchase) {
+		apperrors.Write(w, fmt.Errorf("feedback needs product_id, recommended_id and a click or purchase event: %w", apperrors.ErrValidation))
+		return
+	}
+	if fb.Strategy == "" {
+		fb.Strategy = models.DefaultStrategy
+	}
+	// Strategy is client-supplied; keep metric cardinality bounded
+	strategy := fb.Strategy
+	if !knownStrategies[strategy] {
+		strategy = "unknown"
+	}
+	s.recStats.event(strategy, fb.Event)
+
+	forwarded := false
+	set := s.Recommendations.Active()
+	if sender, ok := set.Client.(feedbackSender); ok && set.Breaker.State() != circuitbreaker.StateOpen {
+		ctx, cancel := context.WithTimeout(withPropagatedHeaders(r.Context(), r.Header), feedbackForwardTimeout)
+		err := sender.SendFeedback(ctx, fb)
+		cancel()
+		if err != nil {
+			s.log(r.Context()).Warn("Feedback not forwarded", "set", set.Name, "error", err)
+		}
+		forwarded = err == nil
+	}
+
+	jsonutil.Write(w, http.StatusAccepted, map[string]interface{}{"recorded": true, "forwarded": forwarded})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+)
+
+// Partial responses, for clients that don't need the whole composed body
+// (mobile clients on slow links):
+//
+//	?fields=product,recommendations  sections to send (default both)
+//	?limit=N                         at most N recommendations (N >= 0)
+//
+// Without ?fields= or ?limit= the response is unchanged. ?fields=product
+// skips the recommendations call altogether; ?fields=recommendations still
+// fetches the product, so an unknown ID is a 404 either way. ?limit= trims
+// after the MAX_RECOMMENDATIONS cap; recommendations_total still counts
+// what was available upstream. The metadata (timestamp, meta, degraded_mode,
+// recommendations_total, bundle_components) is always sent.
+
+// detailsFields is what a /product-details request selected
+type detailsFields struct {
+	product         bool
+	recommendations bool
+	limit           int // -1 for no limit
+}
+
+// all reports whether the request selected the full response
+func (f detailsFields) all() bool {
+	return f.product && f.recommendations && f.limit < 0
+}
+
+func parseDetailsFields(r *http.Request) (detailsFields, error) {
+	q := r.URL.Query()
+	f := detailsFields{product: true, recommendations: true, limit: -1}
+
+	if list := q["fields"]; len(list) > 0 {
+		f.product, f.recommendations = false, false
+		for _, v := range list {
+			for _, item := range strings.Split(v, ",") {
+				switch strings.TrimSpace(item) {
+				case "product":
+					f.product = true
+				case "recommendations":
+					f.recommendations = true
+				case "":
+				default:
+					return f, fmt.Errorf("unknown field %q, want product or recommendations: %w", item, apperrors.ErrValidation)
+				}
+			}
+		}
+		if !f.product && !f.recommendations {
+			return f, fmt.Errorf("fields selects nothing, want product and/or recommendations: %w", apperrors.ErrValidation)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("limit must be a non-negative integer: %w", apperrors.ErrValidation)
+		}
+		f.limit = n
+	}
+	return f, nil
+}
+
+// recommendationsSkipped reports whether the request left recommendations
+// out, so composeProductDetails needn't fetch them. A malformed selection is
+// rejected by the handler before composing.
+func recommendationsSkipped(r *http.Request) bool {
+	f, err := parseDetailsFields(r)
+	return err == nil && !f.recommendations
+}
+
+// cacheKey keys Last-Modified tracking, which is per representation
+func (f detailsFields) cacheKey(id string) string {
+	if f.all() {
+		return id
+	}
+	return fmt.Sprintf("%s?product=%t&recommendations=%t&limit=%d", id, f.product, f.recommendations, f.limit)
+}
+
+// trim applies ?limit= to the composed response
+func (f detailsFields) trim(d *ProductDetails) {
+	if f.limit >= 0 && len(d.Recommendations) > f.limit {
+		d.Recommendations = d.Recommendations[:f.limit]
+	}
+}
+
+// PartialDetails is ProductDetails with unselected sections left out
+type PartialDetails struct {
+	XMLName              xml.Name      `json:"-" xml:"product_details"`
+	Product              *Product      `json:"product,omitempty" xml:"product,omitempty"`
+	Recommendations      *[]Product    `json:"recommendations,omitempty" xml:"recommendations>product,omitempty"`
+	Timestamp            string        `json:"timestamp" xml:"timestamp"`
+	Meta                 *ResponseMeta `json:"meta,omitempty" xml:"meta,omitempty"`
+	DegradedMode         bool          `json:"degraded_mode" xml:"degraded_mode"`
+	RecommendationsTotal int           `json:"recommendations_total" xml:"recommendations_total"`
+	BundleComponents     []BundleItem  `json:"bundle_components,omitempty" xml:"bundle_components>component,omitempty"`
+}
+
+// shape returns what to encode: d itself unless sections were left out
+func (f detailsFields) shape(d *ProductDetails) interface{} {
+	if f.product && f.recommendations {
+		return d
+	}
+	p := &PartialDetails{
+		Timestamp:            d.Timestamp,
+		Meta:                 d.Meta,
+		DegradedMode:         d.DegradedMode,
+		RecommendationsTotal: d.RecommendationsTotal,
+		BundleComponents:     d.BundleComponents,
+	}
+	if f.product {
+		p.Product = &d.Product
+	}
+	if f.recommendations {
+		p.Recommendations = &d.Recommendations
+	}
+	return p
+}
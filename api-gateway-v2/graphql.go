@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// GraphQL. /graphql serves the product graph so clients fetch exactly the
+// fields they need in one round trip:
+//
+//	type Query {
+//	  product(id: ID!): Product
+//	}
+//	type Product {
+//	  id: ID!  name: String!  price: Float!  description: String!  category: String
+//	  availability: Availability
+//	  components: [BundleComponent!]
+//	  recommendations(limit: Int): [Product!]!
+//	}
+//	type Availability { preorder_date: String  release_date: String  end_of_life: String  status: String! }
+//	type BundleComponent { product_id: ID!  quantity: Int!  product: Product }
+//
+// Field names are the REST JSON names. Queries come as GET ?query=
+// (&variables=, &operationName=) or POST {"query", "variables",
+// "operationName"}; mutations, subscriptions, fragments and introspection
+// are not supported.
+//
+// Fields are resolved lazily: recommendations and bundle component products
+// are fetched only when selected, through the same breakers, bulkheads,
+// budgets and per-request memo as /product-details, so a product selected
+// twice is fetched once. As on the REST path, recommendations that can't be
+// fetched (or are shed by brownout) are served empty and the response
+// carries "extensions": {"degraded_mode": true}; a product that can't be
+// fetched is null with an error whose extensions carry the mapped problem
+// type and status.
+//
+// Selections nest at most maxGraphQLDepth deep, and a query whose worst case
+// needs more than maxGraphQLCost upstream calls is rejected up front:
+// nested recommendations multiply, so ask for fewer with limit.
+
+const (
+	maxGraphQLDepth     = 6
+	maxGraphQLCost      = 200
+	maxGraphQLBodyBytes = 64 << 10
+
+	// Components assumed per bundle when costing a query
+	gqlComponentFanout = 10
+)
+
+// gqlFieldDef describes a field: its object type ("" for scalars) and
+// arguments by name and type
+type gqlFieldDef struct {
+	object string
+	args   map[string]string
+}
+
+var gqlSchema = map[string]map[string]gqlFieldDef{
+	"Query": {
+		"product": {object: "Product", args: map[string]string{"id": "ID!"}},
+	},
+	"Product": {
+		"id": {}, "name": {}, "price": {}, "description": {}, "category": {},
+		"availability":    {object: "Availability"},
+		"components":      {object: "BundleComponent"},
+		"recommendations": {object: "Product", args: map[string]string{"limit": "Int"}},
+	},
+	"Availability": {
+		"preorder_date": {}, "release_date": {}, "end_of_life": {}, "status": {},
+	},
+	"BundleComponent": {
+		"product_id": {}, "quantity": {},
+		"product": {object: "Product"},
+	},
+}
+
+type gqlLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type gqlError struct {
+	Message    string                 `json:"message"`
+	Locations  []gqlLocation          `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *gqlError) Error() string { return e.Message }
+
+func newGraphQLError(src string, pos int, msg string) *gqlError {
+	return &gqlError{Message: msg, Locations: []gqlLocation{location(src, pos)}}
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+type graphqlResponse struct {
+	Data       gqlObject              `json:"data,omitempty"`
+	Errors     []*gqlError            `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// gqlObject is a result object; it keeps the selection order, as the
+// GraphQL spec requires, where a map wouldn't
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(e.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		v, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (s *Server) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeGraphQLErrors(w, &gqlError{Message: "variables must be a JSON object"})
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodyBytes)).Decode(&req); err != nil {
+			writeGraphQLErrors(w, &gqlError{Message: "invalid JSON body: " + err.Error()})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeGraphQLErrors(w, &gqlError{Message: "query is required"})
+		return
+	}
+
+	op, err := parseGraphQL(req.Query, req.OperationName)
+	var syntaxErr *gqlError
+	if errors.As(err, &syntaxErr) {
+		writeGraphQLErrors(w, syntaxErr)
+		return
+	}
+	if op.kind != "query" {
+		writeGraphQLErrors(w, &gqlError{Message: "only queries are supported, not " + op.kind + "s"})
+		return
+	}
+	vars, errs := op.coerceVariables(req.Variables)
+	errs = append(errs, op.validate("Query", op.selections, 1)...)
+	if len(errs) > 0 {
+		writeGraphQLErrors(w, errs...)
+		return
+	}
+	if cost := op.cost("Query", op.selections, vars); cost > maxGraphQLCost {
+		writeGraphQLErrors(w, &gqlError{Message: fmt.Sprintf(
+			"Query may need %d upstream calls, more than the maximum of %d; lower recommendations limits or nesting.", cost, maxGraphQLCost)})
+		return
+	}
+
+	e := &gqlExec{s: s, r: r, ctx: withPropagatedHeaders(r.Context(), r.Header), op: op, vars: vars}
+	resp := graphqlResponse{Data: e.query(op.selections)}
+	resp.Errors = e.errors
+	if e.degraded {
+		resp.Extensions = map[string]interface{}{"degraded_mode": true}
+	}
+	jsonutil.Write(w, http.StatusOK, resp)
+}
+
+// writeGraphQLErrors rejects a request that can't be executed
+func writeGraphQLErrors(w http.ResponseWriter, errs ...*gqlError) {
+	jsonutil.Write(w, http.StatusBadRequest, graphqlResponse{Errors: errs})
+}
+
+// coerceVariables applies defaults and checks required variables are given
+func (op *gqlOperation) coerceVariables(given map[string]interface{}) (map[string]interface{}, []*gqlError) {
+	vars := map[string]interface{}{}
+	var errs []*gqlError
+	for name, def := range op.varDefs {
+		v, ok := given[name]
+		switch {
+		case ok && v != nil:
+			vars[name] = v
+		case def.hasDefault:
+			vars[name] = def.defaultVal
+		case strings.HasSuffix(def.typ, "!"):
+			errs = append(errs, &gqlError{Message: fmt.Sprintf("Variable \"$%s\" of required type \"%s\" was not provided.", name, def.typ)})
+		}
+	}
+	return vars, errs
+}
+
+// validate checks a selection set against the schema before anything is
+// fetched
+func (op *gqlOperation) validate(typ string, fields []*gqlField, depth int) []*gqlError {
+	var errs []*gqlError
+	fail := func(f *gqlField, format string, args ...interface{}) {
+		errs = append(errs, newGraphQLError(op.src, f.pos, fmt.Sprintf(format, args...)))
+	}
+	if depth > maxGraphQLDepth {
+		fail(fields[0], "Query is nested deeper than %d levels.", maxGraphQLDepth)
+		return errs
+	}
+	for _, f := range fields {
+		if f.name == "__typename" {
+			if len(f.args) > 0 || f.selections != nil {
+				fail(f, "Field \"__typename\" takes no arguments or selections.")
+			}
+			continue
+		}
+		def, ok := gqlSchema[typ][f.name]
+		if !ok {
+			fail(f, "Cannot query field \"%s\" on type \"%s\".", f.name, typ)
+			continue
+		}
+		for arg, v := range f.args {
+			argType, known := def.args[arg]
+			if !known {
+				fail(f, "Unknown argument \"%s\" on field \"%s.%s\".", arg, typ, f.name)
+				continue
+			}
+			if name, isVar := v.(gqlVariable); isVar {
+				varDef, declared := op.varDefs[string(name)]
+				if !declared {
+					fail(f, "Variable \"$%s\" is not defined.", name)
+				} else if strings.TrimSuffix(varDef.typ, "!") != strings.TrimSuffix(argType, "!") {
+					fail(f, "Variable \"$%s\" of type \"%s\" used in position expecting type \"%s\".", name, varDef.typ, argType)
+				}
+			}
+		}
+		for arg, argType := range def.args {
+			if _, given := f.args[arg]; !given && strings.HasSuffix(argType, "!") {
+				fail(f, "Field \"%s\" argument \"%s\" of type \"%s\" is required, but it was not provided.", f.name, arg, argType)
+			}
+		}
+		switch {
+		case def.object == "" && f.selections != nil:
+			fail(f, "Field \"%s\" must not have a selection since it is a scalar.", f.name)
+		case def.object != "" && f.selections == nil:
+			fail(f, "Field \"%s\" of type \"%s\" must have a selection of subfields.", f.name, def.object)
+		case def.object != "":
+			errs = append(errs, op.validate(def.object, f.selections, depth+1)...)
+		}
+	}
+	return errs
+}
+
+// cost is the worst-case number of upstream calls a validated selection
+// set makes
+func (op *gqlOperation) cost(typ string, fields []*gqlField, vars map[string]interface{}) int {
+	total := 0
+	for _, f := range fields {
+		switch typ + "." + f.name {
+		case "Query.product", "BundleComponent.product":
+			total += 1 + op.cost("Product", f.selections, vars)
+		case "Product.components":
+			total += gqlComponentFanout * op.cost("BundleComponent", f.selections, vars)
+		case "Product.recommendations":
+			fanout := maxRecommendations
+			v, ok := f.args["limit"]
+			if name, isVar := v.(gqlVariable); isVar {
+				v, ok = vars[string(name)]
+			}
+			if n, err := coerceInt(v); ok && err == nil && n >= 0 {
+				fanout = min(n, fanout)
+			}
+			total += 1 + fanout*op.cost("Product", f.selections, vars)
+		}
+		total = min(total, math.MaxInt32) // Deep nesting can't overflow
+	}
+	return total
+}
+
+// gqlExec runs one validated operation
+type gqlExec struct {
+	s    *Server
+	r    *http.Request
+	ctx  context.Context
+	op   *gqlOperation
+	vars map[string]interface{}
+
+	mu       sync.Mutex
+	errors   []*gqlError
+	degraded bool
+}
+
+func (e *gqlExec) fail(f *gqlField, path []interface{}, err error) {
+	ge := newGraphQLError(e.op.src, f.pos, err.Error())
+	ge.Path = path
+	var argErr *gqlArgError
+	if !errors.As(err, &argErr) {
+		m := lookupErrorMapping(err)
+		ge.Message = m.Title
+		ge.Extensions = map[string]interface{}{"type": m.ProblemType, "status": m.Status}
+	}
+	e.mu.Lock()
+	e.errors = append(e.errors, ge)
+	e.mu.Unlock()
+}
+
+// gqlArgError is an invalid argument value; it is reported as is rather
+// than through the upstream error mapping
+type gqlArgError struct{ msg string }
+
+func (e *gqlArgError) Error() string { return e.msg }
+
+// arg resolves an argument to its literal or variable value
+func (e *gqlExec) arg(f *gqlField, name string) (interface{}, bool) {
+	v, ok := f.args[name]
+	if name, isVar := v.(gqlVariable); isVar {
+		v, ok = e.vars[string(name)]
+	}
+	return v, ok && v != nil
+}
+
+func (e *gqlExec) query(fields []*gqlField) gqlObject {
+	var obj gqlObject
+	for _, f := range fields {
+		path := []interface{}{f.alias}
+		switch f.name {
+		case "__typename":
+			obj = append(obj, gqlEntry{f.alias, "Query"})
+		case "product":
+			v, _ := e.arg(f, "id")
+			id, err := coerceID(v)
+			if err != nil {
+				e.fail(f, path, err)
+				obj = append(obj, gqlEntry{f.alias, nil})
+				continue
+			}
+			obj = append(obj, gqlEntry{f.alias, e.productByID(f, id, path)})
+		}
+	}
+	return obj
+}
+
+// productByID fetches and resolves a product, or returns nil (null) after
+// recording the error
+func (e *gqlExec) productByID(f *gqlField, id string, path []interface{}) interface{} {
+	p, err := e.s.fetchProduct(e.ctx, id)
+	if err != nil {
+		e.fail(f, path, err)
+		return nil
+	}
+	return e.product(p, f.selections, path)
+}
+
+func (e *gqlExec) product(p *Product, fields []*gqlField, path []interface{}) gqlObject {
+	obj := make(gqlObject, len(fields))
+	for i, f := range fields {
+		fieldPath := append(path[:len(path):len(path)], f.alias)
+		var v interface{}
+		switch f.name {
+		case "__typename":
+			v = "Product"
+		case "id":
+			v = p.ID
+		case "name":
+			v = p.Name
+		case "price":
+			v = p.Price
+		case "description":
+			v = p.Description
+		case "category":
+			if p.Category != "" {
+				v = p.Category
+			}
+		case "availability":
+			if p.Availability != nil {
+				v = availabilityObject(p.Availability, f.selections)
+			}
+		case "components":
+			if p.Components != nil {
+				v = e.list(len(p.Components), func(j int) interface{} {
+					return e.component(p.Components[j], f.selections, append(fieldPath[:len(fieldPath):len(fieldPath)], j))
+				})
+			}
+		case "recommendations":
+			recs, err := e.recommendations(f, p.ID)
+			if err != nil {
+				e.fail(f, fieldPath, err)
+			}
+			v = e.list(len(recs), func(j int) interface{} {
+				return e.product(&recs[j], f.selections, append(fieldPath[:len(fieldPath):len(fieldPath)], j))
+			})
+		}
+		obj[i] = gqlEntry{f.alias, v}
+	}
+	return obj
+}
+
+func availabilityObject(a *models.Availability, fields []*gqlField) gqlObject {
+	optional := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	obj := make(gqlObject, len(fields))
+	for i, f := range fields {
+		var v interface{}
+		switch f.name {
+		case "__typename":
+			v = "Availability"
+		case "preorder_date":
+			v = optional(a.PreorderDate)
+		case "release_date":
+			v = optional(a.ReleaseDate)
+		case "end_of_life":
+			v = optional(a.EndOfLife)
+		case "status":
+			v = a.Status
+		}
+		obj[i] = gqlEntry{f.alias, v}
+	}
+	return obj
+}
+
+func (e *gqlExec) component(c models.BundleComponent, fields []*gqlField, path []interface{}) gqlObject {
+	obj := make(gqlObject, len(fields))
+	for i, f := range fields {
+		var v interface{}
+		switch f.name {
+		case "__typename":
+			v = "BundleComponent"
+		case "product_id":
+			v = c.ProductID
+		case "quantity":
+			v = c.Quantity
+		case "product":
+			v = e.productByID(f, c.ProductID, append(path[:len(path):len(path)], f.alias))
+		}
+		obj[i] = gqlEntry{f.alias, v}
+	}
+	return obj
+}
+
+// list resolves n items concurrently, keeping their order
+func (e *gqlExec) list(n int, item func(i int) interface{}) []interface{} {
+	out := make([]interface{}, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out[i] = item(i)
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// recommendations fetches a product's recommendations as /product-details
+// does, falling back to an empty list. Only an invalid limit is an error.
+func (e *gqlExec) recommendations(f *gqlField, id string) ([]Product, error) {
+	limit := -1
+	if v, ok := e.arg(f, "limit"); ok {
+		n, err := coerceInt(v)
+		if err != nil || n < 0 {
+			return nil, &gqlArgError{"Argument \"limit\" must be a non-negative Int."}
+		}
+		limit = n
+	}
+
+	set := e.s.Recommendations.Active()
+	if e.s.brownout.current() >= 2 {
+		e.degrade(fallbackTierBrownout)
+		e.s.DegradedLog.Record(newDegradedEvent(e.r, id, fallbackTierBrownout, set.Breaker.GetState(), nil))
+		return nil, nil
+	}
+	recs, err := e.s.fetchRecommendations(e.ctx, set, id)
+	if err != nil {
+		e.s.log(e.ctx).Warn("Recommendations unavailable, serving fallback", "product_id", id,
+			"circuit", set.Breaker.GetState(), "set", set.Name, "error", err)
+		e.degrade(fallbackTierEmpty)
+		e.s.DegradedLog.Record(newDegradedEvent(e.r, id, fallbackTierEmpty, set.Breaker.GetState(), err))
+		return nil, nil
+	}
+	products := recs.products
+	if limit >= 0 && len(products) > limit {
+		products = products[:limit]
+	}
+	e.s.recStats.impression(models.DefaultStrategy, len(products))
+	return products, nil
+}
+
+func (e *gqlExec) degrade(tier string) {
+	e.s.metrics.degraded.inc("fallback_tier", tier)
+	e.mu.Lock()
+	e.degraded = true
+	e.mu.Unlock()
+}
+
+// coerceID accepts a string or an integer, from a literal or JSON variables
+func coerceID(v interface{}) (string, error) {
+	switch id := v.(type) {
+	case string:
+		if id != "" {
+			return id, nil
+		}
+	case int64:
+		return strconv.FormatInt(id, 10), nil
+	case float64:
+		if id == math.Trunc(id) && math.Abs(id) < 1<<53 {
+			return strconv.FormatInt(int64(id), 10), nil
+		}
+	}
+	return "", &gqlArgError{"Argument \"id\" must be a non-empty ID."}
+}
+
+// coerceInt accepts an integer literal or an integral JSON number
+func coerceInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int64:
+		if n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int(n), nil
+		}
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int(n), nil
+		}
+	}
+	return 0, errors.New("not an Int")
+}
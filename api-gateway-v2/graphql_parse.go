@@ -0,0 +1,493 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A GraphQL query parser, just enough for /graphql (see graphql.go):
+// operations, variables with defaults, aliases, arguments and nested
+// selection sets. Fragments, directives and block strings are rejected
+// with an error rather than misread.
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind gqlTokenKind
+	text string // Decoded value for strings
+	pos  int    // Byte offset in the source
+}
+
+// gqlVariable is a $name reference in an argument value
+type gqlVariable string
+
+// gqlEnum is a bare name used as a value
+type gqlEnum string
+
+type gqlField struct {
+	alias      string // Response key; the field name unless aliased
+	name       string
+	args       map[string]interface{} // Literal values, gqlVariable or gqlEnum
+	selections []*gqlField
+	pos        int
+}
+
+type gqlVarDef struct {
+	typ        string // As written, e.g. "ID!"
+	defaultVal interface{}
+	hasDefault bool
+}
+
+type gqlOperation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	varDefs    map[string]gqlVarDef
+	selections []*gqlField
+	src        string
+}
+
+// location converts a byte offset into the 1-based line and column
+// GraphQL errors report
+func location(src string, pos int) gqlLocation {
+	pos = min(pos, len(src))
+	line := strings.Count(src[:pos], "\n") + 1
+	col := utf8.RuneCountInString(src[strings.LastIndexByte(src[:pos], '\n')+1:pos]) + 1
+	return gqlLocation{Line: line, Column: col}
+}
+
+func lexGraphQL(src string) ([]gqlToken, error) {
+	var toks []gqlToken
+	i := 0
+	fail := func(pos int, format string, args ...interface{}) ([]gqlToken, error) {
+		return nil, newGraphQLError(src, pos, "Syntax Error: "+fmt.Sprintf(format, args...))
+	}
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+			toks = append(toks, gqlToken{gqlPunct, string(c), i})
+			i++
+		case c == '.':
+			if !strings.HasPrefix(src[i:], "...") {
+				return fail(i, "unexpected %q", c)
+			}
+			toks = append(toks, gqlToken{gqlPunct, "...", i})
+			i += 3
+		case c == '_' || isLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			toks = append(toks, gqlToken{gqlName, src[start:i], start})
+		case c == '-' || isDigit(c):
+			start := i
+			i++
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			kind := gqlInt
+			if i < len(src) && src[i] == '.' {
+				kind = gqlFloat
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				kind = gqlFloat
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			toks = append(toks, gqlToken{kind, src[start:i], start})
+		case c == '"':
+			if strings.HasPrefix(src[i:], `"""`) {
+				return fail(i, "block strings are not supported")
+			}
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(src) || src[i] == '\n' {
+					return fail(start, "unterminated string")
+				}
+				if src[i] == '"' {
+					i++
+					break
+				}
+				if src[i] != '\\' {
+					sb.WriteByte(src[i])
+					i++
+					continue
+				}
+				if i+1 >= len(src) {
+					return fail(start, "unterminated string")
+				}
+				esc := src[i+1]
+				i += 2
+				switch esc {
+				case '"', '\\', '/':
+					sb.WriteByte(esc)
+				case 'b':
+					sb.WriteByte('\b')
+				case 'f':
+					sb.WriteByte('\f')
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r':
+					sb.WriteByte('\r')
+				case 't':
+					sb.WriteByte('\t')
+				case 'u':
+					if i+4 > len(src) {
+						return fail(i, "invalid unicode escape")
+					}
+					r, err := strconv.ParseUint(src[i:i+4], 16, 32)
+					if err != nil {
+						return fail(i, "invalid unicode escape")
+					}
+					sb.WriteRune(rune(r))
+					i += 4
+				default:
+					return fail(i-2, "invalid escape \\%c", esc)
+				}
+			}
+			toks = append(toks, gqlToken{gqlString, sb.String(), start})
+		default:
+			return fail(i, "unexpected %q", c)
+		}
+	}
+	return append(toks, gqlToken{gqlEOF, "", len(src)}), nil
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+type gqlParser struct {
+	src  string
+	toks []gqlToken
+	i    int
+}
+
+func (p *gqlParser) peek() gqlToken { return p.toks[p.i] }
+
+func (p *gqlParser) next() gqlToken {
+	t := p.toks[p.i]
+	if t.kind != gqlEOF {
+		p.i++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuator s
+func (p *gqlParser) is(s string) bool {
+	t := p.peek()
+	return t.kind == gqlPunct && t.text == s
+}
+
+func (p *gqlParser) errorf(t gqlToken, format string, args ...interface{}) error {
+	return newGraphQLError(p.src, t.pos, "Syntax Error: "+fmt.Sprintf(format, args...))
+}
+
+func (p *gqlParser) expect(s string) error {
+	if t := p.next(); t.kind != gqlPunct || t.text != s {
+		return p.errorf(t, "expected %q, found %s", s, describe(t))
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	t := p.next()
+	if t.kind != gqlName {
+		return "", p.errorf(t, "expected a name, found %s", describe(t))
+	}
+	return t.text, nil
+}
+
+func describe(t gqlToken) string {
+	if t.kind == gqlEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+// parseGraphQL parses a document and returns the operation to run:
+// operationName's, or the only one
+func parseGraphQL(src, operationName string) (*gqlOperation, error) {
+	toks, err := lexGraphQL(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{src: src, toks: toks}
+
+	var ops []*gqlOperation
+	for p.peek().kind != gqlEOF {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	switch {
+	case len(ops) == 0:
+		return nil, newGraphQLError(src, 0, "Syntax Error: the document has no operations")
+	case operationName != "":
+		for _, op := range ops {
+			if op.name == operationName {
+				return op, nil
+			}
+		}
+		return nil, newGraphQLError(src, 0, fmt.Sprintf("Unknown operation named %q.", operationName))
+	case len(ops) > 1:
+		return nil, newGraphQLError(src, 0, "Must provide operation name if query contains multiple operations.")
+	}
+	return ops[0], nil
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{kind: "query", varDefs: map[string]gqlVarDef{}, src: p.src}
+	if p.is("{") {
+		sels, err := p.selectionSet()
+		op.selections = sels
+		return op, err
+	}
+
+	t := p.next()
+	switch {
+	case t.kind == gqlName && t.text == "fragment":
+		return nil, p.errorf(t, "fragments are not supported")
+	case t.kind != gqlName || (t.text != "query" && t.text != "mutation" && t.text != "subscription"):
+		return nil, p.errorf(t, "expected an operation, found %s", describe(t))
+	}
+	op.kind = t.text
+	if p.peek().kind == gqlName {
+		op.name = p.next().text
+	}
+	if p.is("(") {
+		if err := p.variableDefinitions(op); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("@") {
+		return nil, p.errorf(p.peek(), "directives are not supported")
+	}
+	sels, err := p.selectionSet()
+	op.selections = sels
+	return op, err
+}
+
+func (p *gqlParser) variableDefinitions(op *gqlOperation) error {
+	p.next() // (
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		start := p.peek()
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if _, dup := op.varDefs[name]; dup {
+			return newGraphQLError(p.src, start.pos, fmt.Sprintf("There can be only one variable named \"$%s\".", name))
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		var def gqlVarDef
+		if def.typ, err = p.typeRef(); err != nil {
+			return err
+		}
+		if p.is("=") {
+			p.next()
+			if def.defaultVal, err = p.value(true); err != nil {
+				return err
+			}
+			def.hasDefault = true
+		}
+		op.varDefs[name] = def
+	}
+	p.next() // )
+	return nil
+}
+
+// typeRef reads a type such as ID!, [Int] or [ID!]!
+func (p *gqlParser) typeRef() (string, error) {
+	var typ string
+	if p.is("[") {
+		p.next()
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.is("!") {
+		p.next()
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []*gqlField
+	for !p.is("}") {
+		if p.is("...") {
+			return nil, p.errorf(p.peek(), "fragments are not supported")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next() // }
+	if len(fields) == 0 {
+		return nil, p.errorf(p.toks[p.i-1], "empty selection set")
+	}
+	return fields, nil
+}
+
+func (p *gqlParser) field() (*gqlField, error) {
+	start := p.peek()
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &gqlField{alias: name, name: name, pos: start.pos}
+	if p.is(":") {
+		p.next()
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("(") {
+		p.next()
+		f.args = map[string]interface{}{}
+		for !p.is(")") {
+			argName, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if f.args[argName], err = p.value(false); err != nil {
+				return nil, err
+			}
+		}
+		p.next() // )
+	}
+	if p.is("@") {
+		return nil, p.errorf(p.peek(), "directives are not supported")
+	}
+	if p.is("{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// value reads an argument or default value; constant forbids variables
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case gqlString:
+		return t.text, nil
+	case gqlInt:
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid integer %s", t.text)
+		}
+		return n, nil
+	case gqlFloat:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %s", t.text)
+		}
+		return f, nil
+	case gqlName:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return gqlEnum(t.text), nil
+	case gqlPunct:
+		switch t.text {
+		case "$":
+			if constant {
+				return nil, p.errorf(t, "variables are not allowed here")
+			}
+			name, err := p.name()
+			return gqlVariable(name), err
+		case "[":
+			list := []interface{}{}
+			for !p.is("]") {
+				if p.peek().kind == gqlEOF {
+					return nil, p.errorf(p.peek(), "unterminated list")
+				}
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			obj := map[string]interface{}{}
+			for !p.is("}") {
+				key, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if obj[key], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			return obj, nil
+		}
+	}
+	return nil, p.errorf(t, "expected a value, found %s", describe(t))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Route hooks let integrations adjust a route's behaviour without editing
+// the core handlers. A hook implements RequestHook, ResponseHook, or both,
+// and is registered for a route pattern (as passed to http.HandleFunc)
+// during startup.
+
+// RequestHook runs before the handler composes its response. It may modify
+// the incoming request, e.g. to inject or normalise headers.
+type RequestHook interface {
+	OnRequest(r *http.Request)
+}
+
+// ResponseHook runs after composition, before encoding. body is the value
+// about to be written (e.g. *ProductDetails) and may be modified in place.
+// Streaming routes call it once with a nil body before the headers are
+// sent, then once per item.
+type ResponseHook interface {
+	OnResponse(r *http.Request, header http.Header, body interface{})
+}
+
+var routeHooks = struct {
+	mu    sync.RWMutex
+	hooks map[string][]interface{}
+}{hooks: map[string][]interface{}{}}
+
+// RegisterHook attaches hook to route. Hooks run in registration order.
+func RegisterHook(route string, hook interface{}) {
+	_, isReq := hook.(RequestHook)
+	_, isResp := hook.(ResponseHook)
+	if !isReq && !isResp {
+		slog.Error("Hook implements neither RequestHook nor ResponseHook", "hook", fmt.Sprintf("%T", hook), "route", route)
+		os.Exit(1)
+	}
+
+	routeHooks.mu.Lock()
+	defer routeHooks.mu.Unlock()
+	routeHooks.hooks[route] = append(routeHooks.hooks[route], hook)
+}
+
+func runRequestHooks(route string, r *http.Request) {
+	routeHooks.mu.RLock()
+	defer routeHooks.mu.RUnlock()
+	for _, h := range routeHooks.hooks[route] {
+		if rh, ok := h.(RequestHook); ok {
+			rh.OnRequest(r)
+		}
+	}
+}
+
+func runResponseHooks(route string, r *http.Request, header http.Header, body interface{}) {
+	routeHooks.mu.RLock()
+	defer routeHooks.mu.RUnlock()
+	for _, h := range routeHooks.hooks[route] {
+		if rh, ok := h.(ResponseHook); ok {
+			rh.OnResponse(r, header, body)
+		}
+	}
+}
+
+// HeaderInjectionHook adds fixed headers to every response on a route
+type HeaderInjectionHook struct {
+	Headers map[string]string
+}
+
+func (h HeaderInjectionHook) OnResponse(r *http.Request, header http.Header, body interface{}) {
+	for k, v := range h.Headers {
+		header.Set(k, v)
+	}
+}
+
+// DescriptionRedactionHook blanks product descriptions (the main product
+// and every recommendation), e.g. for partners not licensed to show copy
+type DescriptionRedactionHook struct{}
+
+func (DescriptionRedactionHook) OnResponse(r *http.Request, header http.Header, body interface{}) {
+	details, ok := body.(*ProductDetails)
+	if !ok {
+		return
+	}
+	details.Product.Description = ""
+	for i := range details.Recommendations {
+		details.Recommendations[i].Description = ""
+	}
+}
+
+// registerHooksFromEnv wires the built-in hooks:
+//
+//	HOOK_RESPONSE_HEADERS="X-Partner=acme,X-Env=demo"  header injection on all product routes
+//	HOOK_REDACT_DESCRIPTIONS=true                     redact descriptions on /product-details/
+func registerHooksFromEnv() {
+	productRoutes := []string{"/product-details/", "/product-details/stream", "/product-details/batch", "/product-page/"}
+
+	if spec := settings.Value("HOOK_RESPONSE_HEADERS"); spec != "" {
+		headers := map[string]string{}
+		for _, pair := range strings.Split(spec, ",") {
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				slog.Warn("Ignoring malformed HOOK_RESPONSE_HEADERS entry", "entry", pair)
+				continue
+			}
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		for _, route := range productRoutes {
+			RegisterHook(route, HeaderInjectionHook{Headers: headers})
+		}
+	}
+
+	if settings.Value("HOOK_REDACT_DESCRIPTIONS") == "true" {
+		RegisterHook("/product-details/", DescriptionRedactionHook{})
+	}
+}
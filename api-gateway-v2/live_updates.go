@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+)
+
+// Live product updates. GET /ws proxies the WebSocket upgrade to
+// product-service's /ws (product-service/live.go), so clients of the
+// gateway get the same push stream of price and availability changes,
+// with the query (ids, version) and X-Product-Version passed through.
+//
+// The proxy only carries bytes once the upgrade succeeds: the socket isn't
+// subject to the client timeout, and its lifetime isn't a call outcome for
+// the product breaker or the brownout load. An open product breaker does
+// refuse new sockets, and a failed upgrade is mapped like any other
+// product-service error.
+
+// newProductUpdatesProxyFromEnv returns the /ws proxy to
+// PRODUCT_SERVICE_URL. transport is the upstream transport, nil for the
+// default.
+func newProductUpdatesProxyFromEnv(transport http.RoundTripper) http.Handler {
+	target, err := url.Parse(settings.Value("PRODUCT_SERVICE_URL"))
+	if err != nil {
+		slog.Error("Error parsing PRODUCT_SERVICE_URL", "error", err)
+		os.Exit(1)
+	}
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + "/ws"
+			pr.Out.URL.RawPath = ""
+			pr.SetXForwarded()
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeUpstreamError(w, &UpstreamError{Upstream: productUpstream, Err: err})
+		},
+	}
+}
+
+func (s *Server) productUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Breakers.Get(productUpstream).State() == circuitbreaker.StateOpen {
+		writeUpstreamError(w, &UpstreamError{Upstream: productUpstream, Err: apperrors.ErrCircuitOpen})
+		return
+	}
+	httpserver.LongLived(r.Context())
+	s.ProductUpdates.ServeHTTP(w, r)
+}
+
+// isUpgrade reports whether r asks to switch protocols
+func isUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != ""
+}
@@ -1,27 +1,45 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
-	"sync"
 	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
 )
 
-type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	Description string  `json:"description"`
-}
+// Product is the catalog model shared by all services
+type Product = models.Product
 
 type ProductDetails struct {
-	Product         Product   `json:"product"`
-	Recommendations []Product `json:"recommendations"`
-	Timestamp       string    `json:"timestamp"`
-	DegradedMode    bool      `json:"degraded_mode"`
+	XMLName         xml.Name  `json:"-" xml:"product_details"`
+	Product         Product   `json:"product" xml:"product"`
+	Recommendations []Product `json:"recommendations" xml:"recommendations>product"`
+	Timestamp       string    `json:"timestamp" xml:"timestamp"`
+
+	// How the response was produced (see meta.go); nil when RESPONSE_META=off
+	Meta *ResponseMeta `json:"meta,omitempty" xml:"meta,omitempty"`
+
+	// Deprecated: use Meta.DegradationLevel. Still sent for existing clients.
+	DegradedMode bool `json:"degraded_mode" xml:"degraded_mode"`
+
+	// Recommendations available upstream before the MAX_RECOMMENDATIONS cap
+	RecommendationsTotal int `json:"recommendations_total" xml:"recommendations_total"`
+
+	// A bundle's components, only with ?expand=bundle (see bundle.go)
+	BundleComponents []BundleItem `json:"bundle_components,omitempty" xml:"bundle_components>component,omitempty"`
 }
 
 const (
@@ -29,174 +47,200 @@ const (
 	recommendationsServiceURL = "http://localhost:8082"
 )
 
-var httpClient = &http.Client{
-	Timeout: 5 * time.Second, // Shorter timeout for fail-fast (5s instead of 30s)
-}
-
-// Circuit Breaker States
-type State int
+// Breaker registry name of the product dependency
+const productUpstream = "product-service"
 
-const (
-	StateClosed State = iota
-	StateOpen
-	StateHalfOpen
-)
+// Timeout for upstream calls; short for fail-fast (5s instead of 30s)
+const upstreamTimeout = 5 * time.Second
 
-func (s State) String() string {
-	switch s {
-	case StateClosed:
-		return "CLOSED"
-	case StateOpen:
-		return "OPEN"
-	case StateHalfOpen:
-		return "HALF-OPEN"
-	default:
-		return "UNKNOWN"
-	}
-}
+// CircuitBreaker guards upstream calls (see internal/circuitbreaker)
+type CircuitBreaker = circuitbreaker.CircuitBreaker
 
-// CircuitBreaker implementation
-type CircuitBreaker struct {
-	mu              sync.Mutex
-	state           State
-	failureCount    int
-	successCount    int
-	lastFailureTime time.Time
-	
-	// Configuration
-	maxFailures     int
-	timeout         time.Duration
-	halfOpenTimeout time.Duration
+type recommendationsResult struct {
+	products []Product
+	total    int
 }
 
-func NewCircuitBreaker() *CircuitBreaker {
-	return &CircuitBreaker{
-		state:           StateClosed,
-		maxFailures:     3,            // Trip after 3 failures
-		timeout:         5 * time.Second,  // Stay open for 5 seconds
-		halfOpenTimeout: 3 * time.Second,  // Allow retry after 3 seconds
-	}
+func getFallbackRecommendations() []Product {
+	// Return empty list as fallback
+	return []Product{}
 }
 
-func (cb *CircuitBreaker) Execute(fn func() error) error {
-	cb.mu.Lock()
-	
-	// Check if we should transition from OPEN to HALF-OPEN
-	if cb.state == StateOpen {
-		if time.Since(cb.lastFailureTime) > cb.timeout {
-			log.Println("Circuit breaker transitioning to HALF-OPEN")
-			cb.state = StateHalfOpen
-			cb.successCount = 0
-		} else {
-			cb.mu.Unlock()
-			return fmt.Errorf("circuit breaker is OPEN")
+// fetchProduct gets a product from product service through its own breaker
+// (memoized per request). A 404 is a healthy answer, not a failure.
+func (s *Server) fetchProduct(ctx context.Context, id string) (*Product, error) {
+	productCtx, cancel := withBranchBudget(ctx, productBudget)
+	defer cancel()
+	return memoize(productCtx, "product:"+id, func() (*Product, error) {
+		if !s.admit(productUpstream) {
+			return nil, &UpstreamError{Upstream: productUpstream, Err: errAdmissionShed}
 		}
-	}
-	
-	currentState := cb.state
-	cb.mu.Unlock()
-	
-	// If OPEN, fail immediately (fail fast!)
-	if currentState == StateOpen {
-		return fmt.Errorf("circuit breaker is OPEN")
-	}
-	
-	// Try to execute the function
-	err := fn()
-	
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-	
-	if err != nil {
-		cb.recordFailure()
-		return err
-	}
-	
-	cb.recordSuccess()
-	return nil
-}
-
-func (cb *CircuitBreaker) recordFailure() {
-	cb.failureCount++
-	cb.lastFailureTime = time.Now()
-	
-	if cb.state == StateHalfOpen {
-		log.Println("Circuit breaker: Failure in HALF-OPEN, transitioning to OPEN")
-		cb.state = StateOpen
-		cb.failureCount = 0
-	} else if cb.failureCount >= cb.maxFailures {
-		log.Printf("Circuit breaker: Failure threshold reached (%d), transitioning to OPEN", cb.maxFailures)
-		cb.state = StateOpen
-		cb.failureCount = 0
-	}
-}
-
-func (cb *CircuitBreaker) recordSuccess() {
-	cb.failureCount = 0
-	
-	if cb.state == StateHalfOpen {
-		cb.successCount++
-		if cb.successCount >= 2 {
-			log.Println("Circuit breaker: Successes in HALF-OPEN, transitioning to CLOSED")
-			cb.state = StateClosed
-			cb.successCount = 0
+		if err := s.warmup.Wait(productCtx, productUpstream); err != nil {
+			return nil, &UpstreamError{Upstream: productUpstream, Err: err}
 		}
-	}
+		release, err := s.bulkheads.acquire(productCtx, productUpstream)
+		if err != nil {
+			return nil, &UpstreamError{Upstream: productUpstream, Err: err}
+		}
+		defer release()
+		var product *Product
+		var notFound error
+		err = s.callUpstream(productCtx, s.Breakers.Get(productUpstream), func() error {
+			start := time.Now()
+			p, err := s.Products.GetProduct(productCtx, id)
+			if errors.Is(err, apperrors.ErrNotFound) {
+				s.observe(productUpstream, start, nil)
+				notFound = err
+				return nil
+			}
+			err = excludeClientTimeout(productCtx, err)
+			s.observe(productUpstream, start, err)
+			if err != nil {
+				return err
+			}
+			product = p
+			return nil
+		})
+		if errors.Is(err, apperrors.ErrCircuitOpen) {
+			err = &UpstreamError{Upstream: productUpstream, Err: err}
+		}
+		if err == nil {
+			err = notFound
+		}
+		return product, err
+	})
 }
 
-func (cb *CircuitBreaker) GetState() string {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-	return cb.state.String()
+// fetchRecommendations gets a product's recommendations from set through
+// its breaker, bulkhead and warmup limiter, within the recommendations
+// branch budget. Results are memoized per request.
+func (s *Server) fetchRecommendations(ctx context.Context, set *UpstreamSet, id string) (recommendationsResult, error) {
+	recsCtx, cancel := withBranchBudget(ctx, recommendationsBudget)
+	defer cancel()
+	upstream := s.Recommendations.Name + "/" + set.Name
+	return memoize(recsCtx, "recommendations:"+set.Name+":"+id, func() (recommendationsResult, error) {
+		var res recommendationsResult
+		if !s.admit(upstream) {
+			return res, errAdmissionShed
+		}
+		if err := s.warmup.Wait(recsCtx, upstream); err != nil {
+			return res, err
+		}
+		release, err := s.bulkheads.acquire(recsCtx, upstream)
+		if err != nil {
+			return res, err
+		}
+		defer release()
+		err = s.callUpstream(recsCtx, set.Breaker, func() error {
+			start := time.Now()
+			recs, n, err := set.Client.GetRecommendations(recsCtx, id)
+			err = excludeClientTimeout(recsCtx, err)
+			s.observe(upstream, start, err)
+			if err != nil {
+				return err
+			}
+			res = recommendationsResult{recs, n}
+			return nil
+		})
+		return res, err
+	})
 }
 
-// Global circuit breaker for recommendations service
-var recommendationsCircuitBreaker = NewCircuitBreaker()
+// composeProductDetails fetches the product and its recommendations. Only a
+// product failure is returned as an error; recommendation failures degrade
+// the response instead.
+func (s *Server) composeProductDetails(r *http.Request, id string) (*ProductDetails, error) {
+	// Only allowlisted client headers travel with the upstream calls
+	ctx := withPropagatedHeaders(r.Context(), r.Header)
+	meta := newResponseMeta(r)
 
-func getProductDetails(productID string) (*Product, error) {
-	resp, err := httpClient.Get(fmt.Sprintf("%s/product/%s", productServiceURL, productID))
+	// Get product details from product service
+	productStart := time.Now()
+	product, err := s.fetchProduct(ctx, id)
+	meta.observe(productUpstream, productStart)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("product service returned status %d", resp.StatusCode)
+	level := s.brownout.current()
+	meta.setBrownout(level)
+	var components []BundleItem
+	if len(product.Components) > 0 && expandRequested(r, "bundle") {
+		if level >= 1 {
+			meta.degrade(fallbackTierBrownout)
+		} else if components, err = s.expandBundle(ctx, product); err != nil {
+			return nil, err
+		}
 	}
 
-	var product Product
-	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
-		return nil, err
+	if recommendationsSkipped(r) {
+		return &ProductDetails{
+			Product:          *product,
+			Timestamp:        time.Now().Format(time.RFC3339),
+			Meta:             meta,
+			BundleComponents: components,
+		}, nil
 	}
 
-	return &product, nil
-}
+	// Get recommendations through circuit breaker
+	var recommendations []Product
+	total := 0
+	degradedMode := false
 
-func getRecommendations(productID string) ([]Product, error) {
-	resp, err := httpClient.Get(fmt.Sprintf("%s/recommendations/%s", recommendationsServiceURL, productID))
-	if err != nil {
-		return nil, err
+	if level >= 2 {
+		meta.degrade(fallbackTierBrownout)
+		s.metrics.degraded.inc("fallback_tier", fallbackTierBrownout)
+		s.DegradedLog.Record(newDegradedEvent(r, id, fallbackTierBrownout,
+			s.Recommendations.Active().Breaker.GetState(), nil))
+		return &ProductDetails{
+			Product:          *product,
+			Recommendations:  []Product{},
+			Timestamp:        time.Now().Format(time.RFC3339),
+			Meta:             meta,
+			DegradedMode:     true,
+			BundleComponents: components,
+		}, nil
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("recommendations service returned status %d", resp.StatusCode)
+	set := s.Recommendations.Active()
+	upstream := s.Recommendations.Name + "/" + set.Name
+	recsStart := time.Now()
+	recs, err := s.fetchRecommendations(ctx, set, id)
+	meta.observe(upstream, recsStart)
+	// The memoized outcome is shared, so callers get their own slice copy
+	// (response hooks may edit it)
+	if err == nil {
+		recommendations = slices.Clone(recs.products)
+		total = recs.total
+		s.recStats.impression(models.DefaultStrategy, len(recommendations))
 	}
 
-	var recommendations []Product
-	if err := json.NewDecoder(resp.Body).Decode(&recommendations); err != nil {
-		return nil, err
-	}
+	if err != nil {
+		// Circuit is OPEN or call failed - use fallback
+		s.log(r.Context()).Warn("Recommendations unavailable, serving fallback", "product_id", id,
+			"circuit", set.Breaker.GetState(), "set", set.Name, "error", err)
+		recommendations = getFallbackRecommendations()
+		degradedMode = true
+		meta.degrade(fallbackTierEmpty)
+		s.metrics.degraded.inc("fallback_tier", fallbackTierEmpty)
 
-	return recommendations, nil
-}
+		// Mirror what the user saw for offline analysis (async, never blocks)
+		s.DegradedLog.Record(newDegradedEvent(r, id, fallbackTierEmpty,
+			set.Breaker.GetState(), err))
+	}
 
-func getFallbackRecommendations() []Product {
-	// Return empty list as fallback
-	return []Product{}
+	// Build response - we ALWAYS succeed with graceful degradation
+	return &ProductDetails{
+		Product:              *product,
+		Recommendations:      recommendations,
+		Timestamp:            time.Now().Format(time.RFC3339),
+		Meta:                 meta,
+		DegradedMode:         degradedMode,
+		RecommendationsTotal: total,
+		BundleComponents:     components,
+	}, nil
 }
 
-func productDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) productDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 
 	// Extract ID from path
@@ -208,73 +252,91 @@ func productDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get product details from product service
-	product, err := getProductDetails(id)
+	fields, err := parseDetailsFields(r)
 	if err != nil {
-		log.Printf("Error getting product: %v", err)
-		http.Error(w, "Failed to get product details", http.StatusInternalServerError)
+		apperrors.Write(w, err)
 		return
 	}
 
-	// Get recommendations through circuit breaker
-	var recommendations []Product
-	degradedMode := false
-
-	// Wrap the recommendations call in circuit breaker
-	err = recommendationsCircuitBreaker.Execute(func() error {
-		recs, err := getRecommendations(id)
-		if err != nil {
-			return err
-		}
-		recommendations = recs
-		return nil
-	})
+	runRequestHooks("/product-details/", r)
 
+	response, err := s.composeProductDetails(r, id)
 	if err != nil {
-		// Circuit is OPEN or call failed - use fallback
-		log.Printf("Circuit breaker %s or recommendation call failed: %v", 
-			recommendationsCircuitBreaker.GetState(), err)
-		recommendations = getFallbackRecommendations()
-		degradedMode = true
+		s.log(r.Context()).Error("Error getting product", "product_id", id, "error", err)
+		writeUpstreamError(w, err)
+		return
 	}
+	fields.trim(response)
 
-	// Build response - we ALWAYS succeed with graceful degradation
-	response := ProductDetails{
-		Product:         *product,
-		Recommendations: recommendations,
-		Timestamp:       time.Now().Format(time.RFC3339),
-		DegradedMode:    degradedMode,
-	}
+	runResponseHooks("/product-details/", r, w.Header(), response)
 
 	duration := time.Since(startTime)
-	log.Printf("Request completed in %v (degraded: %v, circuit: %s)", 
-		duration, degradedMode, recommendationsCircuitBreaker.GetState())
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+	s.log(r.Context()).Info("Request completed", "product_id", id, "duration_ms", duration.Milliseconds(),
+		"degraded", response.DegradedMode, "circuit", s.Recommendations.Active().Breaker.GetState())
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	if writeConditional(w, r, fields.cacheKey(id), response) {
+		return
+	}
+	writeNegotiated(w, r, fields.shape(response))
 }
 
-func circuitStatusHandler(w http.ResponseWriter, r *http.Request) {
-	status := map[string]string{
-		"circuit_state": recommendationsCircuitBreaker.GetState(),
+// circuitStatusHandler reports every dependency's breaker under
+// "dependencies"; circuit_state is the active recommendations set's breaker,
+// kept for existing dashboards
+func (s *Server) circuitStatusHandler(w http.ResponseWriter, r *http.Request) {
+	failover := s.Recommendations.Status()
+	status := map[string]interface{}{
+		"circuit_state":          s.Recommendations.Active().Breaker.GetState(),
+		"recommendations_active": failover.Active,
+		"dependencies":           s.Breakers.States(),
+		"forced":                 s.Breakers.Forced(),
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	jsonutil.Write(w, http.StatusOK, status)
 }
 
 func main() {
-	http.HandleFunc("/product-details/", productDetailsHandler)
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/circuit-status", circuitStatusHandler)
-
-	log.Println("API Gateway (WITH CIRCUIT BREAKER) starting on :8080")
-	log.Println("✅ This version is resilient to recommendations service failures!")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
-	}
+	flag.Parse()
+	logging.Setup("api-gateway-v2")
+	config.RunSelfCheck(settings, dependencies())
+	settings.MustValidate()
+
+	loadRecommendationLimitsFromEnv()
+	loadSchemaPolicyFromEnv()
+	registerHooksFromEnv()
+	loadDebugCaptureFromEnv()
+	loadHeaderPropagationFromEnv()
+	loadErrorMappingsFromEnv()
+	loadClientTimeoutFromEnv()
+	loadBranchBudgetsFromEnv()
+	loadAdmissionControlFromEnv()
+	loadWarmupFromEnv()
+	loadBulkheadsFromEnv()
+	loadRateLimitFromEnv()
+	loadRetryPolicyFromEnv()
+	loadResponseMetaFromEnv()
+	loadBrownoutFromEnv()
+	loadUpstreamPinsFromEnv(map[string][]string{
+		productUpstream:           {settings.Value("PRODUCT_SERVICE_URL")},
+		"recommendations-service": nonEmpty(settings.Value("RECOMMENDATIONS_URL"), settings.Value("RECOMMENDATIONS_SECONDARY_URL")),
+	})
+
+	client := &http.Client{Timeout: upstreamTimeout, Transport: upstreamTransport}
+	breakers := circuitbreaker.NewRegistry(circuitbreaker.DefaultConfig())
+	degradedLog := NewDegradedLogFromEnv()
+	httpserver.OnShutdown(degradedLog.Close)
+	srv := NewServer(
+		NewHTTPProductClient(strings.TrimSuffix(settings.Value("PRODUCT_SERVICE_URL"), "/"), client),
+		newRecommendationsUpstreamFromEnv(client, breakers),
+		breakers,
+		degradedLog,
+		slog.Default(),
+	)
+	srv.BreakerNotifier = NewWebhookNotifierFromEnv()
+	srv.ProductUpdates = newProductUpdatesProxyFromEnv(upstreamTransport)
+	httpserver.OnShutdown(srv.BreakerNotifier.Close)
+
+	addr := settings.Value("LISTEN_ADDR")
+	slog.Info("API Gateway (WITH CIRCUIT BREAKER) starting", "addr", addr)
+	slog.Info("This version is resilient to recommendations service failures!")
+	httpserver.Run(addr, srv.Handler())
 }
\ No newline at end of file
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+)
+
+// newTestServer builds a Server on stub clients. The recommendations set
+// points nowhere; its Client is replaced by recs.
+func newTestServer(products ProductClient, recs RecommendationsClient) *Server {
+	breakers := circuitbreaker.NewRegistry(circuitbreaker.DefaultConfig())
+	upstream := NewFailoverUpstream("recommendations-service", "http://recommendations.invalid", "", http.DefaultClient, breakers)
+	upstream.Primary.Client = recs
+	return NewServer(products, upstream, breakers, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+var (
+	stubProduct = ProductClientFunc(func(ctx context.Context, id string) (*Product, error) {
+		return &Product{ID: id, Name: "Laptop", Price: 999.99, Category: "computers"}, nil
+	})
+	stubRecommendations = RecommendationsClientFunc(func(ctx context.Context, id string) ([]Product, int, error) {
+		return []Product{{ID: "2", Name: "Mouse", Price: 29.99}}, 1, nil
+	})
+)
+
+func getDetails(t *testing.T, s *Server, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/product-details/"+id, nil)
+	rec := httptest.NewRecorder()
+	s.productDetailsHandler(rec, req)
+	return rec
+}
+
+func TestProductDetailsHandler(t *testing.T) {
+	s := newTestServer(stubProduct, stubRecommendations)
+	rec := getDetails(t, s, "1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	var details ProductDetails
+	if err := json.Unmarshal(rec.Body.Bytes(), &details); err != nil {
+		t.Fatal(err)
+	}
+	if details.Product.ID != "1" || len(details.Recommendations) != 1 || details.DegradedMode {
+		t.Errorf("got %+v, want product 1 with one recommendation, not degraded", details)
+	}
+}
+
+func TestProductDetailsHandlerProductNotFound(t *testing.T) {
+	notFound := ProductClientFunc(func(ctx context.Context, id string) (*Product, error) {
+		return nil, &UpstreamError{Upstream: productUpstream, StatusCode: http.StatusNotFound}
+	})
+	rec := getDetails(t, newTestServer(notFound, stubRecommendations), "missing")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404; body %s", rec.Code, rec.Body)
+	}
+	assertProblemType(t, rec, "/problems/product-not-found")
+}
+
+func TestProductDetailsHandlerRecommendationsFailure(t *testing.T) {
+	failing := RecommendationsClientFunc(func(ctx context.Context, id string) ([]Product, int, error) {
+		return nil, 0, &UpstreamError{Upstream: "recommendations-service", StatusCode: http.StatusInternalServerError}
+	})
+	rec := getDetails(t, newTestServer(stubProduct, failing), "1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (degraded); body %s", rec.Code, rec.Body)
+	}
+	var details ProductDetails
+	if err := json.Unmarshal(rec.Body.Bytes(), &details); err != nil {
+		t.Fatal(err)
+	}
+	if !details.DegradedMode || details.Product.ID != "1" {
+		t.Errorf("got %+v, want product 1 in degraded mode", details)
+	}
+}
+
+func TestProductDetailsHandlerCircuitOpen(t *testing.T) {
+	t.Run("product", func(t *testing.T) {
+		called := false
+		products := ProductClientFunc(func(ctx context.Context, id string) (*Product, error) {
+			called = true
+			return stubProduct(ctx, id)
+		})
+		s := newTestServer(products, stubRecommendations)
+		s.Breakers.Get(productUpstream).Force(circuitbreaker.StateOpen)
+
+		rec := getDetails(t, s, "1")
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want 503; body %s", rec.Code, rec.Body)
+		}
+		assertProblemType(t, rec, "/problems/circuit-open")
+		if called {
+			t.Error("product client called with its breaker open")
+		}
+	})
+
+	t.Run("recommendations", func(t *testing.T) {
+		recs := RecommendationsClientFunc(func(ctx context.Context, id string) ([]Product, int, error) {
+			return nil, 0, errors.New("recommendations client called with its breaker open")
+		})
+		s := newTestServer(stubProduct, recs)
+		s.Recommendations.Primary.Breaker.Force(circuitbreaker.StateOpen)
+
+		rec := getDetails(t, s, "1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (degraded); body %s", rec.Code, rec.Body)
+		}
+		var details ProductDetails
+		if err := json.Unmarshal(rec.Body.Bytes(), &details); err != nil {
+			t.Fatal(err)
+		}
+		if !details.DegradedMode {
+			t.Error("want degraded_mode with the recommendations breaker open")
+		}
+	})
+}
+
+func assertProblemType(t *testing.T, rec *httptest.ResponseRecorder, want string) {
+	t.Helper()
+	var problem struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("body %q is not a problem document: %v", rec.Body, err)
+	}
+	if problem.Type != want {
+		t.Errorf("problem type = %q, want %q", problem.Type, want)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Request-scoped memoization of upstream lookups. Every request gets a memo
+// (see withLookupMemo); lookups made through memoize share one upstream
+// call per key for the rest of that request, including concurrent callers
+// such as batch items that name the same product twice.
+
+type memoKey struct{}
+
+type lookupMemo struct {
+	mu    sync.Mutex
+	calls map[string]*memoCall
+}
+
+type memoCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func withLookupMemo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		memo := &lookupMemo{calls: map[string]*memoCall{}}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), memoKey{}, memo)))
+	})
+}
+
+// memoize returns the result of the first fn call made for key during this
+// request. Without a memo in ctx it just calls fn.
+func memoize[T any](ctx context.Context, key string, fn func() (T, error)) (T, error) {
+	memo, ok := ctx.Value(memoKey{}).(*lookupMemo)
+	if !ok {
+		return fn()
+	}
+
+	memo.mu.Lock()
+	call, found := memo.calls[key]
+	if !found {
+		call = &memoCall{done: make(chan struct{})}
+		memo.calls[key] = call
+	}
+	memo.mu.Unlock()
+
+	if !found {
+		v, err := fn()
+		call.value, call.err = v, err
+		close(call.done)
+		return v, err
+	}
+
+	select {
+	case <-call.done:
+		v, _ := call.value.(T)
+		return v, call.err
+	case <-ctx.Done():
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Response annotations. Every composed response carries a "meta" block
+// telling clients how it was produced, so they can track degradation
+// without scraping logs. RESPONSE_META sets the verbosity:
+//
+//	off    no meta block
+//	basic  served_by, cache, degradation_level, fallback_tier, trace_id (default)
+//	full   basic plus per-upstream latencies
+//
+// degradation_level is "none" or "partial" (recommendations fell back);
+// a product failure is an error response, not a degraded one. The gateway
+// has no response cache, so cache is always "none" for now.
+var responseMeta = struct {
+	verbosity string
+	servedBy  string
+}{verbosity: "basic"}
+
+func loadResponseMetaFromEnv() {
+	switch v := settings.Value("RESPONSE_META"); v {
+	case "off", "basic", "full":
+		responseMeta.verbosity = v
+	}
+	if host, err := os.Hostname(); err == nil {
+		responseMeta.servedBy = host
+	}
+	slog.Info("Response meta", "verbosity", responseMeta.verbosity)
+}
+
+const (
+	degradationNone    = "none"
+	degradationPartial = "partial"
+)
+
+type ResponseMeta struct {
+	ServedBy         string            `json:"served_by" xml:"served_by"`
+	Cache            string            `json:"cache" xml:"cache"`
+	DegradationLevel string            `json:"degradation_level" xml:"degradation_level"`
+	FallbackTier     string            `json:"fallback_tier,omitempty" xml:"fallback_tier,omitempty"`
+	TraceID          string            `json:"trace_id,omitempty" xml:"trace_id,omitempty"`
+	UpstreamLatency  []UpstreamLatency `json:"upstream_latencies,omitempty" xml:"upstream_latencies>upstream,omitempty"`
+	BrownoutLevel    *int              `json:"brownout_level,omitempty" xml:"brownout_level,omitempty"` // nil unless BROWNOUT=true
+}
+
+// UpstreamLatency is the time one branch spent waiting on its dependency,
+// including retries and a memoized call shared with another branch
+type UpstreamLatency struct {
+	Upstream string  `json:"upstream" xml:"name,attr"`
+	Ms       float64 `json:"ms" xml:",chardata"`
+}
+
+// newResponseMeta returns nil when RESPONSE_META=off
+func newResponseMeta(r *http.Request) *ResponseMeta {
+	if responseMeta.verbosity == "off" {
+		return nil
+	}
+	m := &ResponseMeta{
+		ServedBy:         responseMeta.servedBy,
+		Cache:            "none",
+		DegradationLevel: degradationNone,
+		TraceID:          traceID(r.Header),
+	}
+	if brownout.enabled {
+		m.BrownoutLevel = new(int)
+	}
+	return m
+}
+
+func (m *ResponseMeta) degrade(tier string) {
+	if m == nil {
+		return
+	}
+	m.DegradationLevel = degradationPartial
+	m.FallbackTier = tier
+}
+
+func (m *ResponseMeta) setBrownout(level int) {
+	if m == nil || m.BrownoutLevel == nil {
+		return
+	}
+	*m.BrownoutLevel = level
+}
+
+func (m *ResponseMeta) observe(upstream string, since time.Time) {
+	if m == nil || responseMeta.verbosity != "full" {
+		return
+	}
+	ms := float64(time.Since(since).Microseconds()) / 1000
+	m.UpstreamLatency = append(m.UpstreamLatency, UpstreamLatency{Upstream: upstream, Ms: ms})
+}
+
+// traceID takes the trace-id of a W3C traceparent, falling back to
+// X-Request-Id
+func traceID(h http.Header) string {
+	if parts := strings.Split(h.Get("Traceparent"), "-"); len(parts) == 4 && len(parts[1]) == 32 {
+		return parts[1]
+	}
+	return h.Get("X-Request-Id")
+}
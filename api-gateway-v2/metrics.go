@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+)
+
+// Prometheus metrics on /metrics, in the text exposition format (written
+// by hand; the repo has no client library dependency):
+//
+//	gateway_requests_total{route,code}
+//	gateway_request_duration_seconds{route}             histogram
+//	gateway_upstream_call_duration_seconds{upstream,outcome}  histogram
+//	gateway_circuit_breaker_state{breaker}              0 closed, 1 open, 2 half-open
+//	gateway_circuit_breaker_transitions_total{breaker,from,to}
+//	gateway_degraded_responses_total{fallback_tier}
+//	gateway_rate_limited_total{route,scope}             scope: client, global or concurrency
+//	gateway_upstream_pin_failures_total{upstream}       see pinning.go
+//	gateway_bulkhead_in_flight{upstream}
+//	gateway_bulkhead_rejected_total{upstream}
+//	gateway_brownout_level                              0-2, see brownout.go
+//	gateway_brownout_load
+//	gateway_recommendation_impressions_total{strategy}
+//	gateway_recommendation_feedback_total{strategy,event}
+//	gateway_recommendation_ctr{strategy}                clicks / impressions
+//	gateway_recommendation_conversion_rate{strategy}    purchases / impressions
+//	gateway_product_streams_total{outcome}             /product-details/stream: started, completed or abandoned
+
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// labels renders name/value pairs as a Prometheus label set
+func labels(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		fmt.Fprintf(&b, `%s="%s"`, kv[i], v)
+	}
+	return b.String()
+}
+
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]float64 // Keyed by rendered label set
+}
+
+func newCounterVec() *counterVec {
+	return &counterVec{values: map[string]float64{}}
+}
+
+func (c *counterVec) inc(kv ...string) {
+	c.mu.Lock()
+	c.values[labels(kv...)]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer, name, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, ls := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %g\n", name, ls, c.values[ls])
+	}
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+type histogramVec struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[string]*histogram
+}
+
+func newHistogramVec(buckets []float64) *histogramVec {
+	return &histogramVec{buckets: buckets, series: map[string]*histogram{}}
+}
+
+func (h *histogramVec) observe(v float64, kv ...string) {
+	ls := labels(kv...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[ls]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[ls] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *histogramVec) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, ls := range sortedKeys(h.series) {
+		s := h.series[ls]
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, ls, strconv.FormatFloat(le, 'g', -1, 64), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, ls, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", name, ls, s.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, ls, s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// gatewayMetrics is one Server's metric set
+type gatewayMetrics struct {
+	requests           *counterVec
+	requestDuration    *histogramVec
+	upstreamDuration   *histogramVec
+	breakerTransitions *counterVec
+	degraded           *counterVec
+	rateLimited        *counterVec
+	pinFailures        *counterVec
+}
+
+func newGatewayMetrics() *gatewayMetrics {
+	return &gatewayMetrics{
+		requests:           newCounterVec(),
+		requestDuration:    newHistogramVec(defaultBuckets),
+		upstreamDuration:   newHistogramVec(defaultBuckets),
+		breakerTransitions: newCounterVec(),
+		degraded:           newCounterVec(),
+		rateLimited:        newCounterVec(),
+		pinFailures:        newCounterVec(),
+	}
+}
+
+func (m *gatewayMetrics) breakerTransition(name string, from, to circuitbreaker.State) {
+	m.breakerTransitions.inc("breaker", name, "from", from.String(), "to", to.String())
+}
+
+// statusRecorder remembers the response status for request metrics
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach Flush/SetWriteDeadline
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+func (sr *statusRecorder) Flush() {
+	http.NewResponseController(sr.ResponseWriter).Flush()
+}
+
+// withRequestMetrics counts and times requests by the mux pattern they
+// matched, so IDs in paths don't explode cardinality
+func (s *Server) withRequestMetrics(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		s.metrics.requests.inc("route", route, "code", strconv.Itoa(sr.status))
+		s.metrics.requestDuration.observe(time.Since(start).Seconds(), "route", route)
+	})
+}
+
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := s.metrics
+	m.requests.write(w, "gateway_requests_total", "Requests served, by route and status code.")
+	m.requestDuration.write(w, "gateway_request_duration_seconds", "Request latency by route.")
+	m.upstreamDuration.write(w, "gateway_upstream_call_duration_seconds", "Upstream call latency by dependency and outcome.")
+
+	fmt.Fprint(w, "# HELP gateway_circuit_breaker_state Breaker state: 0 closed, 1 open, 2 half-open.\n# TYPE gateway_circuit_breaker_state gauge\n")
+	states := s.Breakers.States()
+	for _, name := range sortedKeys(states) {
+		var v int
+		switch states[name] {
+		case circuitbreaker.StateOpen.String():
+			v = 1
+		case circuitbreaker.StateHalfOpen.String():
+			v = 2
+		}
+		fmt.Fprintf(w, "gateway_circuit_breaker_state{%s} %d\n", labels("breaker", name), v)
+	}
+
+	m.breakerTransitions.write(w, "gateway_circuit_breaker_transitions_total", "Breaker state transitions.")
+	m.degraded.write(w, "gateway_degraded_responses_total", "Responses served in degraded mode, by fallback tier.")
+	m.rateLimited.write(w, "gateway_rate_limited_total", "Requests rejected with 429, by route and limit.")
+	m.pinFailures.write(w, "gateway_upstream_pin_failures_total", "Upstream calls refused because the certificate didn't match its pins.")
+	fmt.Fprintf(w, "# HELP gateway_watchdog_fired_total Requests the watchdog cancelled for exceeding WATCHDOG_THRESHOLD.\n# TYPE gateway_watchdog_fired_total counter\ngateway_watchdog_fired_total %d\n",
+		httpserver.WatchdogFired())
+	fmt.Fprint(w, "# HELP gateway_product_streams_total NDJSON product streams, by outcome.\n# TYPE gateway_product_streams_total counter\n")
+	for _, o := range []struct {
+		outcome string
+		n       int64
+	}{
+		{"started", streamStats.started.Load()},
+		{"completed", streamStats.completed.Load()},
+		{"abandoned", streamStats.abandoned.Load()},
+	} {
+		fmt.Fprintf(w, "gateway_product_streams_total{%s} %d\n", labels("outcome", o.outcome), o.n)
+	}
+	s.bulkheads.write(w)
+	s.brownout.write(w)
+	s.recStats.write(w)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// marshalMsgpack is a small MessagePack encoder covering the shapes the
+// gateway returns (structs, slices, string-keyed maps and scalars). Struct
+// keys follow the json tags so both formats share one field naming, and a
+// json.Marshaler is encoded from its JSON so both formats carry the same
+// value.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf []byte
+	return appendMsgpack(buf, reflect.ValueOf(v))
+}
+
+func appendMsgpack(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, 0xc0), nil
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return append(buf, 0xc0), nil
+	}
+	if m, ok := jsonMarshaler(v); ok {
+		data, err := m.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		return appendMsgpackJSON(buf, dec)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		return appendMsgpack(buf, v.Elem())
+
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf = append(buf, 0xd3)
+		return binary.BigEndian.AppendUint64(buf, uint64(v.Int())), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		buf = append(buf, 0xcf)
+		return binary.BigEndian.AppendUint64(buf, v.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		buf = append(buf, 0xcb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+
+	case reflect.String:
+		return appendMsgpackString(buf, v.String()), nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		buf = appendMsgpackHeader(buf, v.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if buf, err = appendMsgpack(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("msgpack: unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		buf = appendMsgpackHeader(buf, v.Len(), 0x80, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			buf = appendMsgpackString(buf, iter.Key().String())
+			var err error
+			if buf, err = appendMsgpack(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+
+	case reflect.Struct:
+		type field struct {
+			name  string
+			value reflect.Value
+		}
+		var fields []field
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			name := sf.Name
+			if tag := sf.Tag.Get("json"); tag != "" {
+				tagName, opts, _ := strings.Cut(tag, ",")
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+				if strings.Contains(opts, "omitempty") && v.Field(i).IsZero() {
+					continue
+				}
+			}
+			fields = append(fields, field{name: name, value: v.Field(i)})
+		}
+
+		buf = appendMsgpackHeader(buf, len(fields), 0x80, 0xde, 0xdf)
+		for _, f := range fields {
+			buf = appendMsgpackString(buf, f.name)
+			var err error
+			if buf, err = appendMsgpack(buf, f.value); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+
+	return nil, fmt.Errorf("msgpack: unsupported type %s", v.Type())
+}
+
+var jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+
+// jsonMarshaler returns v as a json.Marshaler if encoding/json would use it
+// as one
+func jsonMarshaler(v reflect.Value) (json.Marshaler, bool) {
+	if v.Kind() != reflect.Interface && v.Type().Implements(jsonMarshalerType) {
+		return v.Interface().(json.Marshaler), true
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(jsonMarshalerType) {
+		return v.Addr().Interface().(json.Marshaler), true
+	}
+	return nil, false
+}
+
+// appendMsgpackJSON re-encodes the next JSON value from dec, keeping object
+// key order. Integers are encoded as such, other numbers as floats.
+func appendMsgpackJSON(buf []byte, dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if t {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			buf = append(buf, 0xd3)
+			return binary.BigEndian.AppendUint64(buf, uint64(i)), nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, 0xcb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case string:
+		return appendMsgpackString(buf, t), nil
+	case json.Delim:
+		var body []byte
+		n := 0
+		for ; dec.More(); n++ {
+			if t == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				body = appendMsgpackString(body, key.(string))
+			}
+			if body, err = appendMsgpackJSON(body, dec); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := dec.Token(); err != nil { // Closing delimiter
+			return nil, err
+		}
+		if t == '{' {
+			buf = appendMsgpackHeader(buf, n, 0x80, 0xde, 0xdf)
+		} else {
+			buf = appendMsgpackHeader(buf, n, 0x90, 0xdc, 0xdd)
+		}
+		return append(buf, body...), nil
+	}
+	return nil, fmt.Errorf("msgpack: unexpected JSON token %v", tok)
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0xdb)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+	return append(buf, s...)
+}
+
+// appendMsgpackHeader writes an array or map header using the fix, 16-bit
+// or 32-bit form depending on n.
+func appendMsgpackHeader(buf []byte, n int, fix, b16, b32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, b16)
+		return binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, b32)
+		return binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+}
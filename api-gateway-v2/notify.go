@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+)
+
+// Breaker notifications. With BREAKER_WEBHOOK_URL set, the gateway posts to
+// a webhook whenever a circuit breaker opens or closes again, so operators
+// hear about it during an incident without watching /circuit-status.
+//
+//	BREAKER_WEBHOOK_URL       endpoint to POST to (unset = off)
+//	BREAKER_WEBHOOK_FORMAT    json|slack (default json); slack posts {"text": ...} for incoming webhooks
+//	BREAKER_WEBHOOK_BREAKERS  comma-separated breaker names to notify about (default all)
+//
+// HALF-OPEN trials aren't reported. Transitions are queued and sent in the
+// background (the breaker calls back with its lock held); when the queue is
+// full, notifications are dropped and logged rather than slowing requests.
+
+const (
+	webhookTimeout   = 5 * time.Second
+	webhookQueueSize = 64
+)
+
+// BreakerEvent is the json webhook payload
+type BreakerEvent struct {
+	Event   string    `json:"event"` // Always "circuit_breaker_state_change"
+	Service string    `json:"service"`
+	Breaker string    `json:"breaker"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Time    time.Time `json:"time"`
+}
+
+// WebhookNotifier delivers breaker transitions to a webhook
+type WebhookNotifier struct {
+	url      string
+	format   string
+	breakers map[string]bool // Empty means all
+	client   *http.Client
+
+	mu     sync.RWMutex // Guards closed against Notify racing Close
+	closed bool
+	queue  chan BreakerEvent
+	done   chan struct{}
+}
+
+// NewWebhookNotifierFromEnv returns nil when BREAKER_WEBHOOK_URL is unset
+func NewWebhookNotifierFromEnv() *WebhookNotifier {
+	url := settings.Value("BREAKER_WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	n := &WebhookNotifier{
+		url:      url,
+		format:   "json",
+		breakers: map[string]bool{},
+		client:   &http.Client{Timeout: webhookTimeout},
+		queue:    make(chan BreakerEvent, webhookQueueSize),
+		done:     make(chan struct{}),
+	}
+	if settings.Value("BREAKER_WEBHOOK_FORMAT") == "slack" {
+		n.format = "slack"
+	}
+	for _, name := range strings.Split(settings.Value("BREAKER_WEBHOOK_BREAKERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			n.breakers[name] = true
+		}
+	}
+	go n.run()
+	slog.Info("Breaker notifications enabled", "format", n.format, "breakers", len(n.breakers))
+	return n
+}
+
+// Notify queues a transition without blocking. Safe to call on a nil
+// notifier.
+func (n *WebhookNotifier) Notify(name string, from, to circuitbreaker.State) {
+	if n == nil || to == circuitbreaker.StateHalfOpen {
+		return
+	}
+	if len(n.breakers) > 0 && !n.breakers[name] {
+		return
+	}
+	ev := BreakerEvent{
+		Event:   "circuit_breaker_state_change",
+		Service: "api-gateway-v2",
+		Breaker: name,
+		From:    from.String(),
+		To:      to.String(),
+		Time:    time.Now().UTC(),
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.queue <- ev:
+	default:
+		slog.Warn("Breaker notification dropped, queue full", "breaker", name, "to", ev.To)
+	}
+}
+
+func (n *WebhookNotifier) run() {
+	defer close(n.done)
+	for ev := range n.queue {
+		if err := n.send(ev); err != nil {
+			slog.Warn("Breaker notification failed", "breaker", ev.Breaker, "to", ev.To, "error", err)
+		}
+	}
+}
+
+func (n *WebhookNotifier) send(ev BreakerEvent) error {
+	var payload interface{} = ev
+	if n.format == "slack" {
+		icon := ":red_circle:"
+		if ev.To == circuitbreaker.StateClosed.String() {
+			icon = ":large_green_circle:"
+		}
+		payload = map[string]string{"text": fmt.Sprintf("%s %s: %s circuit breaker is now %s (was %s)",
+			icon, ev.Service, ev.Breaker, ev.To, ev.From)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close sends what is queued and stops the notifier. Transitions notified
+// afterwards are discarded. Safe to call on a nil notifier.
+func (n *WebhookNotifier) Close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	<-n.done
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Upstream pinning. With https upstream URLs the gateway already verifies
+// certificates against the system roots; pins narrow that to the keys and
+// names each upstream is expected to present, so a hijacked DNS entry or a
+// misissued certificate is refused rather than trusted:
+//
+//	UPSTREAM_TLS_PINS  per upstream, pins separated by ';', e.g.
+//	                   "product-service=spki:<base64 sha256>;san:products.internal,recommendations-service=san:recs.internal"
+//
+// spki pins the SHA-256 of a certificate's SubjectPublicKeyInfo (as in
+// HPKP; any certificate in the verified chain may match); san requires the
+// leaf to carry that DNS or IP SAN. An upstream with both kinds must match
+// one of each. Pins apply to every URL of the upstream, including the
+// recommendations secondary set.
+//
+// A mismatch fails the call closed: it is not retried, maps to the
+// "pin_mismatch" error class (502 /problems/upstream-pin-mismatch) and is
+// counted in gateway_upstream_pin_failures_total. Pinning an upstream with
+// an http URL is a startup error.
+
+// errPinMismatch classifies calls refused by pinning
+var errPinMismatch = errors.New("upstream certificate doesn't match its pins")
+
+// upstreamPins are one upstream's expectations; an empty list isn't checked
+type upstreamPins struct {
+	upstream string
+	spki     []string // Base64 SHA-256 of SubjectPublicKeyInfo
+	sans     []string
+}
+
+// pinError says which upstream failed pinning and why
+type pinError struct {
+	upstream string
+	reason   string
+}
+
+func (e *pinError) Error() string {
+	return fmt.Sprintf("%s: %s pins: %s", errPinMismatch, e.upstream, e.reason)
+}
+
+func (e *pinError) Is(target error) bool {
+	return target == errPinMismatch
+}
+
+// upstreamTransport is the transport for upstream calls; nil (the default
+// transport) unless pins are configured
+var upstreamTransport http.RoundTripper
+
+// parseUpstreamPins reads UPSTREAM_TLS_PINS into pins by upstream name
+func parseUpstreamPins(v string) (map[string]*upstreamPins, error) {
+	pins := map[string]*upstreamPins{}
+	if strings.TrimSpace(v) == "" {
+		return pins, nil
+	}
+	for _, entry := range strings.Split(v, ",") {
+		name, list, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("entry %q is not upstream=pins", entry)
+		}
+		p := pins[name]
+		if p == nil {
+			p = &upstreamPins{upstream: name}
+			pins[name] = p
+		}
+		for _, pin := range strings.Split(list, ";") {
+			kind, value, _ := strings.Cut(strings.TrimSpace(pin), ":")
+			switch kind {
+			case "spki":
+				if b, err := base64.StdEncoding.DecodeString(value); err != nil || len(b) != sha256.Size {
+					return nil, fmt.Errorf("%s: spki pin %q is not a base64 SHA-256", name, value)
+				}
+				p.spki = append(p.spki, value)
+			case "san":
+				if value == "" {
+					return nil, fmt.Errorf("%s: empty san pin", name)
+				}
+				p.sans = append(p.sans, strings.ToLower(value))
+			default:
+				return nil, fmt.Errorf("%s: pin %q must start with spki: or san:", name, pin)
+			}
+		}
+	}
+	return pins, nil
+}
+
+// validUpstreamPins is the UPSTREAM_TLS_PINS setting validator
+func validUpstreamPins(v string) error {
+	_, err := parseUpstreamPins(v)
+	return err
+}
+
+// loadUpstreamPinsFromEnv installs a pinning transport when
+// UPSTREAM_TLS_PINS is set. urls are the base URLs of each upstream.
+func loadUpstreamPinsFromEnv(urls map[string][]string) {
+	pins, err := parseUpstreamPins(settings.Value("UPSTREAM_TLS_PINS"))
+	if err != nil {
+		slog.Error("Error parsing UPSTREAM_TLS_PINS", "error", err)
+		os.Exit(1)
+	}
+	if len(pins) == 0 {
+		return
+	}
+
+	pinned := &pinnedTransport{byHost: map[string]http.RoundTripper{}, fallback: http.DefaultTransport}
+	for name, p := range pins {
+		if _, known := urls[name]; !known {
+			slog.Error("UPSTREAM_TLS_PINS names an unknown upstream", "upstream", name)
+			os.Exit(1)
+		}
+		for _, raw := range urls[name] {
+			u, err := url.Parse(raw)
+			if err != nil || u.Scheme != "https" {
+				slog.Error("Pinned upstream must use https", "upstream", name, "url", raw)
+				os.Exit(1)
+			}
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, VerifyConnection: p.verify}
+			pinned.byHost[strings.ToLower(u.Host)] = transport
+		}
+	}
+	upstreamTransport = pinned
+	slog.Info("Upstream TLS pinning enabled", "upstreams", len(pins), "hosts", len(pinned.byHost))
+}
+
+// pinnedTransport sends each request through the transport pinned for its
+// host. The pins are bound per transport rather than looked up from the
+// handshake, which carries no server name for IP addresses.
+type pinnedTransport struct {
+	byHost   map[string]http.RoundTripper // Keyed by host[:port] as in the URL
+	fallback http.RoundTripper
+}
+
+func (t *pinnedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt, ok := t.byHost[strings.ToLower(req.URL.Host)]; ok {
+		return rt.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// nonEmpty drops empty URLs (an unset secondary)
+func nonEmpty(urls ...string) []string {
+	return slices.DeleteFunc(urls, func(u string) bool { return u == "" })
+}
+
+// verify checks a verified connection against the pins. It runs after the
+// usual chain and hostname verification, never instead of it.
+func (p *upstreamPins) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return &pinError{upstream: p.upstream, reason: "no certificate"}
+	}
+	if len(p.spki) > 0 && !p.spkiMatches(cs) {
+		return &pinError{upstream: p.upstream, reason: "no certificate in the chain has a pinned public key"}
+	}
+	if len(p.sans) > 0 && !p.sanMatches(cs.PeerCertificates[0]) {
+		return &pinError{upstream: p.upstream, reason: "certificate has none of the pinned SANs"}
+	}
+	return nil
+}
+
+func (p *upstreamPins) spkiMatches(cs tls.ConnectionState) bool {
+	chains := cs.VerifiedChains
+	if len(chains) == 0 {
+		chains = [][]*x509.Certificate{cs.PeerCertificates}
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if slices.Contains(p.spki, base64.StdEncoding.EncodeToString(sum[:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *upstreamPins) sanMatches(leaf *x509.Certificate) bool {
+	for _, name := range leaf.DNSNames {
+		if slices.Contains(p.sans, strings.ToLower(name)) {
+			return true
+		}
+	}
+	for _, ip := range leaf.IPAddresses {
+		if slices.Contains(p.sans, ip.String()) {
+			return true
+		}
+	}
+	return false
+}
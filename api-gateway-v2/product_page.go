@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// Server-side rendered product page. Uses the same composition as
+// /product-details so non-JSON consumers (crawlers, link previews) see the
+// same data - including degraded mode - as API clients.
+var productPageTemplate = template.Must(template.New("product-page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Product.Name}}</title>
+<meta name="description" content="{{.Product.Description}}">
+<meta property="og:title" content="{{.Product.Name}}">
+<meta property="og:description" content="{{.Product.Description}}">
+<meta property="product:price:amount" content="{{printf "%.2f" .Product.Price}}">
+<meta property="product:price:currency" content="USD">
+</head>
+<body>
+<main>
+<h1>{{.Product.Name}}</h1>
+<p class="price">${{printf "%.2f" .Product.Price}}</p>
+<p class="description">{{.Product.Description}}</p>
+{{- with .Product.Availability}}
+{{- if eq .Status "preorder"}}
+<p class="availability">Available for preorder, ships {{.ReleaseDate}}.</p>
+{{- else if eq .Status "unreleased"}}
+<p class="availability">Coming soon{{if .ReleaseDate}} ({{.ReleaseDate}}){{end}}.</p>
+{{- else if eq .Status "discontinued"}}
+<p class="availability">No longer available.</p>
+{{- end}}
+{{- end}}
+<section class="recommendations">
+<h2>You might also like</h2>
+{{- if .Recommendations}}
+<ul>
+{{- range .Recommendations}}
+<li><a href="/product-page/{{.ID}}">{{.Name}}</a> - ${{printf "%.2f" .Price}}</li>
+{{- end}}
+</ul>
+{{- else if .DegradedMode}}
+<p class="degraded">Recommendations are temporarily unavailable.</p>
+{{- else}}
+<p>No recommendations for this product.</p>
+{{- end}}
+</section>
+</main>
+<footer><small>Rendered {{.Timestamp}}</small></footer>
+</body>
+</html>
+`))
+
+func (s *Server) productPageHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract ID from path
+	path := strings.TrimPrefix(r.URL.Path, "/product-page/")
+	id := strings.TrimSpace(path)
+
+	if id == "" {
+		http.Error(w, "Product ID required", http.StatusBadRequest)
+		return
+	}
+
+	runRequestHooks("/product-page/", r)
+
+	details, err := s.composeProductDetails(r, id)
+	if err != nil {
+		s.log(r.Context()).Error("Error getting product", "product_id", id, "error", err)
+		m := lookupErrorMapping(err)
+		http.Error(w, m.Title, m.Status)
+		return
+	}
+
+	runResponseHooks("/product-page/", r, w.Header(), details)
+
+	// Render into a buffer so a template error doesn't send a half page
+	var buf bytes.Buffer
+	if err := productPageTemplate.Execute(&buf, details); err != nil {
+		s.log(r.Context()).Error("Error rendering product page", "product_id", id, "error", err)
+		http.Error(w, "Failed to render product page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
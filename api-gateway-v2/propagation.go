@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Header propagation rules for gateway -> backend calls. Only allowlisted
+// client headers are forwarded upstream; hop-by-hop and credential headers
+// are never forwarded, even if someone adds them to the allowlist.
+
+// Default allowlist: tracing, request correlation, auth context (as
+// asserted by the gateway, not raw credentials), language and priority.
+// Override with PROPAGATE_HEADERS="Traceparent,X-Request-Id,...".
+var propagatedHeaders = []string{
+	"Traceparent",
+	"Tracestate",
+	"X-Request-Id",
+	"X-Auth-Context",
+	"Accept-Language",
+	"X-Priority",
+}
+
+// Never forwarded upstream
+var blockedHeaders = map[string]bool{
+	// Hop-by-hop (RFC 9110 section 7.6.1)
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Connection":    true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	// Client credentials belong to the gateway's edge, not the backends
+	"Authorization": true,
+	"Cookie":        true,
+	"X-Api-Key":     true,
+}
+
+func loadHeaderPropagationFromEnv() {
+	spec := settings.Value("PROPAGATE_HEADERS")
+	if spec == "" {
+		return
+	}
+	propagatedHeaders = nil
+	for _, h := range strings.Split(spec, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			propagatedHeaders = append(propagatedHeaders, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+type propagatedHeadersKey struct{}
+
+// withPropagatedHeaders stores the headers from the client request that may
+// be forwarded on upstream calls made with ctx
+func withPropagatedHeaders(ctx context.Context, in http.Header) context.Context {
+	return context.WithValue(ctx, propagatedHeadersKey{}, filterPropagatedHeaders(in))
+}
+
+// applyPropagatedHeaders copies the headers stored in ctx onto an outbound
+// request
+func applyPropagatedHeaders(ctx context.Context, req *http.Request) {
+	h, _ := ctx.Value(propagatedHeadersKey{}).(http.Header)
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	// The correlation ID always travels, whatever PROPAGATE_HEADERS says
+	if id := logging.RequestIDFrom(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+}
+
+func filterPropagatedHeaders(in http.Header) http.Header {
+	// Headers listed in Connection are hop-by-hop for this hop too
+	connectionScoped := map[string]bool{}
+	for _, v := range in.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			connectionScoped[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+
+	out := http.Header{}
+	for _, name := range propagatedHeaders {
+		key := http.CanonicalHeaderKey(name)
+		if blockedHeaders[key] || connectionScoped[key] {
+			continue
+		}
+		if values := in.Values(key); len(values) > 0 {
+			out[key] = append([]string(nil), values...)
+		}
+	}
+	return out
+}
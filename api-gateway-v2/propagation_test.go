@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// setPropagatedHeaders replaces the allowlist for the rest of the test
+func setPropagatedHeaders(t *testing.T, names ...string) {
+	t.Helper()
+	saved := propagatedHeaders
+	propagatedHeaders = names
+	t.Cleanup(func() { propagatedHeaders = saved })
+}
+
+func TestFilterPropagatedHeaders(t *testing.T) {
+	// Credentials and hop-by-hop headers are allowlisted here on purpose:
+	// they must be dropped anyway
+	setPropagatedHeaders(t, "Traceparent", "X-Request-Id", "Accept-Language", "X-Priority",
+		"Authorization", "Cookie", "X-Api-Key", "Proxy-Authorization", "Upgrade", "Keep-Alive")
+
+	in := http.Header{}
+	in.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Add("Accept-Language", "fr")
+	in.Add("Accept-Language", "en;q=0.5")
+	in.Set("X-Priority", "high")
+	in.Set("Authorization", "Bearer secret")
+	in.Set("Cookie", "session=secret")
+	in.Set("X-Api-Key", "secret")
+	in.Set("Proxy-Authorization", "Basic secret")
+	in.Set("Upgrade", "websocket")
+	in.Set("Keep-Alive", "timeout=5")
+	in.Set("Connection", "keep-alive, x-priority")
+	in.Set("X-Not-Allowlisted", "1")
+
+	want := http.Header{
+		"Traceparent":     {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"Accept-Language": {"fr", "en;q=0.5"},
+	}
+	if got := filterPropagatedHeaders(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("filterPropagatedHeaders:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestFilterPropagatedHeadersConnectionListed(t *testing.T) {
+	setPropagatedHeaders(t, "X-Priority", "X-Request-Id")
+
+	// Only headers named in Connection are dropped, in any case and with
+	// several Connection lines
+	in := http.Header{}
+	in.Set("X-Priority", "high")
+	in.Set("X-Request-Id", "abc")
+	in.Add("Connection", "close")
+	in.Add("Connection", " X-PRIORITY ")
+
+	want := http.Header{"X-Request-Id": {"abc"}}
+	if got := filterPropagatedHeaders(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("filterPropagatedHeaders:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestApplyPropagatedHeaders(t *testing.T) {
+	setPropagatedHeaders(t, "Traceparent", "Authorization", "Cookie")
+
+	client := httptest.NewRequest(http.MethodGet, "/product-details/1", nil)
+	client.Header.Set("Traceparent", "00-trace")
+	client.Header.Set("Authorization", "Bearer secret")
+	client.Header.Set("Cookie", "session=secret")
+	ctx := withPropagatedHeaders(context.Background(), client.Header)
+
+	out, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://product-service/product/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyPropagatedHeaders(ctx, out)
+	if got := out.Header.Get("Traceparent"); got != "00-trace" {
+		t.Errorf("Traceparent = %q, want it forwarded", got)
+	}
+	for _, h := range []string{"Authorization", "Cookie"} {
+		if got := out.Header.Get(h); got != "" {
+			t.Errorf("%s = %q forwarded upstream", h, got)
+		}
+	}
+}
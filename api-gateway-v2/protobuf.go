@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Protocol buffer encoding of ProductDetails (schema: product_details.proto).
+// Hand-rolled against the wire format so the gateway stays dependency-free;
+// only the message types the gateway serves are supported.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type protobufEncoder struct{}
+
+func (protobufEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (protobufEncoder) Encode(w io.Writer, v interface{}) error {
+	var buf []byte
+	switch msg := v.(type) {
+	case *ProductDetails:
+		buf = appendProductDetailsProto(buf, msg)
+	case ProductDetails:
+		buf = appendProductDetailsProto(buf, &msg)
+	case *PartialDetails:
+		buf = appendPartialDetailsProto(buf, msg)
+	case *Product:
+		buf = appendProductProto(buf, msg)
+	case Product:
+		buf = appendProductProto(buf, &msg)
+	default:
+		return fmt.Errorf("protobuf: no schema for %T", v)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func init() {
+	RegisterEncoder(protobufEncoder{})
+}
+
+func appendProductDetailsProto(buf []byte, d *ProductDetails) []byte {
+	buf = appendProtoMessage(buf, 1, appendProductProto(nil, &d.Product))
+	return appendDetailsBodyProto(buf, d)
+}
+
+// appendPartialDetailsProto leaves out the product message when it wasn't
+// selected; unselected recommendations are an empty repeated field
+func appendPartialDetailsProto(buf []byte, p *PartialDetails) []byte {
+	if p.Product != nil {
+		buf = appendProtoMessage(buf, 1, appendProductProto(nil, p.Product))
+	}
+	d := ProductDetails{
+		Timestamp:            p.Timestamp,
+		Meta:                 p.Meta,
+		DegradedMode:         p.DegradedMode,
+		RecommendationsTotal: p.RecommendationsTotal,
+		BundleComponents:     p.BundleComponents,
+	}
+	if p.Recommendations != nil {
+		d.Recommendations = *p.Recommendations
+	}
+	return appendDetailsBodyProto(buf, &d)
+}
+
+// appendDetailsBodyProto appends every ProductDetails field but the product
+func appendDetailsBodyProto(buf []byte, d *ProductDetails) []byte {
+	for i := range d.Recommendations {
+		buf = appendProtoMessage(buf, 2, appendProductProto(nil, &d.Recommendations[i]))
+	}
+	buf = appendProtoString(buf, 3, d.Timestamp)
+	buf = appendProtoBool(buf, 4, d.DegradedMode)
+	buf = appendProtoVarint(buf, 5, uint64(d.RecommendationsTotal))
+	if d.Meta != nil {
+		buf = appendProtoMessage(buf, 6, appendResponseMetaProto(nil, d.Meta))
+	}
+	for i := range d.BundleComponents {
+		item := &d.BundleComponents[i]
+		var msg []byte
+		msg = appendProtoVarint(msg, 1, uint64(item.Quantity))
+		msg = appendProtoMessage(msg, 2, appendProductProto(nil, &item.Product))
+		buf = appendProtoMessage(buf, 7, msg)
+	}
+	return buf
+}
+
+func appendResponseMetaProto(buf []byte, m *ResponseMeta) []byte {
+	buf = appendProtoString(buf, 1, m.ServedBy)
+	buf = appendProtoString(buf, 2, m.Cache)
+	buf = appendProtoString(buf, 3, m.DegradationLevel)
+	buf = appendProtoString(buf, 4, m.FallbackTier)
+	buf = appendProtoString(buf, 5, m.TraceID)
+	for _, l := range m.UpstreamLatency {
+		var entry []byte
+		entry = appendProtoString(entry, 1, l.Upstream)
+		entry = appendProtoDouble(entry, 2, l.Ms)
+		buf = appendProtoMessage(buf, 6, entry)
+	}
+	// optional: written even when 0, so presence tells brownout is on
+	if m.BrownoutLevel != nil {
+		buf = appendProtoTag(buf, 7, wireVarint)
+		buf = binary.AppendUvarint(buf, uint64(*m.BrownoutLevel))
+	}
+	return buf
+}
+
+func appendProductProto(buf []byte, p *Product) []byte {
+	buf = appendProtoString(buf, 1, p.ID)
+	buf = appendProtoString(buf, 2, p.Name)
+	buf = appendProtoDouble(buf, 3, p.Price)
+	buf = appendProtoString(buf, 4, p.Description)
+	if a := p.Availability; a != nil {
+		var msg []byte
+		msg = appendProtoString(msg, 1, a.PreorderDate)
+		msg = appendProtoString(msg, 2, a.ReleaseDate)
+		msg = appendProtoString(msg, 3, a.EndOfLife)
+		msg = appendProtoString(msg, 4, a.Status)
+		buf = appendProtoMessage(buf, 5, msg)
+	}
+	for _, c := range p.Components {
+		var msg []byte
+		msg = appendProtoString(msg, 1, c.ProductID)
+		msg = appendProtoVarint(msg, 2, uint64(c.Quantity))
+		buf = appendProtoMessage(buf, 6, msg)
+	}
+	buf = appendProtoString(buf, 7, p.Category)
+	return buf
+}
+
+func appendProtoTag(buf []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(buf, uint64(field)<<3|uint64(wireType))
+}
+
+// proto3 omits fields holding their zero value
+
+func appendProtoString(buf []byte, field int, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	buf = appendProtoTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendProtoDouble(buf []byte, field int, f float64) []byte {
+	if f == 0 {
+		return buf
+	}
+	buf = appendProtoTag(buf, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+func appendProtoBool(buf []byte, field int, b bool) []byte {
+	if !b {
+		return buf
+	}
+	buf = appendProtoTag(buf, field, wireVarint)
+	return append(buf, 1)
+}
+
+func appendProtoVarint(buf []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendProtoTag(buf, field, wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+// Embedded messages are always written (even empty) so presence is preserved
+func appendProtoMessage(buf []byte, field int, msg []byte) []byte {
+	buf = appendProtoTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(msg)))
+	return append(buf, msg...)
+}
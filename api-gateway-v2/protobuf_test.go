@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// protoFields decodes one message into its fields by number: uint64 for
+// varints and fixed64, []byte for length-delimited fields
+func protoFields(t *testing.T, msg []byte) map[int][]interface{} {
+	t.Helper()
+	fields := map[int][]interface{}{}
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			t.Fatalf("bad tag in %x", msg)
+		}
+		msg = msg[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				t.Fatalf("field %d: bad varint", field)
+			}
+			fields[field] = append(fields[field], v)
+			msg = msg[n:]
+		case wireFixed64:
+			if len(msg) < 8 {
+				t.Fatalf("field %d: truncated fixed64", field)
+			}
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(msg))
+			msg = msg[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				t.Fatalf("field %d: truncated bytes", field)
+			}
+			fields[field] = append(fields[field], msg[n:n+int(l)])
+			msg = msg[n+int(l):]
+		default:
+			t.Fatalf("field %d: unexpected wire type %d", field, tag&7)
+		}
+	}
+	return fields
+}
+
+// decodeMetaProto reads a ResponseMeta message back
+func decodeMetaProto(t *testing.T, msg []byte) ResponseMeta {
+	t.Helper()
+	var m ResponseMeta
+	str := func(v []interface{}) string {
+		if len(v) == 0 {
+			return ""
+		}
+		return string(v[len(v)-1].([]byte))
+	}
+	f := protoFields(t, msg)
+	m.ServedBy, m.Cache, m.DegradationLevel = str(f[1]), str(f[2]), str(f[3])
+	m.FallbackTier, m.TraceID = str(f[4]), str(f[5])
+	for _, raw := range f[6] {
+		entry := protoFields(t, raw.([]byte))
+		l := UpstreamLatency{Upstream: str(entry[1])}
+		if v := entry[2]; len(v) > 0 {
+			l.Ms = math.Float64frombits(v[0].(uint64))
+		}
+		m.UpstreamLatency = append(m.UpstreamLatency, l)
+	}
+	if v := f[7]; len(v) > 0 {
+		level := int(v[len(v)-1].(uint64))
+		m.BrownoutLevel = &level
+	}
+	return m
+}
+
+func TestProtobufResponseMetaRoundTrip(t *testing.T) {
+	level := func(n int) *int { return &n }
+	for _, want := range []ResponseMeta{
+		{ServedBy: "gw-1", Cache: "none", DegradationLevel: degradationPartial, FallbackTier: fallbackTierBrownout,
+			TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", BrownoutLevel: level(2),
+			UpstreamLatency: []UpstreamLatency{{Upstream: productUpstream, Ms: 12.5}}},
+		{ServedBy: "gw-1", Cache: "none", DegradationLevel: degradationNone, BrownoutLevel: level(0)},
+		{ServedBy: "gw-1", Cache: "none", DegradationLevel: degradationNone}, // Brownout off
+	} {
+		details := sampleDetails()
+		details.Meta = &want
+		var buf bytes.Buffer
+		if err := (protobufEncoder{}).Encode(&buf, details); err != nil {
+			t.Fatal(err)
+		}
+		top := protoFields(t, buf.Bytes())
+		if len(top[6]) != 1 {
+			t.Fatalf("got %d meta fields, want 1", len(top[6]))
+		}
+		if got := decodeMetaProto(t, top[6][0].([]byte)); !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip:\n got %s\nwant %s", fmtMeta(got), fmtMeta(want))
+		}
+	}
+}
+
+func fmtMeta(m ResponseMeta) string {
+	level := "absent"
+	if m.BrownoutLevel != nil {
+		level = fmt.Sprint(*m.BrownoutLevel)
+	}
+	return fmt.Sprintf("%+v brownout_level=%s", m, level)
+}
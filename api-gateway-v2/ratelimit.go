@@ -0,0 +1,238 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+)
+
+// Rate limiting. Each client (X-Api-Key, else the connection's IP) gets a
+// token bucket per route; on top of that a global bucket caps the gateway's
+// total request rate. A request that finds its bucket empty is answered
+// 429 with Retry-After, so the demo shows backpressure at the edge as well
+// as circuit breaking behind it.
+//
+// A rate alone doesn't stop a client that holds many slow requests open at
+// once, so each client can also be capped on requests in flight across all
+// routes; a request beyond the cap is refused the same way (scope
+// "concurrency") without spending a token. Streams and WebSocket upgrades
+// are rate limited but not capped: they stay open for as long as the client
+// watches, and would otherwise use up its slots.
+//
+//	RATE_LIMIT_RPS            per-client requests per second on each route (0 = no per-client limit)
+//	RATE_LIMIT_BURST          per-client bucket size (default 10)
+//	RATE_LIMIT_ROUTES         per-route overrides of RATE_LIMIT_RPS, e.g. "/product-details/batch=2,/feedback=50"
+//	RATE_LIMIT_GLOBAL_RPS     all clients together (0 = no global limit)
+//	RATE_LIMIT_MAX_IN_FLIGHT  per-client requests in progress at once (0 = no cap)
+//
+// Probes and /metrics are never limited. X-Forwarded-For isn't trusted:
+// behind a proxy, clients should be told apart by API key.
+var rateLimit = struct {
+	clientRPS float64
+	burst     float64
+	routeRPS  map[string]float64
+	globalRPS float64
+	inFlight  int
+}{burst: 10, routeRPS: map[string]float64{}}
+
+// Routes exempt from rate limiting
+var rateLimitExempt = map[string]bool{"/health": true, "/healthz": true, "/readyz": true, "/metrics": true}
+
+// Long-lived routes left out of RATE_LIMIT_MAX_IN_FLIGHT, along with any
+// upgrade request
+var rateLimitStreaming = map[string]bool{"/product-details/stream": true, "/circuit-status/stream": true, "/ws": true}
+
+// Idle client buckets are dropped once there are this many
+const maxRateLimitBuckets = 10000
+
+func loadRateLimitFromEnv() {
+	if v, err := strconv.ParseFloat(settings.Value("RATE_LIMIT_RPS"), 64); err == nil && v >= 0 {
+		rateLimit.clientRPS = v
+	}
+	if v, err := strconv.ParseFloat(settings.Value("RATE_LIMIT_BURST"), 64); err == nil && v >= 1 {
+		rateLimit.burst = v
+	}
+	for _, pair := range strings.Split(settings.Value("RATE_LIMIT_ROUTES"), ",") {
+		route, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if rps, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && rps >= 0 {
+			rateLimit.routeRPS[strings.TrimSpace(route)] = rps
+		}
+	}
+	if v, err := strconv.ParseFloat(settings.Value("RATE_LIMIT_GLOBAL_RPS"), 64); err == nil && v >= 0 {
+		rateLimit.globalRPS = v
+	}
+	if v, err := strconv.Atoi(settings.Value("RATE_LIMIT_MAX_IN_FLIGHT")); err == nil && v >= 0 {
+		rateLimit.inFlight = v
+	}
+	if rateLimit.clientRPS > 0 || len(rateLimit.routeRPS) > 0 || rateLimit.globalRPS > 0 || rateLimit.inFlight > 0 {
+		slog.Info("Rate limiting enabled", "client_rps", rateLimit.clientRPS, "burst", rateLimit.burst,
+			"routes", len(rateLimit.routeRPS), "global_rps", rateLimit.globalRPS, "client_max_in_flight", rateLimit.inFlight)
+	}
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate per second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64 // Of the bucket's route, for evictIdle
+}
+
+// take spends a token if one is available; otherwise it reports how long
+// until one will be
+func (b *tokenBucket) take(now time.Time, rate, burst float64) (bool, time.Duration) {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rate, burst)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	global  tokenBucket
+	clients map[string]*tokenBucket // Keyed by route and client
+	active  map[string]int          // Requests in flight by client; zero entries are removed
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{clients: map[string]*tokenBucket{}, active: map[string]int{}}
+}
+
+// enter admits one more request from client unless it already has
+// RATE_LIMIT_MAX_IN_FLIGHT in progress. Every admitted request must be
+// matched by a call to leave.
+func (l *rateLimiter) enter(client string) bool {
+	if rateLimit.inFlight <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[client] >= rateLimit.inFlight {
+		return false
+	}
+	l.active[client]++
+	return true
+}
+
+func (l *rateLimiter) leave(client string) {
+	if rateLimit.inFlight <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[client]--; l.active[client] <= 0 {
+		delete(l.active, client)
+	}
+}
+
+// allow decides whether client may call route now. scope names the limit
+// that refused it ("client" or "global").
+func (l *rateLimiter) allow(route, client string, now time.Time) (ok bool, retryAfter time.Duration, scope string) {
+	rps, override := rateLimit.routeRPS[route]
+	if !override {
+		rps = rateLimit.clientRPS
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rps > 0 {
+		key := route + " " + client
+		b, exists := l.clients[key]
+		if !exists {
+			if len(l.clients) >= maxRateLimitBuckets {
+				l.evictIdle(now)
+			}
+			b = &tokenBucket{rate: rps}
+			l.clients[key] = b
+		}
+		if ok, wait := b.take(now, rps, max(rateLimit.burst, 1)); !ok {
+			return false, wait, "client"
+		}
+	}
+	if rateLimit.globalRPS > 0 {
+		if ok, wait := l.global.take(now, rateLimit.globalRPS, max(rateLimit.globalRPS, 1)); !ok {
+			return false, wait, "global"
+		}
+	}
+	return true, 0, ""
+}
+
+// evictIdle drops buckets that have refilled completely, which carry no
+// state worth keeping; l.mu must be held
+func (l *rateLimiter) evictIdle(now time.Time) {
+	for key, b := range l.clients {
+		idle := time.Duration(max(rateLimit.burst, 1) / b.rate * float64(time.Second))
+		if now.Sub(b.last) > idle {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// rateLimitClient identifies the caller: its API key if it sent one,
+// otherwise its IP address
+func rateLimitClient(r *http.Request) string {
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// withRateLimit applies the client concurrency cap and the client and
+// global rate limits for the route mux would dispatch r to
+func (s *Server) withRateLimit(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if rateLimitExempt[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := rateLimitClient(r)
+		ok, retryAfter, scope := false, time.Second, "concurrency"
+		if rateLimitStreaming[route] || isUpgrade(r) {
+			ok, retryAfter, scope = s.limiter.allow(route, client, time.Now())
+		} else if s.limiter.enter(client) {
+			defer s.limiter.leave(client)
+			ok, retryAfter, scope = s.limiter.allow(route, client, time.Now())
+		}
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.metrics.rateLimited.inc("route", route, "scope", scope)
+		s.log(r.Context()).Debug("Request rate limited", "route", route, "scope", scope)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		detail := scope + " rate limit exceeded on " + route
+		if scope == "concurrency" {
+			detail = "too many requests in flight from this client"
+		}
+		apperrors.WriteProblem(w, apperrors.Problem{
+			Type:   "/problems/rate-limited",
+			Title:  "Too many requests",
+			Status: http.StatusTooManyRequests,
+			Detail: detail,
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// Kubernetes-style probes, distinct from /health (which docker-compose and
+// existing scripts use, and which only says the process is up):
+//
+//	/healthz  liveness: the process is serving. Dependencies are never
+//	          checked, so a dead backend can't get the gateway restarted.
+//	/readyz   readiness: 200 when the gateway can serve product details,
+//	          503 with the failing dependencies otherwise.
+//
+// product-service is required: it is probed live and its breaker must not
+// be open. Recommendations are reported but never fail readiness, since the
+// gateway degrades without them. A draining gateway is never ready.
+
+const readinessProbeTimeout = 2 * time.Second
+
+// pinger is implemented by clients that can check their upstream directly
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type dependencyStatus struct {
+	Status    string  `json:"status"` // "up" or "down"
+	Required  bool    `json:"required"`
+	Circuit   string  `json:"circuit"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type readinessReport struct {
+	Status       string                      `json:"status"` // "ready" or "not_ready"
+	Draining     bool                        `json:"draining"`
+	Failing      []string                    `json:"failing"`
+	Dependencies map[string]dependencyStatus `json:"dependencies"`
+}
+
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := readinessReport{
+		Draining:     httpserver.Draining(),
+		Failing:      []string{},
+		Dependencies: map[string]dependencyStatus{},
+	}
+
+	product := dependencyStatus{Status: "up", Required: true, Circuit: s.Breakers.Get(productUpstream).GetState()}
+	if p, ok := s.Products.(pinger); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessProbeTimeout)
+		start := time.Now()
+		err := p.Ping(ctx)
+		cancel()
+		product.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			product.Status = "down"
+			product.Error = err.Error()
+		}
+	}
+	if s.Breakers.Get(productUpstream).State() == circuitbreaker.StateOpen {
+		product.Status = "down"
+		if product.Error == "" {
+			product.Error = "circuit breaker is open"
+		}
+	}
+	report.Dependencies[productUpstream] = product
+	if product.Status != "up" {
+		report.Failing = append(report.Failing, productUpstream)
+	}
+
+	for _, set := range []*UpstreamSet{s.Recommendations.Primary, s.Recommendations.Secondary} {
+		if set == nil {
+			continue
+		}
+		dep := dependencyStatus{Status: "up", Circuit: set.Breaker.GetState()}
+		if !set.isHealthy() {
+			dep.Status = "down"
+		}
+		report.Dependencies[s.Recommendations.Name+"/"+set.Name] = dep
+	}
+
+	status := http.StatusOK
+	report.Status = "ready"
+	if report.Draining || len(report.Failing) > 0 {
+		status = http.StatusServiceUnavailable
+		report.Status = "not_ready"
+	}
+	jsonutil.Write(w, status, report)
+}
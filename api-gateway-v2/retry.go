@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retries for upstream calls. Only failures that are safe and likely to
+// succeed on a second try are retried: connection-level errors (refused,
+// reset) and 502/503/504 answers. Timeouts, 4xx, malformed payloads, pin
+// mismatches and anything after the caller's deadline are not. Backoff is exponential with
+// full jitter.
+//
+//	RETRY_MAX_ATTEMPTS   total attempts per call, 1 disables (default 3)
+//	RETRY_BASE_DELAY_MS  first backoff ceiling (default 50)
+//	RETRY_MAX_DELAY_MS   backoff ceiling cap (default 1000)
+//	RETRY_BREAKER_MODE   "once": the breaker sees the whole retry sequence
+//	                     as one call (default); "each": every attempt goes
+//	                     through the breaker
+var retryPolicy = struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	perAttempt  bool
+}{maxAttempts: 3, baseDelay: 50 * time.Millisecond, maxDelay: time.Second}
+
+func loadRetryPolicyFromEnv() {
+	if v, err := strconv.Atoi(settings.Value("RETRY_MAX_ATTEMPTS")); err == nil && v >= 1 {
+		retryPolicy.maxAttempts = v
+	}
+	if v, err := strconv.Atoi(settings.Value("RETRY_BASE_DELAY_MS")); err == nil && v > 0 {
+		retryPolicy.baseDelay = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.Atoi(settings.Value("RETRY_MAX_DELAY_MS")); err == nil && v > 0 {
+		retryPolicy.maxDelay = time.Duration(v) * time.Millisecond
+	}
+	retryPolicy.perAttempt = settings.Value("RETRY_BREAKER_MODE") == "each"
+	slog.Info("Upstream retries", "max_attempts", retryPolicy.maxAttempts, "base_delay", retryPolicy.baseDelay.String(), "max_delay", retryPolicy.maxDelay.String())
+}
+
+// retryable reports whether a failed attempt may be repeated
+func retryable(err error) bool {
+	var upErr *UpstreamError
+	if !errors.As(err, &upErr) {
+		return false
+	}
+	switch upErr.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case 0:
+		return upErr.Err != nil && !isTimeout(upErr.Err) && !errors.Is(upErr.Err, errPinMismatch)
+	}
+	return false
+}
+
+// backoff returns the jittered delay before retry number attempt (1-based)
+func backoff(attempt int) time.Duration {
+	ceiling := min(retryPolicy.baseDelay<<(attempt-1), retryPolicy.maxDelay)
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// withRetries calls fn until it succeeds, fails for good or attempts run out
+func withRetries(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= retryPolicy.maxAttempts || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// callUpstream runs call with retries under breaker, combined according to
+// RETRY_BREAKER_MODE
+func (s *Server) callUpstream(ctx context.Context, breaker *CircuitBreaker, call func() error) error {
+	if retryPolicy.perAttempt {
+		return withRetries(ctx, func() error { return breaker.Execute(call) })
+	}
+	return breaker.Execute(func() error { return withRetries(ctx, call) })
+}
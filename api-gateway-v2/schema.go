@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Schema violation kinds, used as metric labels
+const (
+	violationUnknownField  = "unknown_field"
+	violationTypeMismatch  = "type_mismatch"
+	violationMissingField  = "missing_field"
+	violationInvalidValue  = "invalid_value"
+	violationMalformedJSON = "malformed_json"
+)
+
+// When true, upstream payloads with fields the gateway doesn't know about
+// are rejected (UPSTREAM_UNKNOWN_FIELDS=reject). The default tolerates them
+// so backends can add fields ahead of the gateway.
+var rejectUnknownUpstreamFields = false
+
+func loadSchemaPolicyFromEnv() {
+	switch policy := settings.Value("UPSTREAM_UNKNOWN_FIELDS"); policy {
+	case "reject":
+		rejectUnknownUpstreamFields = true
+	case "", "ignore":
+	default:
+		slog.Warn("Unknown UPSTREAM_UNKNOWN_FIELDS policy, ignoring unknown fields", "policy", policy)
+	}
+}
+
+// SchemaError reports an upstream payload that doesn't match the model the
+// gateway expects. Returned inside the circuit breaker it counts as an
+// upstream failure, so a backend shipping bad data trips the breaker just
+// like one that is down.
+type SchemaError struct {
+	Upstream string
+	Kind     string
+	Detail   string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s returned invalid payload (%s): %s", e.Upstream, e.Kind, e.Detail)
+}
+
+func (e *SchemaError) Is(target error) bool {
+	return target == apperrors.ErrInvalidResponse
+}
+
+// Per upstream/kind violation counters, exposed on /debug/schema-violations
+var schemaViolations = struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}{counts: map[string]int64{}}
+
+func recordSchemaViolation(err *SchemaError) *SchemaError {
+	schemaViolations.mu.Lock()
+	schemaViolations.counts[err.Upstream+"/"+err.Kind]++
+	schemaViolations.mu.Unlock()
+	return err
+}
+
+func schemaViolationsHandler(w http.ResponseWriter, r *http.Request) {
+	schemaViolations.mu.Lock()
+	counts := make(map[string]int64, len(schemaViolations.counts))
+	for k, v := range schemaViolations.counts {
+		counts[k] = v
+	}
+	schemaViolations.mu.Unlock()
+
+	jsonutil.Write(w, http.StatusOK, counts)
+}
+
+// newUpstreamDecoder applies the unknown field policy to a decoder
+func newUpstreamDecoder(dec *json.Decoder) *json.Decoder {
+	if rejectUnknownUpstreamFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec
+}
+
+// classifyDecodeError turns a JSON decoding error into a SchemaError. Errors
+// that aren't about the payload shape (I/O, size limits) pass through as-is.
+func classifyDecodeError(upstream string, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		return recordSchemaViolation(&SchemaError{upstream, violationTypeMismatch,
+			fmt.Sprintf("field %q: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)})
+	case errors.As(err, &syntaxErr):
+		return recordSchemaViolation(&SchemaError{upstream, violationMalformedJSON, err.Error()})
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		return recordSchemaViolation(&SchemaError{upstream, violationUnknownField,
+			strings.TrimPrefix(err.Error(), "json: ")})
+	}
+	return err
+}
+
+var knownAvailabilityStatus = map[string]bool{
+	models.StatusUnreleased:   true,
+	models.StatusPreorder:     true,
+	models.StatusAvailable:    true,
+	models.StatusDiscontinued: true,
+}
+
+func validComponents(components []models.BundleComponent) bool {
+	for _, c := range components {
+		if c.ProductID == "" || c.Quantity < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// validateProduct checks the invariants the gateway and its clients rely on
+func validateProduct(upstream string, p *Product) error {
+	switch {
+	case p.ID == "":
+		return recordSchemaViolation(&SchemaError{upstream, violationMissingField, "product.id is empty"})
+	case p.Name == "":
+		return recordSchemaViolation(&SchemaError{upstream, violationMissingField,
+			fmt.Sprintf("product %s: name is empty", p.ID)})
+	case p.Price < 0 || math.IsNaN(p.Price) || math.IsInf(p.Price, 0):
+		return recordSchemaViolation(&SchemaError{upstream, violationInvalidValue,
+			fmt.Sprintf("product %s: price %v", p.ID, p.Price)})
+	case !validComponents(p.Components):
+		return recordSchemaViolation(&SchemaError{upstream, violationInvalidValue,
+			fmt.Sprintf("product %s: malformed bundle components", p.ID)})
+	case p.Availability != nil && !knownAvailabilityStatus[p.Availability.Status]:
+		return recordSchemaViolation(&SchemaError{upstream, violationInvalidValue,
+			fmt.Sprintf("product %s: availability status %q", p.ID, p.Availability.Status)})
+	}
+	return nil
+}
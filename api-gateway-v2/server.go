@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Server holds the gateway's per-instance dependencies. main builds one from
+// the environment; tests and embedders can build several side by side with
+// their own clients, breakers and loggers.
+type Server struct {
+	Products        ProductClient
+	Recommendations *FailoverUpstream // Each set's breaker lives in Breakers
+	Breakers        *circuitbreaker.Registry
+	DegradedLog     *DegradedLog     // nil disables degraded-response recording
+	BreakerNotifier *WebhookNotifier // nil disables breaker notifications
+	ProductUpdates  http.Handler     // Proxy for /ws; nil disables it
+	Logger          *slog.Logger
+
+	faults    *faultInjector
+	health    *healthRegistry
+	warmup    *warmupLimiter
+	bulkheads *bulkheadRegistry
+	limiter   *rateLimiter
+	metrics   *gatewayMetrics
+	recStats  *recommendationStats
+	brownout  *brownoutController
+
+	breakerEvents *breakerStream
+}
+
+func NewServer(products ProductClient, recommendations *FailoverUpstream, breakers *circuitbreaker.Registry, degradedLog *DegradedLog, logger *slog.Logger) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Server{
+		Products:        products,
+		Recommendations: recommendations,
+		Breakers:        breakers,
+		DegradedLog:     degradedLog,
+		Logger:          logger,
+		faults:          newFaultInjector(),
+		health:          newHealthRegistry(),
+		warmup:          newWarmupLimiter(),
+		bulkheads:       newBulkheadRegistry(),
+		limiter:         newRateLimiter(),
+		metrics:         newGatewayMetrics(),
+		recStats:        newRecommendationStats(),
+		brownout:        newBrownoutController(),
+		breakerEvents:   newBreakerStream(),
+	}
+	breakers.OnStateChange(s.breakerTransition)
+	return s
+}
+
+// breakerTransition reports a breaker state change to metrics, the
+// circuit status stream and, when configured, the webhook. It runs with
+// cb locked, so it must not go back to the breaker or the registry.
+func (s *Server) breakerTransition(name string, cb *circuitbreaker.CircuitBreaker, from, to circuitbreaker.State) {
+	s.metrics.breakerTransition(name, from, to)
+	s.breakerEvents.publish(name, from, to, cb)
+	s.BreakerNotifier.Notify(name, from, to)
+}
+
+// Handler returns the gateway's routes on a fresh mux
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/product-details/", withClientTimeout(s.productDetailsHandler))
+	mux.HandleFunc("/product-details/stream", withClientTimeout(s.productDetailsStreamHandler))
+	mux.HandleFunc("/product-details/batch", withClientTimeout(s.productDetailsBatchHandler))
+	mux.HandleFunc("/product-page/", withClientTimeout(s.productPageHandler))
+	mux.HandleFunc("/graphql", withClientTimeout(s.graphqlHandler))
+	mux.HandleFunc("/feedback", s.feedbackHandler)
+	if s.ProductUpdates != nil {
+		mux.HandleFunc("/ws", s.productUpdatesHandler)
+	}
+	mux.HandleFunc("/health", httpserver.HealthHandler)
+	mux.HandleFunc("/healthz", livenessHandler)
+	mux.HandleFunc("/readyz", s.readinessHandler)
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.HandleFunc("/debug/runtime", httpserver.RuntimeHandler)
+	mux.HandleFunc("/circuit-status", s.circuitStatusHandler)
+	mux.HandleFunc("/circuit-status/stream", s.circuitStatusStreamHandler)
+	mux.HandleFunc("/debug/streams", streamStatsHandler)
+	mux.HandleFunc("/debug/schema-violations", schemaViolationsHandler)
+	mux.HandleFunc("/debug/health-scores", s.healthScoresHandler)
+	mux.Handle("/admin/error-mapping", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(errorMappingHandler)))
+	mux.Handle("/admin/upstreams", httpserver.RequireTokenForWrites(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(s.upstreamsAdminHandler)))
+	mux.Handle("/admin/faults", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(s.faultsAdminHandler)))
+	mux.Handle("/admin/circuit/", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(s.circuitAdminHandler)))
+	return logging.RequestID(httpserver.Watchdog(withDebugCapture(withLookupMemo(s.withRequestMetrics(mux, s.brownout.track(s.withRateLimit(mux, s.withFaultInjection(mux))))))))
+}
+
+// log returns the server's logger tagged with the request ID in ctx
+func (s *Server) log(ctx context.Context) *slog.Logger {
+	return logging.For(ctx, s.Logger)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// Maximum number of IDs accepted by a single bulk request
+const maxBulkIDs = 100
+
+// How long a single stream write may block before we consider the client
+// stalled (slow reader / dead connection) and abandon the stream
+const streamWriteTimeout = 10 * time.Second
+
+// Counters for streaming endpoints, exposed on /debug/streams and as
+// gateway_product_streams_total on /metrics
+var streamStats struct {
+	started   atomic.Int64
+	completed atomic.Int64
+	abandoned atomic.Int64 // Client disconnected or stalled mid-stream
+}
+
+func streamStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := map[string]int64{
+		"streams_started":   streamStats.started.Load(),
+		"streams_completed": streamStats.completed.Load(),
+		"streams_abandoned": streamStats.abandoned.Load(),
+	}
+	jsonutil.Write(w, http.StatusOK, stats)
+}
+
+// streamError is written in place of a ProductDetails line when the
+// product itself could not be fetched
+type streamError struct {
+	ProductID   string `json:"product_id"`
+	Error       string `json:"error"`
+	Status      int    `json:"status"`
+	ProblemType string `json:"problem_type"`
+}
+
+// parseBulkIDs splits ?ids=1,2,3 into trimmed, non-empty IDs
+func parseBulkIDs(r *http.Request) []string {
+	var ids []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// productDetailsStreamHandler serves GET /product-details/stream?ids=1,2,3
+// as NDJSON, writing one object per line as each composition completes so
+// bulk consumers aren't held up by the slowest item.
+func (s *Server) productDetailsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	ids := parseBulkIDs(r)
+	if len(ids) == 0 {
+		http.Error(w, "ids query parameter required", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxBulkIDs {
+		http.Error(w, "Too many ids (max 100)", http.StatusBadRequest)
+		return
+	}
+
+	runRequestHooks("/product-details/stream", r)
+
+	// A long stream isn't a stuck request: the per-write deadlines below
+	// catch clients that stop reading
+	httpserver.LongLived(r.Context())
+
+	// Cancelling ctx (client disconnect or stalled write) aborts the
+	// in-flight upstream calls of every remaining item
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	// Compose concurrently; results arrive in completion order
+	results := make(chan interface{}, len(ids))
+	for _, id := range ids {
+		go func(id string) {
+			details, err := s.composeProductDetails(r, id)
+			if err != nil {
+				s.log(r.Context()).Error("Error getting product", "product_id", id, "error", err)
+				m := lookupErrorMapping(err)
+				results <- streamError{ProductID: id, Error: m.Title, Status: m.Status, ProblemType: m.ProblemType}
+				return
+			}
+			// Headers are already committed by now; hooks see a scratch copy
+			runResponseHooks("/product-details/stream", r, http.Header{}, details)
+			results <- details
+		}(id)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	runResponseHooks("/product-details/stream", r, w.Header(), nil)
+	w.WriteHeader(http.StatusOK)
+
+	streamStats.started.Add(1)
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w) // Encode appends the newline
+	for written := 0; written < len(ids); written++ {
+		var item interface{}
+		select {
+		case item = <-results:
+		case <-ctx.Done():
+			streamStats.abandoned.Add(1)
+			s.log(r.Context()).Info("Stream abandoned by client", "written", written, "items", len(ids))
+			return
+		}
+
+		// A write deadline turns a client that stopped reading into an error
+		// instead of a goroutine blocked forever
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		err := enc.Encode(item)
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			streamStats.abandoned.Add(1)
+			s.log(r.Context()).Warn("Stream abandoned", "written", written, "items", len(ids), "error", err)
+			return
+		}
+	}
+	rc.SetWriteDeadline(time.Time{})
+	streamStats.completed.Add(1)
+
+	s.log(r.Context()).Info("Stream completed", "items", len(ids), "duration_ms", time.Since(startTime).Milliseconds())
+}
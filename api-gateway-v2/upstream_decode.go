@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Limits applied to upstream recommendation payloads
+var (
+	maxRecommendations      = 20             // Returned to clients (MAX_RECOMMENDATIONS)
+	maxRecommendationsBytes = int64(1 << 20) // Upstream body cap (MAX_RECOMMENDATIONS_BYTES)
+)
+
+var errPayloadTooLarge = errors.New("upstream payload exceeds size limit")
+
+func loadRecommendationLimitsFromEnv() {
+	if v, err := strconv.Atoi(settings.Value("MAX_RECOMMENDATIONS")); err == nil && v >= 0 {
+		maxRecommendations = v
+	}
+	if v, err := strconv.ParseInt(settings.Value("MAX_RECOMMENDATIONS_BYTES"), 10, 64); err == nil && v > 0 {
+		maxRecommendationsBytes = v
+	}
+	slog.Info("Recommendations capped", "max_items", maxRecommendations, "max_bytes", maxRecommendationsBytes)
+}
+
+// limitedReader fails (rather than silently truncating like io.LimitReader)
+// once more than n bytes have been read
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errPayloadTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errPayloadTooLarge
+	}
+	return n, err
+}
+
+// decodeRecommendations stream-decodes a JSON array of products, keeping at
+// most limit items in memory while counting the total available. The body
+// is bounded by maxBytes so a misbehaving upstream can't exhaust memory.
+func decodeRecommendations(body io.Reader, limit int, maxBytes int64) ([]Product, int, error) {
+	const upstream = "recommendations-service"
+	dec := newUpstreamDecoder(json.NewDecoder(&limitedReader{r: body, n: maxBytes}))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, 0, classifyDecodeError(upstream, err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, 0, recordSchemaViolation(&SchemaError{upstream, violationTypeMismatch,
+			fmt.Sprintf("expected JSON array, got %v", tok)})
+	}
+
+	recommendations := []Product{}
+	total := 0
+	for dec.More() {
+		if total < limit {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, 0, classifyDecodeError(upstream, err)
+			}
+			p, err := models.DecodeProduct(raw, rejectUnknownUpstreamFields)
+			if err != nil {
+				return nil, 0, classifyDecodeError(upstream, err)
+			}
+			if err := validateProduct(upstream, &p); err != nil {
+				return nil, 0, err
+			}
+			recommendations = append(recommendations, p)
+		} else {
+			// Past the cap: validate and count, but don't keep
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, 0, classifyDecodeError(upstream, err)
+			}
+		}
+		total++
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, 0, classifyDecodeError(upstream, err)
+	}
+	return recommendations, total, nil
+}
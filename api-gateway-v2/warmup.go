@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Upstream warm-up after a restart. For WARMUP_PERIOD after startup each
+// dependency gets a token bucket whose rate ramps linearly from
+// WARMUP_INITIAL_RPS to WARMUP_MAX_RPS, so cold backends and fresh
+// connection pools aren't hit with full load at once. Calls wait for a
+// token within their own deadline. Once the period is over the limiter
+// steps aside.
+//
+//	WARMUP_PERIOD       e.g. 60s (unset = no warm-up)
+//	WARMUP_INITIAL_RPS  default 5
+//	WARMUP_MAX_RPS      rate reached at the end of the period (default 200)
+var warmup = struct {
+	period     time.Duration
+	initialRPS float64
+	maxRPS     float64
+}{initialRPS: 5, maxRPS: 200}
+
+func loadWarmupFromEnv() {
+	if v, err := time.ParseDuration(settings.Value("WARMUP_PERIOD")); err == nil && v > 0 {
+		warmup.period = v
+	}
+	if v, err := strconv.ParseFloat(settings.Value("WARMUP_INITIAL_RPS"), 64); err == nil && v > 0 {
+		warmup.initialRPS = v
+	}
+	if v, err := strconv.ParseFloat(settings.Value("WARMUP_MAX_RPS"), 64); err == nil && v > 0 {
+		warmup.maxRPS = v
+	}
+	if warmup.period > 0 {
+		slog.Info("Upstream warm-up", "initial_rps", warmup.initialRPS, "max_rps", warmup.maxRPS, "period", warmup.period.String())
+	}
+}
+
+// warmupBucket is one dependency's token bucket
+type warmupBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// warmupLimiter hands out per-dependency buckets and knows when warm-up
+// started
+type warmupLimiter struct {
+	start   time.Time
+	mu      sync.Mutex
+	buckets map[string]*warmupBucket
+}
+
+func newWarmupLimiter() *warmupLimiter {
+	return &warmupLimiter{start: time.Now(), buckets: map[string]*warmupBucket{}}
+}
+
+// rate is the allowed calls per second at now, or 0 once warm-up is over
+func (l *warmupLimiter) rate(now time.Time) float64 {
+	elapsed := now.Sub(l.start)
+	if warmup.period <= 0 || elapsed >= warmup.period {
+		return 0
+	}
+	frac := float64(elapsed) / float64(warmup.period)
+	return warmup.initialRPS + (warmup.maxRPS-warmup.initialRPS)*frac
+}
+
+// Wait blocks until a call to dependency name is allowed or ctx is done
+func (l *warmupLimiter) Wait(ctx context.Context, name string) error {
+	if l.rate(time.Now()) == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	b, ok := l.buckets[name]
+	if !ok {
+		b = &warmupBucket{tokens: 1, last: time.Now()}
+		l.buckets[name] = b
+	}
+	l.mu.Unlock()
+
+	for {
+		now := time.Now()
+		rate := l.rate(now)
+		if rate == 0 {
+			return nil
+		}
+
+		b.mu.Lock()
+		// Refill; the bucket holds at most one second's worth of calls
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rate, max(rate, 1))
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Command anonymize-captures scrubs recorded gateway traffic (debug-capture
+// log lines and degraded-response logs) so it can be committed as test
+// fixtures:
+//
+//   - product IDs are rehashed consistently, so relationships between
+//     requests survive but real catalog IDs don't
+//   - client identity (IPs, user agents, forwarding headers) is faked
+//   - credentials (auth headers, cookies, API keys in query strings) are removed
+//
+// Usage:
+//
+//	anonymize-captures -in gateway.log -out fixtures/captures.jsonl -salt s3cret
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Headers dropped entirely
+var secretHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+}
+
+// Headers identifying the client, replaced with fakes
+var identityHeaders = map[string]bool{
+	"x-forwarded-for": true,
+	"x-real-ip":       true,
+	"user-agent":      true,
+}
+
+// Query parameters dropped entirely
+var secretParams = map[string]bool{
+	"api_key": true,
+	"apikey":  true,
+	"key":     true,
+	"token":   true,
+}
+
+// Path prefixes whose next segment is a product ID
+var idPathPrefixes = []string{"/product-details/", "/product-page/", "/product/", "/recommendations/"}
+
+const fakeUserAgent = "capture-replay/1.0"
+
+type anonymizer struct {
+	salt []byte
+}
+
+// rehash maps an ID to a stable pseudonym for this salt
+func (a *anonymizer) rehash(id string) string {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(id))
+	return "p-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// fakeIP maps a client address to a stable TEST-NET-3 address (RFC 5737)
+func (a *anonymizer) fakeIP(addr string) string {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(addr))
+	return fmt.Sprintf("203.0.113.%d", mac.Sum(nil)[0])
+}
+
+func (a *anonymizer) scrubURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	for _, prefix := range idPathPrefixes {
+		if rest, ok := strings.CutPrefix(u.Path, prefix); ok && rest != "" {
+			if rest == "stream" {
+				break
+			}
+			u.Path = prefix + a.rehash(rest)
+			break
+		}
+	}
+
+	q := u.Query()
+	for k := range q {
+		if secretParams[strings.ToLower(k)] {
+			q.Del(k)
+		}
+	}
+	if ids := q.Get("ids"); ids != "" {
+		parts := strings.Split(ids, ",")
+		for i, id := range parts {
+			parts[i] = a.rehash(strings.TrimSpace(id))
+		}
+		q.Set("ids", strings.Join(parts, ","))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (a *anonymizer) scrubHeaders(headers map[string]interface{}) {
+	for k, v := range headers {
+		switch lower := strings.ToLower(k); {
+		case secretHeaders[lower]:
+			delete(headers, k)
+		case lower == "user-agent":
+			headers[k] = []interface{}{fakeUserAgent}
+		case identityHeaders[lower]:
+			headers[k] = []interface{}{a.fakeIP(fmt.Sprint(v))}
+		}
+	}
+}
+
+// scrub walks a decoded JSON document in place
+func (a *anonymizer) scrub(node interface{}) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			s, isString := v.(string)
+			switch {
+			case (k == "id" || k == "product_id") && isString:
+				n[k] = a.rehash(s)
+			case (k == "url" || k == "path") && isString:
+				n[k] = a.scrubURL(s)
+			case k == "remote_addr" && isString:
+				n[k] = a.fakeIP(s)
+			case k == "user_agent" && isString:
+				n[k] = fakeUserAgent
+			case k == "headers":
+				if h, ok := v.(map[string]interface{}); ok {
+					a.scrubHeaders(h)
+				}
+			default:
+				a.scrub(v)
+			}
+		}
+	case []interface{}:
+		for _, v := range n {
+			a.scrub(v)
+		}
+	}
+}
+
+// anonymize copies captures from r to w, one JSON document per line. Log
+// prefixes before the JSON (timestamps, "debug-capture") are dropped; lines
+// without JSON are skipped. Structured gateway logs are JSON records
+// themselves: only debug-capture records are kept, unwrapped to the capture.
+func (a *anonymizer) anonymize(r io.Reader, w io.Writer) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	enc := json.NewEncoder(w)
+
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		start := strings.Index(line, "{")
+		if start < 0 {
+			continue
+		}
+
+		var doc interface{}
+		if err := json.Unmarshal([]byte(line[start:]), &doc); err != nil {
+			log.Printf("Skipping unparseable line: %v", err)
+			continue
+		}
+		if rec, ok := doc.(map[string]interface{}); ok && rec["level"] != nil && rec["msg"] != nil {
+			if rec["msg"] != "debug-capture" || rec["capture"] == nil {
+				continue
+			}
+			doc = rec["capture"]
+		}
+		a.scrub(doc)
+		if err := enc.Encode(doc); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
+
+func main() {
+	in := flag.String("in", "-", "capture file to read (- for stdin)")
+	out := flag.String("out", "-", "file to write scrubbed captures to (- for stdout)")
+	salt := flag.String("salt", "", "secret used to rehash IDs (random if empty, making runs unlinkable)")
+	flag.Parse()
+
+	a := &anonymizer{salt: []byte(*salt)}
+	if *salt == "" {
+		a.salt = make([]byte, 32)
+		if _, err := rand.Read(a.salt); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := a.anonymize(r, w)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Anonymized %d captures", count)
+}
@@ -0,0 +1,188 @@
+// Command chaos manages network-level faults through a Toxiproxy instance,
+// complementing the services' application-level injection
+// (SIMULATE_FAILURE, SIMULATE_CORRUPTION, /admin/faults).
+//
+// The gateway reaches its upstreams through the proxies when pointed at
+// them (PRODUCT_SERVICE_URL / RECOMMENDATIONS_URL), e.g. with the "chaos"
+// docker-compose profile.
+//
+// Usage:
+//
+//	chaos setup                                   create the product and recommendations proxies
+//	chaos list                                    proxies and their toxics
+//	chaos add recommendations latency latency=1000 jitter=200
+//	chaos add product bandwidth rate=16
+//	chaos add recommendations reset_peer timeout=0
+//	chaos remove recommendations latency          remove one toxic
+//	chaos disable recommendations                 drop all connections (upstream "down")
+//	chaos enable recommendations
+//	chaos reset                                   enable every proxy, remove every toxic
+//
+// -api sets the Toxiproxy API address (default http://localhost:8474).
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Proxies created by "setup": name -> listen address, upstream
+var proxies = []struct {
+	Name     string
+	Listen   string
+	Upstream string
+}{
+	{"product", "0.0.0.0:18081", "product-service:8081"},
+	{"recommendations", "0.0.0.0:18082", "recommendations-service:8082"},
+}
+
+type toxic struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Stream     string                 `json:"stream"`
+	Toxicity   float64                `json:"toxicity"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type proxy struct {
+	Name     string  `json:"name"`
+	Listen   string  `json:"listen"`
+	Upstream string  `json:"upstream"`
+	Enabled  bool    `json:"enabled"`
+	Toxics   []toxic `json:"toxics"`
+}
+
+type client struct {
+	api  string
+	http *http.Client
+}
+
+func (c *client) do(method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.api+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// parseAttributes turns "latency=1000 jitter=200" into toxic attributes
+func parseAttributes(args []string) (map[string]interface{}, error) {
+	attrs := map[string]interface{}{}
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("attribute %q is not key=value", arg)
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %q is not an integer", k, v)
+		}
+		attrs[k] = n
+	}
+	return attrs, nil
+}
+
+func main() {
+	api := flag.String("api", "http://localhost:8474", "Toxiproxy API address")
+	stream := flag.String("stream", "downstream", "toxic direction for add: downstream or upstream")
+	toxicity := flag.Float64("toxicity", 1, "share of connections a new toxic applies to (0-1)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: chaos [-api URL] setup|list|add|remove|enable|disable|reset ...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	c := &client{api: strings.TrimSuffix(*api, "/"), http: &http.Client{Timeout: 5 * time.Second}}
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, rest := args[0], args[1:]; {
+	case cmd == "setup":
+		for _, p := range proxies {
+			err = c.do(http.MethodPost, "/proxies",
+				proxy{Name: p.Name, Listen: p.Listen, Upstream: p.Upstream, Enabled: true}, nil)
+			if err != nil && !strings.Contains(err.Error(), "409") {
+				break
+			}
+			err = nil
+			fmt.Printf("proxy %s: %s -> %s\n", p.Name, p.Listen, p.Upstream)
+		}
+
+	case cmd == "list":
+		var all map[string]proxy
+		if err = c.do(http.MethodGet, "/proxies", nil, &all); err == nil {
+			names := make([]string, 0, len(all))
+			for name := range all {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				p := all[name]
+				fmt.Printf("%-16s %s -> %s enabled=%v\n", p.Name, p.Listen, p.Upstream, p.Enabled)
+				for _, t := range p.Toxics {
+					fmt.Printf("    %-24s %s %s toxicity=%v %v\n", t.Name, t.Type, t.Stream, t.Toxicity, t.Attributes)
+				}
+			}
+		}
+
+	case cmd == "add" && len(rest) >= 2:
+		var attrs map[string]interface{}
+		if attrs, err = parseAttributes(rest[2:]); err == nil {
+			t := toxic{Name: rest[1], Type: rest[1], Stream: *stream, Toxicity: *toxicity, Attributes: attrs}
+			err = c.do(http.MethodPost, "/proxies/"+rest[0]+"/toxics", t, nil)
+		}
+
+	case cmd == "remove" && len(rest) == 2:
+		err = c.do(http.MethodDelete, "/proxies/"+rest[0]+"/toxics/"+rest[1], nil, nil)
+
+	case (cmd == "enable" || cmd == "disable") && len(rest) == 1:
+		err = c.do(http.MethodPost, "/proxies/"+rest[0], map[string]bool{"enabled": cmd == "enable"}, nil)
+
+	case cmd == "reset":
+		err = c.do(http.MethodPost, "/reset", nil, nil)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "chaos: %v\n", err)
+		os.Exit(1)
+	}
+}
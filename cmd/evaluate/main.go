@@ -0,0 +1,195 @@
+// Command evaluate replays a recorded feedback dataset through a running
+// recommendations-service and scores each recommendation strategy against
+// it, so engine changes can be compared on the same data before they ship.
+//
+// The dataset is JSON lines of feedback events, as POSTed to /feedback:
+//
+//	{"product_id": "1", "recommended_id": "3", "event": "click"}
+//
+// Every product with at least one event becomes a query; the products
+// clicked or bought from its page are the relevant set. For each strategy
+// the tool fetches /recommendations/{id}?strategy=... and reports, averaged
+// over queries:
+//
+//	precision@K  relevant items in the top K / K
+//	recall@K     relevant items in the top K / relevant items
+//	coverage     distinct products recommended in any top K / products seen
+//	             (in the dataset or this strategy's recommendations)
+//
+// Usage:
+//
+//	evaluate -dataset events.jsonl -target http://localhost:8082 -k 5 -strategies table,embedding
+//
+// The embedding strategy needs the service running with
+// RECOMMENDATION_MODE=embedding or bandit. Evaluate against an instance that
+// hasn't been sent the dataset as live feedback, or feedback ranking will
+// have already learned the answers.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+type result struct {
+	Strategy  string  `json:"strategy"`
+	Queries   int     `json:"queries"`
+	Precision float64 `json:"precision_at_k"`
+	Recall    float64 `json:"recall_at_k"`
+	Coverage  float64 `json:"coverage"`
+	Errors    int     `json:"errors"`
+}
+
+// loadDataset reads feedback events into product ID -> relevant product IDs
+func loadDataset(r io.Reader) (map[string]map[string]bool, error) {
+	relevant := map[string]map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var fb models.Feedback
+		if err := json.Unmarshal(scanner.Bytes(), &fb); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if fb.ProductID == "" || fb.RecommendedID == "" {
+			return nil, fmt.Errorf("line %d: product_id and recommended_id are required", line)
+		}
+		if fb.Event != models.FeedbackClick && fb.Event != models.FeedbackPurchase {
+			continue
+		}
+		if relevant[fb.ProductID] == nil {
+			relevant[fb.ProductID] = map[string]bool{}
+		}
+		relevant[fb.ProductID][fb.RecommendedID] = true
+	}
+	return relevant, scanner.Err()
+}
+
+func fetch(client *http.Client, target, id, strategy string) ([]models.Product, error) {
+	u := fmt.Sprintf("%s/recommendations/%s?strategy=%s", target, url.PathEscape(id), url.QueryEscape(strategy))
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var recs []models.Product
+	if err := json.NewDecoder(resp.Body).Decode(&recs); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+func evaluate(client *http.Client, target, strategy string, k int, relevant map[string]map[string]bool) result {
+	res := result{Strategy: strategy}
+	ids := make([]string, 0, len(relevant))
+	catalog := map[string]bool{}
+	for id, items := range relevant {
+		ids = append(ids, id)
+		catalog[id] = true
+		for item := range items {
+			catalog[item] = true
+		}
+	}
+	sort.Strings(ids)
+
+	recommended := map[string]bool{}
+	for _, id := range ids {
+		recs, err := fetch(client, target, id, strategy)
+		if err != nil {
+			log.Printf("%s: product %s: %v", strategy, id, err)
+			res.Errors++
+			continue
+		}
+		hits := 0
+		for _, p := range recs[:min(k, len(recs))] {
+			recommended[p.ID] = true
+			catalog[p.ID] = true
+			if relevant[id][p.ID] {
+				hits++
+			}
+		}
+		res.Queries++
+		res.Precision += float64(hits) / float64(k)
+		res.Recall += float64(hits) / float64(len(relevant[id]))
+	}
+	if res.Queries > 0 {
+		res.Precision /= float64(res.Queries)
+		res.Recall /= float64(res.Queries)
+	}
+	if len(catalog) > 0 {
+		res.Coverage = float64(len(recommended)) / float64(len(catalog))
+	}
+	return res
+}
+
+func main() {
+	dataset := flag.String("dataset", "-", "feedback events, JSON lines (- for stdin)")
+	target := flag.String("target", "http://localhost:8082", "recommendations-service base URL")
+	k := flag.Int("k", 5, "cutoff for precision, recall and coverage")
+	strategies := flag.String("strategies", "table,embedding", "comma-separated strategies to evaluate")
+	asJSON := flag.Bool("json", false, "print results as JSON")
+	flag.Parse()
+
+	if *k < 1 {
+		log.Fatal("-k must be at least 1")
+	}
+
+	var r io.Reader = os.Stdin
+	if *dataset != "-" {
+		f, err := os.Open(*dataset)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	relevant, err := loadDataset(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(relevant) == 0 {
+		log.Fatal("dataset has no click or purchase events")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var results []result
+	for _, strategy := range strings.Split(*strategies, ",") {
+		if strategy = strings.TrimSpace(strategy); strategy != "" {
+			results = append(results, evaluate(client, strings.TrimSuffix(*target, "/"), strategy, *k, relevant))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "STRATEGY\tQUERIES\tPRECISION@%d\tRECALL@%d\tCOVERAGE\tERRORS\n", *k, *k)
+	for _, res := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%.3f\t%.3f\t%.3f\t%d\n",
+			res.Strategy, res.Queries, res.Precision, res.Recall, res.Coverage, res.Errors)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,150 @@
+// Command monitor is a terminal dashboard for the demo environment. It
+// polls every service once per interval and redraws a status screen:
+// health and probe latency (with a sparkline of recent probes) for each
+// service, plus the v2 gateway's circuit breaker and upstream routing.
+//
+// Usage:
+//
+//	monitor -interval 1s
+//
+// Service URLs default to the docker-compose ports and can be overridden
+// with -v1, -v2, -products and -recommendations.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Number of probes kept per service for the sparkline
+const historyLen = 30
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+type service struct {
+	name    string
+	url     string
+	healthy bool
+	err     string
+	history []time.Duration // Probe latencies, oldest first
+}
+
+func (s *service) probe(client *http.Client) {
+	start := time.Now()
+	resp, err := client.Get(s.url + "/health")
+	elapsed := time.Since(start)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+	}
+
+	s.healthy = err == nil
+	s.err = ""
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.history = append(s.history, elapsed)
+	if len(s.history) > historyLen {
+		s.history = s.history[1:]
+	}
+}
+
+// sparkline scales latencies between the fastest and slowest probe shown
+func sparkline(samples []time.Duration) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	lo, hi := samples[0], samples[0]
+	for _, d := range samples {
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	var b strings.Builder
+	for _, d := range samples {
+		i := 0
+		if hi > lo {
+			i = int(float64(d-lo) / float64(hi-lo) * float64(len(sparkChars)-1))
+		}
+		b.WriteRune(sparkChars[i])
+	}
+	return b.String()
+}
+
+// getJSON fetches and decodes a gateway debug/admin endpoint
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func main() {
+	interval := flag.Duration("interval", time.Second, "poll interval")
+	v1 := flag.String("v1", "http://localhost:8080", "api-gateway-v1 base URL")
+	v2 := flag.String("v2", "http://localhost:8090", "api-gateway-v2 base URL")
+	products := flag.String("products", "http://localhost:8081", "product-service base URL")
+	recs := flag.String("recommendations", "http://localhost:8082", "recommendations-service base URL")
+	flag.Parse()
+
+	services := []*service{
+		{name: "api-gateway-v1", url: *v1},
+		{name: "api-gateway-v2", url: *v2},
+		{name: "product-service", url: *products},
+		{name: "recommendations-service", url: *recs},
+	}
+	client := &http.Client{Timeout: *interval}
+
+	for {
+		for _, s := range services {
+			s.probe(client)
+		}
+		render(client, services, *v2)
+		time.Sleep(*interval)
+	}
+}
+
+func render(client *http.Client, services []*service, v2 string) {
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J") // Home + clear screen
+	fmt.Fprintf(&b, "Midterm-Mastery demo monitor  %s  (Ctrl-C to quit)\n\n", time.Now().Format("15:04:05"))
+
+	fmt.Fprintf(&b, "%-25s %-6s %9s  %s\n", "SERVICE", "HEALTH", "LATENCY", "RECENT PROBES")
+	for _, s := range services {
+		health := "\033[32mUP\033[0m    "
+		if !s.healthy {
+			health = "\033[31mDOWN\033[0m  "
+		}
+		last := s.history[len(s.history)-1].Round(time.Millisecond)
+		fmt.Fprintf(&b, "%-25s %s %9v  %s\n", s.name, health, last, sparkline(s.history))
+		if s.err != "" {
+			fmt.Fprintf(&b, "    %s\n", s.err)
+		}
+	}
+
+	var circuit map[string]interface{}
+	b.WriteString("\napi-gateway-v2 circuit breaker\n")
+	if err := getJSON(client, v2+"/circuit-status", &circuit); err != nil {
+		fmt.Fprintf(&b, "  - (%v)\n", err)
+	} else {
+		fmt.Fprintf(&b, "  state: %v   active set: %v\n", circuit["circuit_state"], circuit["recommendations_active"])
+	}
+
+	var streams map[string]int64
+	if err := getJSON(client, v2+"/debug/streams", &streams); err == nil {
+		fmt.Fprintf(&b, "  streams: %d started, %d completed, %d abandoned\n",
+			streams["streams_started"], streams["streams_completed"], streams["streams_abandoned"])
+	}
+
+	os.Stdout.WriteString(b.String())
+}
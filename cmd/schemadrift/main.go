@@ -0,0 +1,270 @@
+// Command schemadrift fetches live sample responses from every service and
+// checks them against the shared models the gateways decode into
+// (internal/models), so a field renamed or retyped in only one place shows
+// up before a gateway starts rejecting payloads in production.
+//
+// For each endpoint the expected shape is derived from the Go types by
+// reflection. Reported drift:
+//
+//	unknown field  the service sends a field the model doesn't have
+//	missing field  a field the model always expects (no omitempty) is absent
+//	retyped        the JSON type differs from the model's, e.g. a string price
+//
+// Gateway envelopes are checked for the product fields only; the extra
+// response metadata v2 adds is ignored.
+//
+// Usage:
+//
+//	schemadrift -id 1
+//
+// Service URLs default to the docker-compose ports and can be overridden
+// with -v1, -v2, -products and -recommendations. The exit status is 1 when
+// drift is found or an endpoint can't be sampled, so it can gate a local
+// CI-style run; -skip-unreachable ignores services that aren't running.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// schema is the JSON shape of a Go type
+type schema struct {
+	kind   string // object, array, string, number, boolean or any
+	fields map[string]field
+	open   bool // Fields not in the schema are allowed
+	elem   *schema
+}
+
+type field struct {
+	schema   *schema
+	optional bool // omitempty or a pointer: may be absent or null
+}
+
+func schemaOf(t reflect.Type) *schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &schema{kind: "string"}
+	case reflect.Bool:
+		return &schema{kind: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &schema{kind: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{kind: "array", elem: schemaOf(t.Elem())}
+	case reflect.Struct:
+		s := &schema{kind: "object", fields: map[string]field{}}
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			s.fields[name] = field{
+				schema:   schemaOf(f.Type),
+				optional: strings.Contains(opts, "omitempty") || f.Type.Kind() == reflect.Pointer,
+			}
+		}
+		return s
+	}
+	return &schema{kind: "any"}
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return "unknown"
+}
+
+type finding struct {
+	Path    string `json:"path"` // e.g. recommendations[].price
+	Problem string `json:"problem"`
+	Detail  string `json:"detail"`
+}
+
+// diff compares v against s and adds what doesn't match to found, keyed
+// so array elements with the same problem are reported once
+func diff(path string, s *schema, v interface{}, found map[string]finding) {
+	kind := jsonKind(v)
+	if s.kind == "any" || kind == "null" && (s.kind == "object" || s.kind == "array") {
+		return
+	}
+	if kind != s.kind {
+		if path == "" {
+			path = "(response)"
+		}
+		found[path+"/retyped"] = finding{path, "retyped", fmt.Sprintf("expected %s, got %s", s.kind, kind)}
+		return
+	}
+	switch s.kind {
+	case "object":
+		obj := v.(map[string]interface{})
+		for name, value := range obj {
+			f, ok := s.fields[name]
+			switch {
+			case ok:
+				diff(join(path, name), f.schema, value, found)
+			case !s.open:
+				p := join(path, name)
+				found[p+"/unknown"] = finding{p, "unknown field", fmt.Sprintf("%s value not in the model", jsonKind(value))}
+			}
+		}
+		for name, f := range s.fields {
+			if _, ok := obj[name]; !ok && !f.optional {
+				p := join(path, name)
+				found[p+"/missing"] = finding{p, "missing field", "expected " + f.schema.kind}
+			}
+		}
+	case "array":
+		for _, elem := range v.([]interface{}) {
+			diff(path+"[]", s.elem, elem, found)
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+type check struct {
+	service string
+	url     string
+	expect  *schema
+}
+
+type result struct {
+	Service  string    `json:"service"`
+	URL      string    `json:"url"`
+	Error    string    `json:"error,omitempty"` // Endpoint couldn't be sampled
+	Findings []finding `json:"findings"`
+}
+
+func run(client *http.Client, c check) result {
+	res := result{Service: c.service, URL: c.url, Findings: []finding{}}
+	resp, err := client.Get(c.url)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res.Error = fmt.Sprintf("status %d", resp.StatusCode)
+		return res
+	}
+	var body interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		res.Error = "invalid JSON: " + err.Error()
+		return res
+	}
+
+	found := map[string]finding{}
+	diff("", c.expect, body, found)
+	for _, f := range found {
+		res.Findings = append(res.Findings, f)
+	}
+	sort.Slice(res.Findings, func(i, j int) bool {
+		if res.Findings[i].Path != res.Findings[j].Path {
+			return res.Findings[i].Path < res.Findings[j].Path
+		}
+		return res.Findings[i].Problem < res.Findings[j].Problem
+	})
+	return res
+}
+
+func main() {
+	id := flag.String("id", "1", "product ID to sample")
+	v1 := flag.String("v1", "http://localhost:8080", "api-gateway-v1 base URL")
+	v2 := flag.String("v2", "http://localhost:8090", "api-gateway-v2 base URL")
+	products := flag.String("products", "http://localhost:8081", "product-service base URL")
+	recs := flag.String("recommendations", "http://localhost:8082", "recommendations-service base URL")
+	skipUnreachable := flag.Bool("skip-unreachable", false, "don't fail on endpoints that can't be sampled")
+	asJSON := flag.Bool("json", false, "print results as JSON")
+	flag.Parse()
+
+	product := schemaOf(reflect.TypeOf(models.Product{}))
+	productList := &schema{kind: "array", elem: product}
+	// The product fields of a gateway's ProductDetails
+	details := &schema{kind: "object", open: true, fields: map[string]field{
+		"product":         {schema: product},
+		"recommendations": {schema: productList},
+		"timestamp":       {schema: &schema{kind: "string"}},
+	}}
+
+	path := url.PathEscape(*id)
+	checks := []check{
+		{"product-service", strings.TrimSuffix(*products, "/") + "/product/" + path, product},
+		{"product-service", strings.TrimSuffix(*products, "/") + "/products", productList},
+		{"recommendations-service", strings.TrimSuffix(*recs, "/") + "/recommendations/" + path, productList},
+		{"api-gateway-v1", strings.TrimSuffix(*v1, "/") + "/product-details/" + path, details},
+		{"api-gateway-v2", strings.TrimSuffix(*v2, "/") + "/product-details/" + path, details},
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var results []result
+	failed := false
+	for _, c := range checks {
+		res := run(client, c)
+		results = append(results, res)
+		if len(res.Findings) > 0 || res.Error != "" && !*skipUnreachable {
+			failed = true
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERVICE\tURL\tPATH\tPROBLEM\tDETAIL")
+		for _, res := range results {
+			switch {
+			case res.Error != "":
+				fmt.Fprintf(tw, "%s\t%s\t-\tunreachable\t%s\n", res.Service, res.URL, res.Error)
+			case len(res.Findings) == 0:
+				fmt.Fprintf(tw, "%s\t%s\t-\tok\t\n", res.Service, res.URL)
+			}
+			for _, f := range res.Findings {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Service, res.URL, f.Path, f.Problem, f.Detail)
+			}
+		}
+		tw.Flush()
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,200 @@
+// Command soak runs sustained traffic against a gateway for hours while
+// sampling every service's /debug/runtime endpoint (goroutines, heap,
+// open file descriptors). The final report flags metrics that grew
+// steadily over the run as suspected leaks.
+//
+// Usage:
+//
+//	soak -target http://localhost:8090 -duration 4h -rps 50 -sample 30s
+//
+// -services lists the base URLs to sample (default: the docker-compose
+// ports of all four services).
+//
+// Runs of a few minutes mostly measure warm-up (connection pools, heap
+// growth to steady state) and will flag it; soak for an hour or more.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+)
+
+// A metric is a suspected leak when the mean of each quarter of the run is
+// higher than the previous quarter's and the last quarter is at least this
+// much above the first
+const leakGrowth = 1.10
+
+var productIDs = []string{"1", "2", "3", "4", "5"}
+
+type sample struct {
+	at    time.Time
+	stats httpserver.RuntimeStats
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8090", "gateway to send traffic to")
+	services := flag.String("services",
+		"http://localhost:8080,http://localhost:8090,http://localhost:8081,http://localhost:8082",
+		"comma-separated base URLs to sample /debug/runtime from")
+	duration := flag.Duration("duration", time.Hour, "how long to run")
+	rps := flag.Int("rps", 20, "requests per second")
+	every := flag.Duration("sample", 30*time.Second, "sampling interval")
+	flag.Parse()
+
+	bases := strings.Split(*services, ",")
+	samples := map[string][]sample{}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var sent, failed atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Traffic: one request per tick, each in its own goroutine so a slow
+	// gateway doesn't lower the offered rate
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(time.Second / time.Duration(max(*rps, 1)))
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					id := productIDs[rand.IntN(len(productIDs))]
+					resp, err := client.Get(*target + "/product-details/" + id)
+					sent.Add(1)
+					if err != nil {
+						failed.Add(1)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					if resp.StatusCode >= 500 {
+						failed.Add(1)
+					}
+				}()
+			}
+		}
+	}()
+
+	log.Printf("Soaking %s at %d rps for %v, sampling every %v", *target, *rps, *duration, *every)
+	deadline := time.After(*duration)
+	tick := time.NewTicker(*every)
+	defer tick.Stop()
+	sampleAll(client, bases, samples)
+
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-tick.C:
+			sampleAll(client, bases, samples)
+			log.Printf("%d requests sent, %d failed", sent.Load(), failed.Load())
+		}
+	}
+	close(stop)
+	wg.Wait()
+	sampleAll(client, bases, samples)
+
+	fmt.Printf("\nSoak finished: %d requests, %d failed\n\n", sent.Load(), failed.Load())
+	if report(os.Stdout, bases, samples) {
+		os.Exit(1)
+	}
+}
+
+func sampleAll(client *http.Client, bases []string, samples map[string][]sample) {
+	for _, base := range bases {
+		resp, err := client.Get(base + "/debug/runtime")
+		if err != nil {
+			log.Printf("Sampling %s: %v", base, err)
+			continue
+		}
+		var st httpserver.RuntimeStats
+		err = json.NewDecoder(resp.Body).Decode(&st)
+		resp.Body.Close()
+		if err != nil {
+			log.Printf("Sampling %s: %v", base, err)
+			continue
+		}
+		samples[base] = append(samples[base], sample{at: time.Now(), stats: st})
+	}
+}
+
+// steadyGrowth reports whether values rise quarter over quarter
+func steadyGrowth(values []float64) bool {
+	if len(values) < 8 {
+		return false // Too few samples to tell growth from noise
+	}
+	var means [4]float64
+	q := len(values) / 4
+	for i := range means {
+		var sum float64
+		for _, v := range values[i*q : (i+1)*q] {
+			sum += v
+		}
+		means[i] = sum / float64(q)
+	}
+	for i := 1; i < len(means); i++ {
+		if means[i] <= means[i-1] {
+			return false
+		}
+	}
+	return means[3] >= means[0]*leakGrowth
+}
+
+// report prints first/last values per metric and returns true if any
+// metric looks like a leak
+func report(w io.Writer, bases []string, samples map[string][]sample) bool {
+	metrics := []struct {
+		name string
+		get  func(httpserver.RuntimeStats) float64
+	}{
+		{"goroutines", func(s httpserver.RuntimeStats) float64 { return float64(s.Goroutines) }},
+		{"heap_inuse_bytes", func(s httpserver.RuntimeStats) float64 { return float64(s.HeapInuse) }},
+		{"open_fds", func(s httpserver.RuntimeStats) float64 { return float64(s.OpenFDs) }},
+	}
+
+	leaks := false
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tMETRIC\tFIRST\tLAST\tSAMPLES\tVERDICT")
+	for _, base := range bases {
+		ss := samples[base]
+		if len(ss) == 0 {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t0\tno samples\n", base)
+			continue
+		}
+		for _, m := range metrics {
+			values := make([]float64, len(ss))
+			for i, s := range ss {
+				values[i] = m.get(s.stats)
+			}
+			verdict := "ok"
+			if steadyGrowth(values) {
+				verdict = "SUSPECTED LEAK"
+				leaks = true
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.0f\t%.0f\t%d\t%s\n",
+				base, m.name, values[0], values[len(values)-1], len(values), verdict)
+		}
+	}
+	tw.Flush()
+	return leaks
+}
@@ -0,0 +1,3 @@
+module github.com/afroCoderHanane/Midterm-Mastery
+
+go 1.25
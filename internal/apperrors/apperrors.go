@@ -0,0 +1,77 @@
+// Package apperrors defines the domain errors shared by the services and
+// maps them to HTTP problem responses, so callers branch on errors.Is
+// rather than on error message text.
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrNotFound: the requested entity doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrValidation: the request is malformed or fails validation
+	ErrValidation = errors.New("validation failed")
+	// ErrConflict: the request conflicts with the entity's current state
+	ErrConflict = errors.New("conflict")
+	// ErrCircuitOpen: the call was rejected by an open circuit breaker
+	ErrCircuitOpen = errors.New("circuit breaker is OPEN")
+	// ErrUpstreamTimeout: a dependency didn't answer in time
+	ErrUpstreamTimeout = errors.New("upstream timed out")
+	// ErrUpstreamUnavailable: a dependency couldn't be reached or failed
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	// ErrInvalidResponse: a dependency answered with a malformed payload
+	ErrInvalidResponse = errors.New("upstream returned an invalid response")
+)
+
+// Problem is an RFC 9457 problem document
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+var problems = []struct {
+	err     error
+	problem Problem
+}{
+	{ErrNotFound, Problem{Type: "/problems/not-found", Title: "Not found", Status: http.StatusNotFound}},
+	{ErrValidation, Problem{Type: "/problems/validation", Title: "Invalid request", Status: http.StatusBadRequest}},
+	{ErrConflict, Problem{Type: "/problems/conflict", Title: "Conflict", Status: http.StatusConflict}},
+	{ErrCircuitOpen, Problem{Type: "/problems/circuit-open", Title: "Dependency temporarily disabled", Status: http.StatusServiceUnavailable}},
+	{ErrUpstreamTimeout, Problem{Type: "/problems/upstream-timeout", Title: "Upstream timed out", Status: http.StatusGatewayTimeout}},
+	{ErrInvalidResponse, Problem{Type: "/problems/upstream-invalid-response", Title: "Upstream returned an invalid response", Status: http.StatusBadGateway}},
+	{ErrUpstreamUnavailable, Problem{Type: "/problems/upstream-unavailable", Title: "Upstream unavailable", Status: http.StatusBadGateway}},
+}
+
+var internalProblem = Problem{Type: "/problems/internal", Title: "Internal error", Status: http.StatusInternalServerError}
+
+// ProblemFor maps err to its problem document. Client errors (4xx) carry
+// the error text as detail; server errors don't, to avoid leaking internals.
+func ProblemFor(err error) Problem {
+	for _, p := range problems {
+		if errors.Is(err, p.err) {
+			problem := p.problem
+			if problem.Status < 500 {
+				problem.Detail = err.Error()
+			}
+			return problem
+		}
+	}
+	return internalProblem
+}
+
+// Write responds with the problem document for err
+func Write(w http.ResponseWriter, err error) {
+	WriteProblem(w, ProblemFor(err))
+}
+
+// WriteProblem responds with p as application/problem+json
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
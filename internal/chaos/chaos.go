@@ -0,0 +1,108 @@
+// Package chaos corrupts backend responses so the gateway's decoding
+// hardening and schema enforcement can be exercised. Like
+// SIMULATE_FAILURE, the mode is read from the environment on every request:
+//
+//	SIMULATE_CORRUPTION=malformed-json      body is no longer valid JSON
+//	SIMULATE_CORRUPTION=wrong-content-type  200 text/html proxy error page
+//	SIMULATE_CORRUPTION=truncated           connection drops mid-body
+//	SIMULATE_CORRUPTION=slow-chunked        body trickles out in small chunks
+package chaos
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Modes accepted by SIMULATE_CORRUPTION ("" or "none" disables)
+var Modes = []string{"none", "malformed-json", "wrong-content-type", "truncated", "slow-chunked"}
+
+const (
+	slowChunkSize  = 8
+	slowChunkDelay = 200 * time.Millisecond
+)
+
+// recorder buffers the wrapped handler's response so it can be mangled
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header         { return rec.header }
+func (rec *recorder) WriteHeader(status int)      { rec.status = status }
+func (rec *recorder) Write(p []byte) (int, error) { return rec.body.Write(p) }
+
+// Corrupt wraps next with the SIMULATE_CORRUPTION fault
+func Corrupt(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := os.Getenv("SIMULATE_CORRUPTION")
+		if mode == "" || mode == "none" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		body := rec.body.Bytes()
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		logging.For(r.Context(), slog.Default()).Warn("Simulating corrupt response", "mode", mode, "path", r.URL.Path)
+
+		switch mode {
+		case "malformed-json":
+			// Drop the first key/value separator: {"id" "1", ...}
+			body = bytes.Replace(body, []byte(`":`), []byte(`" `), 1)
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.WriteHeader(rec.status)
+			w.Write(body)
+
+		case "wrong-content-type":
+			page := []byte("<html><body><h1>502 Bad Gateway</h1><p>upstream proxy error</p></body></html>\n")
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(page)
+
+		case "truncated":
+			// Promise the full body, send half, then abort the connection
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.WriteHeader(rec.status)
+			w.Write(body[:len(body)/2])
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			panic(http.ErrAbortHandler)
+
+		case "slow-chunked":
+			w.Header().Del("Content-Length")
+			w.WriteHeader(rec.status)
+			rc := http.NewResponseController(w)
+			for len(body) > 0 {
+				n := min(slowChunkSize, len(body))
+				if _, err := w.Write(body[:n]); err != nil {
+					return
+				}
+				if rc.Flush() != nil {
+					return
+				}
+				body = body[n:]
+				select {
+				case <-time.After(slowChunkDelay):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+		default:
+			w.WriteHeader(rec.status)
+			w.Write(body)
+		}
+	})
+}
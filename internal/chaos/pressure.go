@@ -0,0 +1,138 @@
+package chaos
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Resource pressure simulation, for demonstrating load shedding and adaptive
+// limits in the gateway:
+//
+//	POST /admin/pressure/memory?mb=512&duration=30s  hold 512MB of resident memory
+//	POST /admin/pressure/cpu?cores=2&duration=30s    spin 2 cores
+//	GET  /admin/pressure                             what is currently running
+//
+// Pressure is released automatically once duration elapses. Memory held by
+// overlapping requests is capped at maxPressureMB in total; a request that
+// would go over it is refused with 409.
+const (
+	maxPressureMB       = 4096
+	maxPressureDuration = 5 * time.Minute
+	defaultDuration     = 30 * time.Second
+)
+
+var pressure struct {
+	memoryMB atomic.Int64
+	cpuCores atomic.Int64
+}
+
+// PressureHandler serves the /admin/pressure endpoints. Mount it behind an
+// admin gate.
+func PressureHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/pressure", pressureStatusHandler)
+	mux.HandleFunc("POST /admin/pressure/memory", memoryPressureHandler)
+	mux.HandleFunc("POST /admin/pressure/cpu", cpuPressureHandler)
+	return mux
+}
+
+func pressureStatusHandler(w http.ResponseWriter, r *http.Request) {
+	jsonutil.Write(w, http.StatusOK, map[string]int64{
+		"memory_mb": pressure.memoryMB.Load(),
+		"cpu_cores": pressure.cpuCores.Load(),
+	})
+}
+
+// parsePressure reads the size parameter and ?duration= (default 30s)
+func parsePressure(r *http.Request, param string, max int) (int, time.Duration, error) {
+	n, err := strconv.Atoi(r.URL.Query().Get(param))
+	if err != nil || n <= 0 || n > max {
+		return 0, 0, fmt.Errorf("%s must be between 1 and %d: %w", param, max, apperrors.ErrValidation)
+	}
+	d := defaultDuration
+	if v := r.URL.Query().Get("duration"); v != "" {
+		d, err = time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxPressureDuration {
+			return 0, 0, fmt.Errorf("duration must be between 0 and %v: %w", maxPressureDuration, apperrors.ErrValidation)
+		}
+	}
+	return n, d, nil
+}
+
+func memoryPressureHandler(w http.ResponseWriter, r *http.Request) {
+	mb, d, err := parsePressure(r, "mb", maxPressureMB)
+	if err != nil {
+		apperrors.Write(w, err)
+		return
+	}
+	if !reserveMemoryPressure(mb) {
+		apperrors.Write(w, fmt.Errorf("%dMB more would exceed %dMB of memory pressure in total (%dMB held): %w",
+			mb, maxPressureMB, pressure.memoryMB.Load(), apperrors.ErrConflict))
+		return
+	}
+
+	go func() {
+		slog.Warn("Simulating memory pressure", "mb", mb, "duration", d.String())
+
+		buf := make([]byte, mb<<20)
+		for i := 0; i < len(buf); i += 4096 {
+			buf[i] = 1 // Touch every page so the memory is resident
+		}
+		time.Sleep(d)
+		runtime.KeepAlive(buf)
+
+		buf = nil
+		pressure.memoryMB.Add(-int64(mb))
+		debug.FreeOSMemory()
+		slog.Info("Memory pressure released", "mb", mb)
+	}()
+
+	jsonutil.Write(w, http.StatusAccepted, map[string]interface{}{"memory_mb": mb, "duration": d.String()})
+}
+
+// reserveMemoryPressure counts mb against maxPressureMB, unless that would
+// go over it
+func reserveMemoryPressure(mb int) bool {
+	for {
+		held := pressure.memoryMB.Load()
+		if held+int64(mb) > maxPressureMB {
+			return false
+		}
+		if pressure.memoryMB.CompareAndSwap(held, held+int64(mb)) {
+			return true
+		}
+	}
+}
+
+func cpuPressureHandler(w http.ResponseWriter, r *http.Request) {
+	cores, d, err := parsePressure(r, "cores", runtime.NumCPU())
+	if err != nil {
+		apperrors.Write(w, err)
+		return
+	}
+
+	logging.For(r.Context(), slog.Default()).Warn("Simulating CPU pressure", "cores", cores, "duration", d.String())
+	deadline := time.Now().Add(d)
+	for i := 0; i < cores; i++ {
+		go func() {
+			pressure.cpuCores.Add(1)
+			defer pressure.cpuCores.Add(-1)
+			for time.Now().Before(deadline) {
+				for j := 0; j < 1e6; j++ {
+				}
+			}
+		}()
+	}
+
+	jsonutil.Write(w, http.StatusAccepted, map[string]interface{}{"cpu_cores": cores, "duration": d.String()})
+}
@@ -0,0 +1,21 @@
+package chaos
+
+import "testing"
+
+// Overlapping memory pressure requests share one maxPressureMB budget
+func TestReserveMemoryPressure(t *testing.T) {
+	t.Cleanup(func() { pressure.memoryMB.Store(0) })
+
+	if !reserveMemoryPressure(maxPressureMB - 100) {
+		t.Fatal("first reservation refused")
+	}
+	if reserveMemoryPressure(101) {
+		t.Errorf("reservation over the cap accepted, %dMB held", pressure.memoryMB.Load())
+	}
+	if !reserveMemoryPressure(100) {
+		t.Error("reservation up to the cap refused")
+	}
+	if got := pressure.memoryMB.Load(); got != maxPressureMB {
+		t.Errorf("held %dMB, want %d", got, maxPressureMB)
+	}
+}
@@ -0,0 +1,217 @@
+// Package circuitbreaker is the CLOSED / OPEN / HALF-OPEN breaker the
+// gateway wraps its upstream calls in, usable by any service in the repo.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+)
+
+// State of a circuit breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "CLOSED"
+	case StateOpen:
+		return "OPEN"
+	case StateHalfOpen:
+		return "HALF-OPEN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Config tunes a breaker. Zero fields take the DefaultConfig value.
+type Config struct {
+	MaxFailures       int           // Consecutive failures that trip the breaker
+	OpenTimeout       time.Duration // How long it stays OPEN before a trial call
+	HalfOpenSuccesses int           // Trial successes needed to close again
+
+	// OnStateChange, if set, is called (with the breaker locked; don't call
+	// back into it) on every transition
+	OnStateChange func(from, to State)
+}
+
+// DefaultConfig: trip after 3 failures, stay open for 5 seconds, close
+// after 2 successful trial calls
+func DefaultConfig() Config {
+	return Config{MaxFailures: 3, OpenTimeout: 5 * time.Second, HalfOpenSuccesses: 2}
+}
+
+// ErrCallerAbandoned wraps errors caused by the caller rather than the
+// dependency; Execute returns them without recording a failure
+var ErrCallerAbandoned = errors.New("caller abandoned the call")
+
+// CircuitBreaker implementation
+type CircuitBreaker struct {
+	mu              sync.Mutex
+	state           State
+	failureCount    int
+	successCount    int
+	lastFailureTime time.Time
+	forced          bool // Held in state by an operator (see Force)
+	failures        atomic.Int64
+
+	cfg Config
+}
+
+func NewCircuitBreaker(cfg Config) *CircuitBreaker {
+	def := DefaultConfig()
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = def.MaxFailures
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = def.OpenTimeout
+	}
+	if cfg.HalfOpenSuccesses <= 0 {
+		cfg.HalfOpenSuccesses = def.HalfOpenSuccesses
+	}
+	return &CircuitBreaker{state: StateClosed, cfg: cfg}
+}
+
+// Execute runs fn unless the breaker is OPEN, in which case it fails fast
+// with apperrors.ErrCircuitOpen
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	cb.mu.Lock()
+
+	// Check if we should transition from OPEN to HALF-OPEN
+	if cb.state == StateOpen {
+		if !cb.forced && time.Since(cb.lastFailureTime) > cb.cfg.OpenTimeout {
+			slog.Info("Circuit breaker transitioning to HALF-OPEN")
+			cb.setState(StateHalfOpen)
+			cb.successCount = 0
+		} else {
+			cb.mu.Unlock()
+			return apperrors.ErrCircuitOpen
+		}
+	}
+	cb.mu.Unlock()
+
+	// Try to execute the function
+	err := fn()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	// The caller going away (client disconnect, client deadline) says
+	// nothing about the health of the dependency, so it isn't counted
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrCallerAbandoned) {
+		return err
+	}
+
+	if err != nil {
+		cb.recordFailure()
+		return err
+	}
+
+	cb.recordSuccess()
+	return nil
+}
+
+// setState switches state and reports the transition; cb.mu must be held
+func (cb *CircuitBreaker) setState(to State) {
+	from := cb.state
+	cb.state = to
+	if cb.cfg.OnStateChange != nil && from != to {
+		cb.cfg.OnStateChange(from, to)
+	}
+}
+
+func (cb *CircuitBreaker) recordFailure() {
+	if cb.forced {
+		return
+	}
+	cb.failureCount++
+	cb.failures.Add(1)
+	cb.lastFailureTime = time.Now()
+
+	if cb.state == StateHalfOpen {
+		slog.Warn("Circuit breaker: failure in HALF-OPEN, transitioning to OPEN")
+		cb.setState(StateOpen)
+		cb.failureCount = 0
+	} else if cb.failureCount >= cb.cfg.MaxFailures {
+		slog.Warn("Circuit breaker: failure threshold reached, transitioning to OPEN", "max_failures", cb.cfg.MaxFailures)
+		cb.setState(StateOpen)
+		cb.failureCount = 0
+	}
+}
+
+func (cb *CircuitBreaker) recordSuccess() {
+	cb.failureCount = 0
+
+	if cb.state == StateHalfOpen {
+		cb.successCount++
+		if cb.successCount >= cb.cfg.HalfOpenSuccesses {
+			slog.Info("Circuit breaker: successes in HALF-OPEN, transitioning to CLOSED")
+			cb.setState(StateClosed)
+			cb.successCount = 0
+		}
+	}
+}
+
+// Force holds the breaker OPEN or CLOSED until Reset, whatever calls
+// return: a forced-open breaker never tries a half-open call, a
+// forced-closed one never trips. For incident response and testing.
+func (cb *CircuitBreaker) Force(to State) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	slog.Warn("Circuit breaker state forced", "state", to.String())
+	cb.forced = true
+	cb.failureCount, cb.successCount = 0, 0
+	cb.lastFailureTime = time.Now()
+	cb.setState(to)
+}
+
+// Reset releases a forced state and closes the breaker with clean counters
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	slog.Info("Circuit breaker reset")
+	cb.forced = false
+	cb.failureCount, cb.successCount = 0, 0
+	cb.setState(StateClosed)
+}
+
+// Forced reports whether the state is held by Force
+func (cb *CircuitBreaker) Forced() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.forced
+}
+
+// State returns the current state
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// GetState returns the current state's name, e.g. "OPEN"
+func (cb *CircuitBreaker) GetState() string {
+	return cb.State().String()
+}
+
+// Failures returns how many failures the breaker has recorded since it was
+// created. It takes no lock, so OnStateChange callbacks may call it.
+func (cb *CircuitBreaker) Failures() int64 {
+	return cb.failures.Load()
+}
+
+// Config returns the breaker's effective configuration
+func (cb *CircuitBreaker) Config() Config {
+	return cb.cfg
+}
@@ -0,0 +1,92 @@
+package circuitbreaker
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry hands out one breaker per dependency name, so every upstream
+// trips independently.
+//
+// Breakers report transitions with their own lock held, so r.mu is never
+// taken while holding a breaker's lock, nor a breaker's lock while holding
+// r.mu: onChange is read without r.mu, and States and Forced read the
+// breakers after releasing it.
+type Registry struct {
+	mu       sync.Mutex
+	cfg      Config
+	breakers map[string]*CircuitBreaker
+	onChange atomic.Pointer[func(name string, cb *CircuitBreaker, from, to State)]
+}
+
+// NewRegistry returns a registry whose breakers are built with cfg
+func NewRegistry(cfg Config) *Registry {
+	return &Registry{cfg: cfg, breakers: map[string]*CircuitBreaker{}}
+}
+
+// Get returns the breaker for name, creating it on first use
+func (r *Registry) Get(name string) *CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cb, ok := r.breakers[name]
+	if !ok {
+		cfg := r.cfg
+		own := cfg.OnStateChange
+		cfg.OnStateChange = func(from, to State) {
+			if own != nil {
+				own(from, to)
+			}
+			if fn := r.onChange.Load(); fn != nil {
+				(*fn)(name, cb, from, to)
+			}
+		}
+		cb = NewCircuitBreaker(cfg)
+		r.breakers[name] = cb
+	}
+	return cb
+}
+
+// Lookup returns the breaker for name if one exists, without creating it
+func (r *Registry) Lookup(name string) (*CircuitBreaker, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cb, ok := r.breakers[name]
+	return cb, ok
+}
+
+// OnStateChange registers fn for transitions of every breaker in the
+// registry, replacing any earlier fn. fn gets the breaker that changed, with
+// its lock held as for Config.OnStateChange.
+func (r *Registry) OnStateChange(fn func(name string, cb *CircuitBreaker, from, to State)) {
+	r.onChange.Store(&fn)
+}
+
+// snapshot copies the breakers out, so they can be read without r.mu
+func (r *Registry) snapshot() map[string]*CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.breakers)
+}
+
+// States maps every known dependency to its breaker's state name
+func (r *Registry) States() map[string]string {
+	breakers := r.snapshot()
+	states := make(map[string]string, len(breakers))
+	for name, cb := range breakers {
+		states[name] = cb.GetState()
+	}
+	return states
+}
+
+// Forced maps dependencies whose breaker is held by Force to its state name
+func (r *Registry) Forced() map[string]string {
+	forced := map[string]string{}
+	for name, cb := range r.snapshot() {
+		if cb.Forced() {
+			forced[name] = cb.GetState()
+		}
+	}
+	return forced
+}
@@ -0,0 +1,341 @@
+// Package config is the environment-variable settings table each service
+// declares, plus the --check / --check-deps / --print-effective-config
+// startup modes built on it.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Setting describes one environment variable a service reads
+type Setting struct {
+	Name     string
+	Default  string
+	Validate func(string) error // Called only when the variable is set
+	Secret   bool               // Masked by --print-effective-config
+}
+
+// Settings is a service's full table. Every variable the service reads
+// must be listed so --check can validate it.
+type Settings []Setting
+
+// Value returns the effective value of a setting: the environment variable
+// if set, otherwise its default
+func (s Settings) Value(name string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	for _, setting := range s {
+		if setting.Name == name {
+			return setting.Default
+		}
+	}
+	return ""
+}
+
+// Source reports where a setting's effective value came from
+func (s Settings) Source(name string) string {
+	if _, ok := os.LookupEnv(name); ok {
+		return "env"
+	}
+	return "default"
+}
+
+// FieldError is one invalid setting
+type FieldError struct {
+	Name   string
+	Value  string
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s=%q: %s", e.Name, e.Value, e.Reason)
+}
+
+// ValidationErrors collects every invalid setting so they can be fixed in
+// one pass
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks every variable that is set and returns all failures as
+// ValidationErrors (nil when the configuration is valid)
+func (s Settings) Validate() error {
+	var errs ValidationErrors
+	for _, setting := range s {
+		v, ok := os.LookupEnv(setting.Name)
+		if !ok || setting.Validate == nil {
+			continue
+		}
+		if err := setting.Validate(v); err != nil {
+			errs = append(errs, FieldError{Name: setting.Name, Value: v, Reason: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// MustValidate logs every invalid setting and exits. Services call it
+// after RunSelfCheck so a value --check rejects is not silently replaced
+// by a default at runtime.
+func (s Settings) MustValidate() {
+	err := s.Validate()
+	if err == nil {
+		return
+	}
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		for _, fe := range errs {
+			slog.Error("Invalid configuration", "setting", fe.Name, "value", fe.Value, "reason", fe.Reason)
+		}
+	} else {
+		slog.Error("Invalid configuration", "error", err)
+	}
+	os.Exit(1)
+}
+
+// Startup self-test flags. --check validates configuration and exits;
+// --check-deps additionally probes every dependency's /health endpoint.
+// --print-effective-config lists every setting's final value and source.
+var (
+	checkFlag       = flag.Bool("check", false, "validate configuration and exit")
+	checkDepsFlag   = flag.Bool("check-deps", false, "validate configuration, probe dependencies and exit")
+	printConfigFlag = flag.Bool("print-effective-config", false, "print effective configuration with sources and exit")
+)
+
+// RunSelfCheck exits the process if a self-test flag was given: 0 when
+// everything passed, 1 with a report of what didn't. deps maps dependency
+// names to base URLs. Call after flag.Parse.
+func RunSelfCheck(settings Settings, deps map[string]string) {
+	if *printConfigFlag {
+		settings.PrintEffective(os.Stdout)
+		os.Exit(0)
+	}
+	if !*checkFlag && !*checkDepsFlag {
+		return
+	}
+
+	failed := false
+	if err := settings.Validate(); err != nil {
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			for _, fe := range errs {
+				fmt.Printf("FAIL  config %v\n", fe)
+			}
+		} else {
+			fmt.Printf("FAIL  config: %v\n", err)
+		}
+		failed = true
+	} else {
+		fmt.Println("OK    config")
+	}
+	if *checkDepsFlag && !probeDependencies(deps) {
+		failed = true
+	}
+
+	if failed {
+		fmt.Println("Self-check FAILED")
+		os.Exit(1)
+	}
+	fmt.Println("Self-check passed")
+	os.Exit(0)
+}
+
+// PrintEffective writes one line per setting: name, effective value and
+// whether it came from the environment or the default
+func (s Settings) PrintEffective(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, setting := range s {
+		v := s.Value(setting.Name)
+		if setting.Secret && v != "" {
+			v = "********"
+		}
+		fmt.Fprintf(tw, "%s\t%q\t%s\n", setting.Name, v, s.Source(setting.Name))
+	}
+	tw.Flush()
+}
+
+func probeDependencies(deps map[string]string) bool {
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ok := true
+	client := &http.Client{Timeout: 3 * time.Second}
+	for _, name := range names {
+		base := deps[name]
+		resp, err := client.Get(strings.TrimSuffix(base, "/") + "/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+		if err != nil {
+			fmt.Printf("FAIL  dependency %s (%s): %v\n", name, base, err)
+			ok = false
+		} else {
+			fmt.Printf("OK    dependency %s (%s)\n", name, base)
+		}
+	}
+	return ok
+}
+
+// Validators
+
+func Addr(v string) error {
+	_, port, err := net.SplitHostPort(v)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func Int(min int64) func(string) error {
+	return func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		if n < min {
+			return fmt.Errorf("must be >= %d", min)
+		}
+		return nil
+	}
+}
+
+func Float(min, max float64) func(string) error {
+	return func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("not a number")
+		}
+		if f < min || f > max {
+			return fmt.Errorf("must be between %v and %v", min, max)
+		}
+		return nil
+	}
+}
+
+func Bool(v string) error {
+	if v != "true" && v != "false" {
+		return fmt.Errorf("must be true or false")
+	}
+	return nil
+}
+
+func Enum(allowed ...string) func(string) error {
+	return func(v string) error {
+		for _, a := range allowed {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+func Duration(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("must be positive")
+	}
+	return nil
+}
+
+// DurationOrZero is Duration for settings where 0 means off
+func DurationOrZero(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+// Optional accepts an empty value (setting off), and otherwise anything
+// validate does
+func Optional(validate func(string) error) func(string) error {
+	return func(v string) error {
+		if v == "" {
+			return nil
+		}
+		return validate(v)
+	}
+}
+
+// URL accepts an empty value (optional setting) or an absolute http(s) URL
+func URL(v string) error {
+	if v == "" {
+		return nil
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+// KeyValueList accepts an empty value (optional setting) or "k1=v1,k2=v2"
+func KeyValueList(v string) error {
+	if v == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		if k, _, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("entry %q is not key=value", pair)
+		}
+	}
+	return nil
+}
+
+// WritablePath checks the file's directory exists and is writable
+func WritablePath(v string) error {
+	dir := filepath.Dir(v)
+	f, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s not writable: %v", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import "testing"
+
+// Empty is the default of these settings and means off, so setting it
+// explicitly must pass validation too
+func TestValidatorsAcceptEmptyOptional(t *testing.T) {
+	validators := map[string]func(string) error{
+		"KeyValueList":           KeyValueList,
+		"URL":                    URL,
+		"Optional(Duration)":     Optional(Duration),
+		"Optional(WritablePath)": Optional(WritablePath),
+	}
+	for name, validate := range validators {
+		if err := validate(""); err != nil {
+			t.Errorf("%s(\"\") = %v, want nil", name, err)
+		}
+	}
+}
+
+func TestValidatorsRejectInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate func(string) error
+		value    string
+	}{
+		{"KeyValueList", KeyValueList, "a=1,b"},
+		{"KeyValueList", KeyValueList, ","},
+		{"Optional(Duration)", Optional(Duration), "soon"},
+		{"Optional(Duration)", Optional(Duration), "0s"},
+		{"DurationOrZero", DurationOrZero, "-1s"},
+	}
+	for _, tt := range tests {
+		if err := tt.validate(tt.value); err == nil {
+			t.Errorf("%s(%q) = nil, want an error", tt.name, tt.value)
+		}
+	}
+}
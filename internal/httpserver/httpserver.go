@@ -0,0 +1,81 @@
+// Package httpserver is the server scaffolding shared by the services
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+)
+
+// HealthHandler reports that the process is up, or 503 once it has started
+// shutting down
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	if Draining() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// RuntimeStats is served on /debug/runtime for leak hunting (cmd/soak)
+type RuntimeStats struct {
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapInuse  uint64 `json:"heap_inuse_bytes"`
+	OpenFDs    int    `json:"open_fds"` // -1 where /proc isn't available
+
+	WatchdogFired int64 `json:"watchdog_fired"` // Requests cancelled by Watchdog
+}
+
+// RuntimeHandler reports goroutine count, heap size and open file
+// descriptors
+func RuntimeHandler(w http.ResponseWriter, r *http.Request) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	stats := RuntimeStats{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  ms.HeapAlloc,
+		HeapInuse:  ms.HeapInuse,
+		OpenFDs:    -1,
+
+		WatchdogFired: WatchdogFired(),
+	}
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		stats.OpenFDs = len(fds)
+	}
+
+	jsonutil.Write(w, http.StatusOK, stats)
+}
+
+// RequireToken gates next behind "Authorization: Bearer <token>". An empty
+// token means admin access isn't configured and the endpoint stays closed.
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireTokenForWrites is RequireToken for every method but GET and HEAD,
+// for endpoints whose status is public but whose controls are not
+func RequireTokenForWrites(token string, next http.Handler) http.Handler {
+	gated := RequireToken(token, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gated.ServeHTTP(w, r)
+	})
+}
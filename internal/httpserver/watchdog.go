@@ -0,0 +1,100 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Slow-request watchdog. A request still running after WATCHDOG_THRESHOLD
+// (default 10s) is presumed hung: the watchdog logs the stack of the
+// goroutine handling it, so the log shows where it is stuck, then cancels
+// the request's context so calls honouring it give up. Each firing is
+// counted in /debug/runtime (watchdog_fired).
+//
+// The watchdog can't stop a handler that ignores its context; the stack
+// dump is what tells you it does. Handlers that are meant to run long
+// (event streams, WebSockets) call LongLived to disarm it.
+
+const defaultWatchdogThreshold = 10 * time.Second
+
+var watchdogFired atomic.Int64
+
+// WatchdogFired returns how many requests the watchdog has cancelled
+func WatchdogFired() int64 {
+	return watchdogFired.Load()
+}
+
+type watchdogKey struct{}
+
+// LongLived disarms the watchdog for the request running with ctx, for
+// handlers that hold the connection open on purpose. It does nothing
+// outside Watchdog.
+func LongLived(ctx context.Context) {
+	if stop, ok := ctx.Value(watchdogKey{}).(func() bool); ok {
+		stop()
+	}
+}
+
+// Watchdog wraps next with the slow-request watchdog
+func Watchdog(next http.Handler) http.Handler {
+	threshold := envDuration("WATCHDOG_THRESHOLD", defaultWatchdogThreshold)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		gid := goroutineID()
+		start := time.Now()
+		timer := time.AfterFunc(threshold, func() {
+			watchdogFired.Add(1)
+			logging.For(ctx, slog.Default()).Error("Watchdog: request exceeded threshold, cancelling",
+				"method", r.Method, "path", r.URL.Path, "threshold", threshold.String(),
+				"elapsed_ms", time.Since(start).Milliseconds(), "goroutine", gid, "stack", goroutineStack(gid))
+			cancel()
+		})
+		defer timer.Stop()
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, watchdogKey{}, timer.Stop)))
+	})
+}
+
+// goroutineID parses the calling goroutine's ID from its stack header,
+// "goroutine 42 [running]:"
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+// goroutineStack returns the stack of goroutine id, or "" if it has
+// exited. Only all goroutines can be dumped, so the dump is searched.
+func goroutineStack(id uint64) string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	header := []byte("goroutine " + strconv.FormatUint(id, 10) + " [")
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, header) {
+			return string(stack)
+		}
+	}
+	return ""
+}
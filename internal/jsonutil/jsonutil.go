@@ -0,0 +1,17 @@
+// Package jsonutil has the small JSON response helpers used by the services
+package jsonutil
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Write sends v as a JSON response with the given status
+func Write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding JSON response", "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Availability statuses, in lifecycle order
+const (
+	StatusUnreleased   = "unreleased"   // Announced, not yet orderable
+	StatusPreorder     = "preorder"     // Orderable, ships on the release date
+	StatusAvailable    = "available"    // Released
+	StatusDiscontinued = "discontinued" // Past end-of-life
+)
+
+// DateLayout is the format of availability dates (calendar days, UTC)
+const DateLayout = "2006-01-02"
+
+// Availability is a product's sales window. Empty dates are open-ended: a
+// product with no release date is available from the start, one with no
+// end-of-life never goes away. Status is derived from the dates by the
+// service that serves the product.
+type Availability struct {
+	PreorderDate string `json:"preorder_date,omitempty" xml:"preorder_date,omitempty"`
+	ReleaseDate  string `json:"release_date,omitempty" xml:"release_date,omitempty"`
+	EndOfLife    string `json:"end_of_life,omitempty" xml:"end_of_life,omitempty"`
+	Status       string `json:"status" xml:"status"`
+}
+
+// DaysFromNow returns the calendar date n days from today, for seed data
+// that must stay in the future however long the demo has been around
+func DaysFromNow(n int) string {
+	return time.Now().UTC().AddDate(0, 0, n).Format(DateLayout)
+}
+
+// Validate checks the dates parse and are in order
+func (a *Availability) Validate() error {
+	var prev time.Time
+	var prevName string
+	for _, d := range []struct{ name, value string }{
+		{"preorder_date", a.PreorderDate},
+		{"release_date", a.ReleaseDate},
+		{"end_of_life", a.EndOfLife},
+	} {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.Parse(DateLayout, d.value)
+		if err != nil {
+			return fmt.Errorf("%s %q is not a YYYY-MM-DD date", d.name, d.value)
+		}
+		if !prev.IsZero() && t.Before(prev) {
+			return fmt.Errorf("%s %s is before %s %s", d.name, d.value, prevName, prev.Format(DateLayout))
+		}
+		prev, prevName = t, d.name
+	}
+	return nil
+}
+
+// StatusAt returns the availability status on the day of t. Dates that
+// don't parse are treated as unset; Validate catches them on the way in.
+func (a *Availability) StatusAt(t time.Time) string {
+	day := t.UTC().Format(DateLayout) // Same layout, so dates compare as strings
+	switch {
+	case a.EndOfLife != "" && day >= a.EndOfLife:
+		return StatusDiscontinued
+	case a.ReleaseDate == "" || day >= a.ReleaseDate:
+		return StatusAvailable
+	case a.PreorderDate != "" && day >= a.PreorderDate:
+		return StatusPreorder
+	}
+	return StatusUnreleased
+}
+
+// Unreleased reports whether a product can't ship yet (unreleased or
+// preorder)
+func (a *Availability) Unreleased(t time.Time) bool {
+	status := a.StatusAt(t)
+	return status == StatusUnreleased || status == StatusPreorder
+}
+
+// WithStatus returns p with its availability status computed for t. The
+// Availability is copied, so p may come from a shared table.
+func (p Product) WithStatus(t time.Time) Product {
+	if p.Availability != nil {
+		a := *p.Availability
+		a.Status = a.StatusAt(t)
+		p.Availability = &a
+	}
+	return p
+}
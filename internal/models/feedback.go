@@ -0,0 +1,20 @@
+package models
+
+// Feedback events on a recommended product
+const (
+	FeedbackClick    = "click"
+	FeedbackPurchase = "purchase"
+)
+
+// DefaultStrategy labels recommendations not produced under an experiment
+const DefaultStrategy = "default"
+
+// Feedback reports that a user acted on a recommendation: RecommendedID was
+// shown on ProductID's page and was clicked or bought. Sent by clients to
+// the gateway, which forwards it to recommendations-service.
+type Feedback struct {
+	ProductID     string `json:"product_id"`
+	RecommendedID string `json:"recommended_id"`
+	Event         string `json:"event"`              // FeedbackClick or FeedbackPurchase
+	Strategy      string `json:"strategy,omitempty"` // Empty means DefaultStrategy
+}
@@ -0,0 +1,28 @@
+// Package models holds the data shapes shared by every service, so the
+// product-service, recommendations-service and both gateways agree on the
+// wire format.
+package models
+
+// Product is a catalog entry as served by product-service and embedded in
+// recommendations and gateway responses
+type Product struct {
+	ID          string  `json:"id" xml:"id"`
+	Name        string  `json:"name" xml:"name"`
+	Price       float64 `json:"price" xml:"price"`
+	Description string  `json:"description" xml:"description"`
+	Category    string  `json:"category,omitempty" xml:"category,omitempty"`
+
+	// Sales window; nil for products that are simply always available
+	Availability *Availability `json:"availability,omitempty" xml:"availability,omitempty"`
+
+	// Parts of a bundle (kit). product-service derives a bundle's price and
+	// availability from its components; nil for ordinary products.
+	Components []BundleComponent `json:"components,omitempty" xml:"components>component,omitempty"`
+}
+
+// BundleComponent is one part of a bundle. Components may be bundles
+// themselves, as long as no bundle ends up containing itself.
+type BundleComponent struct {
+	ProductID string `json:"product_id" xml:"product_id"`
+	Quantity  int    `json:"quantity" xml:"quantity"`
+}
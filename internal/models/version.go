@@ -0,0 +1,173 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Product model versions. Version 1 is Product as it has always been sent:
+// a float price and a single category. Version 2 carries the price as
+// Money, exact in minor units, and a list of categories:
+//
+//	{"id": "1", "name": "Laptop", "price": {"amount": 99999, "currency": "USD"}, "categories": ["computers"], ...}
+//
+// Product stays the in-memory shape everywhere. Decoders accept either
+// version, so a consumer keeps working when its producer moves to v2.
+// Producers encode the version the client asks for in the
+// ProductVersionHeader request header (default 1) and echo it in the
+// response, so each client migrates when it is ready. Until Product holds
+// them, v2 prices in a currency other than DefaultCurrency and more than one
+// category are rejected on decode rather than silently dropped.
+
+const (
+	ProductVersionHeader = "X-Product-Version"
+
+	ProductV1 = 1
+	ProductV2 = 2
+)
+
+// DefaultCurrency is the currency of v1 prices
+const DefaultCurrency = "USD"
+
+// Money is an exact amount in the currency's minor units (cents)
+type Money struct {
+	Amount   int64  `json:"amount" xml:"amount"`
+	Currency string `json:"currency" xml:"currency"`
+}
+
+// ProductV2Shape is the version 2 wire shape of a Product
+type ProductV2Shape struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Price        Money             `json:"price"`
+	Description  string            `json:"description"`
+	Categories   []string          `json:"categories,omitempty"`
+	Availability *Availability     `json:"availability,omitempty"`
+	Components   []BundleComponent `json:"components,omitempty"`
+}
+
+// ParseProductVersion reads a ProductVersionHeader value; empty means v1
+func ParseProductVersion(v string) (int, error) {
+	switch strings.TrimPrefix(strings.TrimSpace(v), "v") {
+	case "", "1":
+		return ProductV1, nil
+	case "2":
+		return ProductV2, nil
+	}
+	return 0, fmt.Errorf("unsupported product version %q, want 1 or 2", v)
+}
+
+// V2 converts p to the version 2 shape
+func (p Product) V2() ProductV2Shape {
+	v2 := ProductV2Shape{
+		ID:           p.ID,
+		Name:         p.Name,
+		Price:        Money{Amount: int64(math.Round(p.Price * 100)), Currency: DefaultCurrency},
+		Description:  p.Description,
+		Availability: p.Availability,
+		Components:   p.Components,
+	}
+	if p.Category != "" {
+		v2.Categories = []string{p.Category}
+	}
+	return v2
+}
+
+// Product converts a version 2 product back to the in-memory shape
+func (v2 ProductV2Shape) Product() Product {
+	p := Product{
+		ID:           v2.ID,
+		Name:         v2.Name,
+		Price:        float64(v2.Price.Amount) / 100,
+		Description:  v2.Description,
+		Availability: v2.Availability,
+		Components:   v2.Components,
+	}
+	if len(v2.Categories) > 0 {
+		p.Category = v2.Categories[0]
+	}
+	return p
+}
+
+// check rejects what Product can't hold. An empty currency is
+// DefaultCurrency.
+func (v2 ProductV2Shape) check() error {
+	if c := v2.Price.Currency; c != "" && c != DefaultCurrency {
+		return fmt.Errorf("price currency %q is not supported, only %s", c, DefaultCurrency)
+	}
+	if len(v2.Categories) > 1 {
+		return fmt.Errorf("%d categories given, only one is supported", len(v2.Categories))
+	}
+	return nil
+}
+
+// Encode returns what to marshal for p in the given version
+func Encode(version int, p Product) interface{} {
+	if version == ProductV2 {
+		return p.V2()
+	}
+	return p
+}
+
+// EncodeList is Encode for a list of products
+func EncodeList(version int, products []Product) interface{} {
+	if version != ProductV2 {
+		return products
+	}
+	out := make([]ProductV2Shape, len(products))
+	for i, p := range products {
+		out[i] = p.V2()
+	}
+	return out
+}
+
+// DecodeProduct decodes a product in either version, telling them apart by
+// the type of price. With strict set, fields neither version has are an
+// error, like json.Decoder.DisallowUnknownFields.
+func DecodeProduct(data []byte, strict bool) (Product, error) {
+	var probe struct {
+		Price json.RawMessage `json:"price"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Product{}, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(probe.Price), []byte("{")) {
+		var v2 ProductV2Shape
+		err := decode(data, &v2, strict)
+		if err == nil {
+			err = v2.check()
+		}
+		return v2.Product(), err
+	}
+	var p Product
+	err := decode(data, &p, strict)
+	return p, err
+}
+
+// DecodeProducts decodes a JSON array of products, each in either version
+func DecodeProducts(data []byte, strict bool) ([]Product, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	products := make([]Product, len(raw))
+	for i, r := range raw {
+		p, err := DecodeProduct(r, strict)
+		if err != nil {
+			return nil, err
+		}
+		products[i] = p
+	}
+	return products, nil
+}
+
+func decode(data []byte, v interface{}, strict bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
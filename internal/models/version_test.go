@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestDecodeProductV2(t *testing.T) {
+	p, err := DecodeProduct([]byte(`{"id": "1", "name": "Laptop", "price": {"amount": 99999, "currency": "USD"}, "categories": ["computers"]}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Price != 999.99 || p.Category != "computers" {
+		t.Errorf("got %+v, want price 999.99 in computers", p)
+	}
+}
+
+// What Product can't hold is an error, not silently dropped
+func TestDecodeProductV2Unsupported(t *testing.T) {
+	tests := map[string]string{
+		"currency":   `{"id": "1", "name": "Laptop", "price": {"amount": 99999, "currency": "EUR"}}`,
+		"categories": `{"id": "1", "name": "Laptop", "price": {"amount": 99999, "currency": "USD"}, "categories": ["computers", "sale"]}`,
+	}
+	for name, body := range tests {
+		if p, err := DecodeProduct([]byte(body), false); err == nil {
+			t.Errorf("%s: decoded %+v, want an error", name, p)
+		}
+	}
+}
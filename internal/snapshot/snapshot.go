@@ -0,0 +1,128 @@
+// Package snapshot serves the /admin/snapshot and /admin/restore endpoints
+// the backends use to download and reload their in-memory state, so a demo
+// environment can be cloned or rolled back.
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Version of the snapshot envelope. Bump when the envelope or a service's
+// state layout changes incompatibly; restore rejects other versions.
+const Version = 1
+
+// Largest snapshot accepted by /admin/restore
+const maxSnapshotBytes = 32 << 20
+
+// Snapshot is the downloadable envelope. Checksum is the hex SHA-256 of
+// State exactly as serialized.
+type Snapshot struct {
+	Version   int             `json:"version"`
+	Service   string          `json:"service"`
+	CreatedAt time.Time       `json:"created_at"`
+	Checksum  string          `json:"checksum"`
+	State     json.RawMessage `json:"state"`
+}
+
+// State is implemented by each service. Dump returns a consistent copy of
+// the state; Restore validates and swaps it in atomically.
+type State interface {
+	Dump() interface{}
+	Restore(data json.RawMessage) error
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Handler serves GET /admin/snapshot and POST /admin/restore for service.
+// Mount it behind an admin gate.
+func Handler(service string, state State) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /admin/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(state.Dump())
+		if err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+		snap := Snapshot{
+			Version:   Version,
+			Service:   service,
+			CreatedAt: time.Now().UTC(),
+			Checksum:  checksum(data),
+			State:     data,
+		}
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s-%s.json"`, service, snap.CreatedAt.Format("20060102T150405Z")))
+		jsonutil.Write(w, http.StatusOK, snap)
+	})
+
+	mux.HandleFunc("POST /admin/restore", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSnapshotBytes+1))
+		if err != nil {
+			apperrors.Write(w, fmt.Errorf("reading snapshot: %v: %w", err, apperrors.ErrValidation))
+			return
+		}
+		if len(body) > maxSnapshotBytes {
+			apperrors.Write(w, fmt.Errorf("snapshot larger than %d bytes: %w", maxSnapshotBytes, apperrors.ErrValidation))
+			return
+		}
+
+		var snap Snapshot
+		if err := json.Unmarshal(body, &snap); err != nil {
+			apperrors.Write(w, fmt.Errorf("invalid snapshot JSON: %v: %w", err, apperrors.ErrValidation))
+			return
+		}
+		if err := verify(service, snap); err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+		if err := state.Restore(snap.State); err != nil {
+			apperrors.Write(w, fmt.Errorf("restoring state: %v: %w", err, apperrors.ErrValidation))
+			return
+		}
+
+		logging.For(r.Context(), slog.Default()).Info("Restored state from snapshot", "snapshot_created_at", snap.CreatedAt.Format(time.RFC3339))
+		jsonutil.Write(w, http.StatusOK, map[string]interface{}{
+			"restored":   true,
+			"created_at": snap.CreatedAt,
+			"checksum":   snap.Checksum,
+		})
+	})
+
+	return mux
+}
+
+// verify checks the envelope before any state is touched
+func verify(service string, snap Snapshot) error {
+	switch {
+	case snap.Version != Version:
+		return fmt.Errorf("snapshot version %d, want %d: %w", snap.Version, Version, apperrors.ErrValidation)
+	case snap.Service != service:
+		return fmt.Errorf("snapshot is for %q, not %q: %w", snap.Service, service, apperrors.ErrValidation)
+	}
+	// State is kept as the raw bytes that were hashed, but a client may have
+	// re-indented the file; compare against the compacted form too
+	if checksum(snap.State) == snap.Checksum {
+		return nil
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, snap.State) == nil && checksum(compact.Bytes()) == snap.Checksum {
+		return nil
+	}
+	return fmt.Errorf("snapshot checksum mismatch: %w", apperrors.ErrValidation)
+}
@@ -1,5 +1,10 @@
-from locust import HttpUser, task, between
+from locust import HttpUser, task, between, constant
+from locust.exception import StopUser
+import json
+import os
 import random
+import time
+from datetime import datetime
 
 class EcommerceUser(HttpUser):
     """
@@ -36,6 +41,123 @@ class EcommerceUser(HttpUser):
         pass
 
 
+# Replay mode: re-issue recorded traffic (gateway debug captures, optionally
+# scrubbed with cmd/anonymize-captures) against a recovery environment.
+REPLAY_FILE = os.environ.get("REPLAY_FILE")
+REPLAY_SPEED = float(os.environ.get("REPLAY_SPEED", "1.0"))  # 2.0 = twice as fast
+
+# Fields that legitimately differ between the recording and the replay
+VOLATILE_FIELDS = {"timestamp"}
+
+
+def load_replay_records(path):
+    """Read captures (one JSON object per line, log prefixes allowed), keep
+    those with a recorded response, and compute each one's offset in seconds
+    from the first request."""
+    records = []
+    with open(path) as f:
+        for line in f:
+            start = line.find("{")
+            if start < 0:
+                continue
+            try:
+                rec = json.loads(line[start:])
+            except ValueError:
+                continue
+            if "method" in rec and "url" in rec and "response" in rec:
+                records.append(rec)
+
+    def ts(rec):
+        try:
+            return datetime.fromisoformat(rec["timestamp"].replace("Z", "+00:00")).timestamp()
+        except (KeyError, ValueError):
+            return None
+
+    stamps = [ts(r) for r in records]
+    if records and all(s is not None for s in stamps):
+        first = min(stamps)
+        for rec, stamp in zip(records, stamps):
+            rec["offset"] = stamp - first
+        records.sort(key=lambda r: r["offset"])
+    else:
+        # No usable timestamps: replay back to back
+        for rec in records:
+            rec["offset"] = 0.0
+    return records
+
+
+def strip_volatile(node):
+    if isinstance(node, dict):
+        return {k: strip_volatile(v) for k, v in node.items() if k not in VOLATILE_FIELDS}
+    if isinstance(node, list):
+        return [strip_volatile(v) for v in node]
+    return node
+
+
+def comparable_body(body):
+    """Recorded bodies that were redacted or not JSON can't be compared."""
+    if body is None or isinstance(body, str):
+        return False
+    return "[REDACTED]" not in json.dumps(body)
+
+
+class ReplayUser(HttpUser):
+    """
+    Replays REPLAY_FILE at the recorded pace scaled by REPLAY_SPEED, and fails
+    any request whose status or (non-volatile) JSON body differs from the
+    recording. Run enough users to cover the recording's peak concurrency.
+    """
+
+    abstract = not REPLAY_FILE
+    wait_time = constant(0)
+
+    records = load_replay_records(REPLAY_FILE) if REPLAY_FILE else []
+    next_index = 0  # Shared by all users (gevent: no real concurrency)
+    started_at = None
+
+    @task
+    def replay_next(self):
+        cls = ReplayUser
+        if cls.next_index >= len(cls.records):
+            raise StopUser()
+        rec = cls.records[cls.next_index]
+        cls.next_index += 1
+
+        if cls.started_at is None:
+            cls.started_at = time.time()
+        delay = cls.started_at + rec["offset"] / REPLAY_SPEED - time.time()
+        if delay > 0:
+            time.sleep(delay)
+
+        expected = rec["response"]
+        headers = {
+            k: v[0] for k, v in rec.get("request", {}).get("headers", {}).items()
+            if v and v[0] != "[REDACTED]" and k.lower() not in ("host", "content-length", "connection")
+        }
+
+        with self.client.request(
+            rec["method"],
+            rec["url"],
+            headers=headers,
+            catch_response=True,
+            name="replay " + rec["url"].split("?")[0].rsplit("/", 1)[0] + "/[id]",
+        ) as response:
+            if response.status_code != expected.get("status", 200):
+                response.failure(f"status {response.status_code}, recorded {expected.get('status')}")
+                return
+            body = expected.get("body")
+            if comparable_body(body):
+                try:
+                    actual = response.json()
+                except ValueError:
+                    response.failure("recorded JSON, got non-JSON body")
+                    return
+                if strip_volatile(actual) != strip_volatile(body):
+                    response.failure("body differs from recorded baseline")
+                    return
+            response.success()
+
+
 """
 USAGE INSTRUCTIONS:
 
@@ -50,6 +172,9 @@ USAGE INSTRUCTIONS:
    For testing WITH circuit breaker (should be resilient):
    locust -f locustfile.py --host=http://localhost:8080 --users 100 --spawn-rate 10 --run-time 2m --headless
 
+   Replaying recorded traffic against a recovery environment:
+   REPLAY_FILE=captures.jsonl REPLAY_SPEED=2 locust -f locustfile.py ReplayUser --host=http://localhost:8090 --users 20 --spawn-rate 20 --headless
+
 3. Or run with Web UI (recommended for visualization):
    locust -f locustfile.py --host=http://localhost:8080
    
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Bundles (kits) are products made of other products. A bundle's price is
+// the sum of its components' prices times quantity, and its sales window is
+// the intersection of theirs: orderable once every component is, released
+// once every component is, discontinued as soon as any component is. Price
+// and availability stored on a bundle itself are ignored.
+
+var errBundleCycle = errors.New("bundle contains itself")
+
+// resolveProduct looks up id with bundle fields derived and the
+// availability status computed for now
+func resolveProduct(id string, now time.Time) (models.Product, bool, error) {
+	p, ok := catalog.Get(id)
+	if !ok {
+		return models.Product{}, false, nil
+	}
+	p, err := resolveBundle(catalog.Get, p, map[string]bool{})
+	if err != nil {
+		return models.Product{}, true, err
+	}
+	return p.WithStatus(now), true, nil
+}
+
+// resolveBundle derives p's price and window from its components, as
+// returned by lookup. path holds the bundles being resolved above p.
+func resolveBundle(lookup func(string) (models.Product, bool), p models.Product, path map[string]bool) (models.Product, error) {
+	if len(p.Components) == 0 {
+		return p, nil
+	}
+	if path[p.ID] {
+		return p, fmt.Errorf("%w: %s", errBundleCycle, p.ID)
+	}
+	path[p.ID] = true
+	defer delete(path, p.ID)
+
+	var price float64
+	var window models.Availability
+	windowed := false
+	for _, c := range p.Components {
+		if c.Quantity < 1 {
+			return p, fmt.Errorf("bundle %s: component %q has quantity %d", p.ID, c.ProductID, c.Quantity)
+		}
+		part, ok := lookup(c.ProductID)
+		if !ok {
+			return p, fmt.Errorf("bundle %s: component %q is not in the catalog", p.ID, c.ProductID)
+		}
+		part, err := resolveBundle(lookup, part, path)
+		if err != nil {
+			return p, err
+		}
+		price += part.Price * float64(c.Quantity)
+
+		a := part.Availability
+		if a == nil {
+			continue
+		}
+		windowed = true
+		orderable := a.PreorderDate
+		if orderable == "" {
+			orderable = a.ReleaseDate
+		}
+		window.PreorderDate = max(window.PreorderDate, orderable)
+		window.ReleaseDate = max(window.ReleaseDate, a.ReleaseDate)
+		if a.EndOfLife != "" && (window.EndOfLife == "" || a.EndOfLife < window.EndOfLife) {
+			window.EndOfLife = a.EndOfLife
+		}
+	}
+
+	p.Price = math.Round(price*100) / 100
+	p.Availability = nil
+	if windowed {
+		p.Availability = &window
+	}
+	return p, nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/chaos"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Environment variables read by the service
+var settings = config.Settings{
+	{Name: "LISTEN_ADDR", Default: ":8081", Validate: config.Addr},
+	{Name: "SIMULATE_CORRUPTION", Default: "none", Validate: config.Enum(chaos.Modes...)},
+	{Name: "DATABASE_URL", Default: "", Validate: validDatabaseURL}, // memory: or file:/path (unset = memory)
+	{Name: "ADMIN_TOKEN", Secret: true},                             // Bearer token for /admin/ endpoints (unset = disabled)
+	{Name: "LOG_FORMAT", Default: "json", Validate: config.Enum(logging.Formats...)},
+	{Name: "LOG_LEVEL", Default: "info", Validate: config.Enum(logging.Levels...)},
+	{Name: "SHUTDOWN_TIMEOUT", Default: "15s", Validate: config.Duration},
+	{Name: "SHUTDOWN_DELAY", Default: "0s", Validate: config.DurationOrZero},
+	{Name: "WATCHDOG_THRESHOLD", Default: "10s", Validate: config.Duration},
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Catalog API:
+//
+//	GET    /products      every product, sorted by ID
+//	GET    /products/search  filtered, sorted and paged (search.go)
+//	POST   /product       create; 409 if the ID is taken
+//	GET    /product/{id}
+//	PUT    /product/{id}  replace; the body's id must be empty or match
+//	DELETE /product/{id}  409 while a bundle contains it
+//
+// Products are returned as served by GET, with bundle price and
+// availability status derived, in the model version the client asks for in
+// X-Product-Version (internal/models/version.go). Bodies may be in either
+// version. Every change is pushed to /ws subscribers (live.go). POST, PUT
+// and DELETE need the admin token (ADMIN_TOKEN).
+
+const maxProductBody = 64 << 10
+
+// productHandler routes /product/{id} by method
+func productHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getProductHandler(w, r)
+	case http.MethodPut:
+		updateProductHandler(w, r)
+	case http.MethodDelete:
+		deleteProductHandler(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func decodeProduct(w http.ResponseWriter, r *http.Request) (models.Product, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProductBody))
+	if err != nil {
+		return models.Product{}, fmt.Errorf("reading product: %v: %w", err, apperrors.ErrValidation)
+	}
+	p, err := models.DecodeProduct(data, false)
+	if err != nil {
+		return p, fmt.Errorf("invalid product JSON: %v: %w", err, apperrors.ErrValidation)
+	}
+	return p, nil
+}
+
+// productVersion is the product model version the client asked for,
+// echoed in the response. It writes the error response if there is none.
+func productVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v, err := models.ParseProductVersion(r.Header.Get(models.ProductVersionHeader))
+	if err != nil {
+		apperrors.Write(w, fmt.Errorf("%v: %w", err, apperrors.ErrValidation))
+		return 0, false
+	}
+	w.Header().Set(models.ProductVersionHeader, strconv.Itoa(v))
+	return v, true
+}
+
+// writeProduct responds with product id as GET /product/{id} serves it
+func writeProduct(w http.ResponseWriter, status, version int, id string) {
+	p, _, err := resolveProduct(id, time.Now())
+	if err != nil {
+		apperrors.Write(w, fmt.Errorf("product %q: %v", id, err))
+		return
+	}
+	jsonutil.Write(w, status, models.Encode(version, p))
+}
+
+func createProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := productVersion(w, r)
+	if !ok {
+		return
+	}
+	p, err := decodeProduct(w, r)
+	if err == nil {
+		err = catalog.Create(p)
+	}
+	if err != nil {
+		apperrors.Write(w, err)
+		return
+	}
+	logging.For(r.Context(), slog.Default()).Info("Product created", "product_id", p.ID)
+	productChanged(p.ID)
+	w.Header().Set("Location", "/product/"+url.PathEscape(p.ID))
+	writeProduct(w, http.StatusCreated, version, p.ID)
+}
+
+func updateProductHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/product/"))
+	version, ok := productVersion(w, r)
+	if !ok {
+		return
+	}
+	p, err := decodeProduct(w, r)
+	if err != nil {
+		apperrors.Write(w, err)
+		return
+	}
+	if p.ID == "" {
+		p.ID = id
+	}
+	if p.ID != id {
+		apperrors.Write(w, fmt.Errorf("body id %q doesn't match path id %q: %w", p.ID, id, apperrors.ErrValidation))
+		return
+	}
+	if err := catalog.Update(p); err != nil {
+		apperrors.Write(w, err)
+		return
+	}
+	logging.For(r.Context(), slog.Default()).Info("Product updated", "product_id", id)
+	productChanged(id)
+	writeProduct(w, http.StatusOK, version, id)
+}
+
+func deleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/product/"))
+	if err := catalog.Delete(id); err != nil {
+		apperrors.Write(w, err)
+		return
+	}
+	logging.For(r.Context(), slog.Default()).Info("Product deleted", "product_id", id)
+	productDeleted(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := productVersion(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	list := catalog.List()
+	for i, p := range list {
+		resolved, err := resolveBundle(catalog.Get, p, map[string]bool{})
+		if err != nil {
+			apperrors.Write(w, fmt.Errorf("product %q: %v", p.ID, err))
+			return
+		}
+		list[i] = resolved.WithStatus(now)
+	}
+	jsonutil.Write(w, http.StatusOK, models.EncodeList(version, list))
+}
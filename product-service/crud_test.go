@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// A v2 body the catalog can't store exactly is refused with a 400 and
+// leaves the product unchanged
+func TestV2WriteRejectsUnsupportedFields(t *testing.T) {
+	saved := catalog
+	catalog = newMemoryStore(seedProducts)
+	t.Cleanup(func() { catalog = saved })
+
+	tests := []struct {
+		name, method, path, body string
+	}{
+		{"create in EUR", http.MethodPost, "/product",
+			`{"id": "new", "name": "Lamp", "price": {"amount": 1999, "currency": "EUR"}}`},
+		{"update with two categories", http.MethodPut, "/product/1",
+			`{"name": "Laptop", "price": {"amount": 99999, "currency": "USD"}, "categories": ["computers", "sale"]}`},
+	}
+	for _, tt := range tests {
+		before, _ := catalog.Get("1")
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set(models.ProductVersionHeader, "2")
+		rec := httptest.NewRecorder()
+		if tt.method == http.MethodPost {
+			createProductHandler(rec, req)
+		} else {
+			productHandler(rec, req)
+		}
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400; body %s", tt.name, rec.Code, rec.Body)
+		}
+		var problem struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || problem.Type == "" {
+			t.Errorf("%s: body %q is not a problem document", tt.name, rec.Body)
+		}
+		if _, ok := catalog.Get("new"); ok {
+			t.Errorf("%s: product created", tt.name)
+		}
+		if after, _ := catalog.Get("1"); after.Category != before.Category || after.Price != before.Price {
+			t.Errorf("%s: product 1 changed to %+v", tt.name, after)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Live catalog updates. GET /ws is a WebSocket that pushes a message for
+// every product created, updated or deleted through the API, so clients
+// see price and availability changes as they happen:
+//
+//	{"type": "updated", "product_id": "p1", "product": {...}, "time": "..."}
+//	{"type": "deleted", "product_id": "p2", "time": "..."}
+//	{"type": "reset", "time": "..."}
+//
+// product is as GET /product/{id} would serve it then, in the model
+// version asked for with X-Product-Version or ?version= (browsers can't
+// set headers on a WebSocket). A change to a component is also pushed as
+// an update of every bundle containing it, since their price and window
+// are derived. The model has no stock level; availability.status is the
+// closest there is. reset follows a snapshot restore: refetch everything.
+//
+// ?ids=p1,p2 limits the stream to those products. Subscribers that fall
+// more than liveBuffer messages behind are disconnected (close code 1013)
+// rather than silently missing prices. Connections get a ping every
+// livePingInterval and are closed with 1001 when the service shuts down.
+
+const (
+	liveBuffer       = 64
+	livePingInterval = 30 * time.Second
+)
+
+// LiveEvent is one catalog change on the stream
+type LiveEvent struct {
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id,omitempty"`
+	Time      time.Time `json:"time"`
+
+	product *models.Product // Resolved as served; nil for deleted and reset
+}
+
+// liveHub fans catalog changes out to the connected sockets
+type liveHub struct {
+	mu   sync.Mutex
+	subs map[*liveSub]struct{}
+
+	// Hijacked sockets aren't drained by the server, so shutdown closes
+	// stopping and waits for the handlers to say goodbye
+	stopping chan struct{}
+	active   sync.WaitGroup
+}
+
+type liveSub struct {
+	ids    map[string]bool // nil means every product
+	events chan LiveEvent
+	lagged chan struct{} // Closed when the subscriber is dropped for falling behind
+}
+
+var liveUpdates = &liveHub{subs: map[*liveSub]struct{}{}, stopping: make(chan struct{})}
+
+func (h *liveHub) subscribe(ids map[string]bool) (*liveSub, func()) {
+	sub := &liveSub{ids: ids, events: make(chan LiveEvent, liveBuffer), lagged: make(chan struct{})}
+	h.active.Add(1)
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub, func() {
+		h.mu.Lock()
+		delete(h.subs, sub)
+		h.mu.Unlock()
+		h.active.Done()
+	}
+}
+
+// shutdown closes every socket with 1001; an OnShutdown hook
+func (h *liveHub) shutdown() {
+	close(h.stopping)
+	h.active.Wait()
+}
+
+// publish never blocks: a full subscriber is dropped instead
+func (h *liveHub) publish(ev LiveEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if ev.ProductID != "" && sub.ids != nil && !sub.ids[ev.ProductID] {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			delete(h.subs, sub)
+			close(sub.lagged)
+		}
+	}
+}
+
+// productChanged publishes id as updated, along with the bundles that
+// contain it
+func productChanged(id string) {
+	now := time.Now()
+	for _, changed := range append([]string{id}, bundlesContaining(id)...) {
+		p, ok, err := resolveProduct(changed, now)
+		if !ok || err != nil {
+			continue
+		}
+		liveUpdates.publish(LiveEvent{Type: "updated", ProductID: changed, Time: now.UTC(), product: &p})
+	}
+}
+
+// productDeleted publishes id as deleted. Bundles can't contain a deleted
+// product, so none change with it.
+func productDeleted(id string) {
+	liveUpdates.publish(LiveEvent{Type: "deleted", ProductID: id, Time: time.Now().UTC()})
+}
+
+// catalogReset tells every subscriber the whole catalog was replaced
+func catalogReset() {
+	liveUpdates.publish(LiveEvent{Type: "reset", Time: time.Now().UTC()})
+}
+
+// bundlesContaining returns the bundles with id among their components,
+// directly or through other bundles
+func bundlesContaining(id string) []string {
+	list := catalog.List()
+	var found []string
+	queue := []string{id}
+	for len(queue) > 0 {
+		target := queue[0]
+		queue = queue[1:]
+		for _, p := range list {
+			if slices.Contains(found, p.ID) {
+				continue
+			}
+			for _, c := range p.Components {
+				if c.ProductID == target {
+					found = append(found, p.ID)
+					queue = append(queue, p.ID)
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+// encodeLiveEvent renders ev in the subscriber's model version
+func encodeLiveEvent(version int, ev LiveEvent) ([]byte, error) {
+	msg := struct {
+		LiveEvent
+		Product interface{} `json:"product,omitempty"`
+	}{LiveEvent: ev}
+	if ev.product != nil {
+		msg.Product = models.Encode(version, *ev.product)
+	}
+	return json.Marshal(msg)
+}
+
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	header := r.Header.Get(models.ProductVersionHeader)
+	if v := r.URL.Query().Get("version"); v != "" {
+		header = v
+	}
+	version, err := models.ParseProductVersion(header)
+	if err != nil {
+		apperrors.Write(w, fmt.Errorf("%v: %w", err, apperrors.ErrValidation))
+		return
+	}
+	var ids map[string]bool
+	if v := r.URL.Query().Get("ids"); v != "" {
+		ids = map[string]bool{}
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids[id] = true
+			}
+		}
+	}
+
+	httpserver.LongLived(r.Context())
+	ws, err := wsAccept(w, r)
+	if err != nil {
+		apperrors.Write(w, fmt.Errorf("%v: %w", err, apperrors.ErrValidation))
+		return
+	}
+	log := logging.For(r.Context(), slog.Default())
+	log.Info("Live updates subscriber connected", "version", version, "ids", len(ids))
+
+	sub, cancel := liveUpdates.subscribe(ids)
+	defer cancel()
+	done := make(chan int, 1)
+	go func() { done <- ws.ReadLoop() }()
+
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-liveUpdates.stopping:
+			ws.Close(wsCloseGoingAway, "server shutting down")
+			return
+		case code := <-done:
+			log.Info("Live updates subscriber disconnected", "close_code", code)
+			return
+		case <-sub.lagged:
+			log.Warn("Live updates subscriber fell behind, disconnecting")
+			ws.Close(wsCloseTryAgain, "fell behind")
+			return
+		case ev := <-sub.events:
+			data, err := encodeLiveEvent(version, ev)
+			if err == nil {
+				err = ws.WriteText(data)
+			}
+			if err != nil {
+				log.Info("Live updates subscriber write failed", "error", err)
+				ws.Abort()
+				return
+			}
+		case <-ticker.C:
+			if err := ws.Ping(); err != nil {
+				ws.Abort()
+				return
+			}
+		}
+	}
+}
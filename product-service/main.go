@@ -1,53 +1,98 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/chaos"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/snapshot"
 )
 
-type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	Description string  `json:"description"`
-}
+// Catalog the service starts with (store.go)
+var seedProducts = map[string]models.Product{
+	"1": {ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop", Category: "computers"},
+	"2": {ID: "2", Name: "Mouse", Price: 29.99, Description: "Wireless mouse", Category: "accessories"},
+	"3": {ID: "3", Name: "Keyboard", Price: 79.99, Description: "Mechanical keyboard", Category: "accessories"},
+	"4": {ID: "4", Name: "Monitor", Price: 299.99, Description: "4K display", Category: "displays"},
+	"5": {ID: "5", Name: "Headphones", Price: 149.99, Description: "Noise-cancelling headphones", Category: "audio"},
+	"6": {ID: "6", Name: "VR Headset", Price: 499.99, Description: "Standalone VR headset", Category: "vr",
+		Availability: &models.Availability{PreorderDate: models.DaysFromNow(-7), ReleaseDate: models.DaysFromNow(30)}},
 
-var products = map[string]Product{
-	"1": {ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop"},
-	"2": {ID: "2", Name: "Mouse", Price: 29.99, Description: "Wireless mouse"},
-	"3": {ID: "3", Name: "Keyboard", Price: 79.99, Description: "Mechanical keyboard"},
-	"4": {ID: "4", Name: "Monitor", Price: 299.99, Description: "4K display"},
-	"5": {ID: "5", Name: "Headphones", Price: 149.99, Description: "Noise-cancelling headphones"},
+	// Bundles: price and availability come from the components (bundle.go)
+	"7": {ID: "7", Name: "Desk Setup", Description: "Monitor, keyboard and mouse", Category: "bundles",
+		Components: []models.BundleComponent{{ProductID: "4", Quantity: 1}, {ProductID: "3", Quantity: 1}, {ProductID: "2", Quantity: 1}}},
+	"8": {ID: "8", Name: "VR Starter Kit", Description: "VR headset with noise-cancelling headphones", Category: "bundles",
+		Components: []models.BundleComponent{{ProductID: "6", Quantity: 1}, {ProductID: "5", Quantity: 1}}},
 }
 
 func getProductHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from path
 	path := strings.TrimPrefix(r.URL.Path, "/product/")
 	id := strings.TrimSpace(path)
+	version, ok := productVersion(w, r)
+	if !ok {
+		return
+	}
 
-	product, exists := products[id]
+	product, exists, err := resolveProduct(id, time.Now())
+	logging.For(r.Context(), slog.Default()).Info("Product lookup", "product_id", id, "found", exists)
 	if !exists {
-		http.Error(w, "Product not found", http.StatusNotFound)
+		apperrors.Write(w, fmt.Errorf("product %q: %w", id, apperrors.ErrNotFound))
+		return
+	}
+	if err != nil {
+		apperrors.Write(w, fmt.Errorf("product %q: %v", id, err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(product)
-}
-
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	jsonutil.Write(w, http.StatusOK, models.Encode(version, product))
 }
 
 func main() {
-	http.HandleFunc("/product/", getProductHandler)
-	http.HandleFunc("/health", healthHandler)
+	flag.Parse()
+	logging.Setup("product-service")
+	config.RunSelfCheck(settings, nil)
+	settings.MustValidate()
 
-	log.Println("Product Service starting on :8081")
-	if err := http.ListenAndServe(":8081", nil); err != nil {
-		log.Fatal(err)
+	store, err := openProductStore(settings.Value("DATABASE_URL"))
+	if err != nil {
+		slog.Error("Error opening product store", "error", err)
+		os.Exit(1)
 	}
+	catalog = store
+
+	// Catalog writes need the admin token, like /admin/restore
+	http.Handle("/product/", chaos.Corrupt(httpserver.RequireTokenForWrites(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(productHandler))))
+	http.Handle("/product", httpserver.RequireTokenForWrites(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(createProductHandler)))
+	http.HandleFunc("/products", listProductsHandler)
+	http.HandleFunc("/products/search", searchProductsHandler)
+	http.HandleFunc("/ws", liveHandler)
+	httpserver.OnShutdown(liveUpdates.shutdown)
+	http.HandleFunc("/health", httpserver.HealthHandler)
+	http.HandleFunc("/debug/runtime", httpserver.RuntimeHandler)
+
+	// Resource pressure simulation, admin only
+	pressure := httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), chaos.PressureHandler())
+	http.Handle("/admin/pressure", pressure)
+	http.Handle("/admin/pressure/", pressure)
+
+	// Catalog snapshot / restore, admin only
+	snapshots := httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), snapshot.Handler("product-service", catalogState{}))
+	http.Handle("/admin/snapshot", snapshots)
+	http.Handle("/admin/restore", snapshots)
+
+	addr := settings.Value("LISTEN_ADDR")
+	slog.Info("Product Service starting", "addr", addr)
+	httpserver.Run(addr, logging.RequestID(httpserver.Watchdog(http.DefaultServeMux)))
 }
\ No newline at end of file
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Product search:
+//
+//	GET /products/search?q=&min_price=&max_price=&sort=&limit=&offset=
+//
+//	q          case-insensitive substring of the name or description
+//	min_price  inclusive; bundles match on their derived price
+//	max_price  inclusive
+//	sort       id (default), name, price; prefix with - for descending
+//	limit      page size, 1-100 (default 20)
+//	offset     items to skip (default 0)
+//
+// The response envelope carries the page and the total number of matches:
+//
+//	{"total": 12, "limit": 20, "offset": 0, "items": [...]}
+//
+// Items are in the model version the client asks for, like GET /products.
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type searchQuery struct {
+	text       string
+	minPrice   float64
+	maxPrice   float64 // +Inf when unset
+	sortBy     string
+	descending bool
+	limit      int
+	offset     int
+}
+
+func parseSearchQuery(r *http.Request) (searchQuery, error) {
+	q := r.URL.Query()
+	sq := searchQuery{text: strings.ToLower(strings.TrimSpace(q.Get("q"))), sortBy: "id", limit: defaultSearchLimit}
+
+	var err error
+	price := func(name string, def float64) float64 {
+		v := q.Get(name)
+		if v == "" || err != nil {
+			return def
+		}
+		f, perr := strconv.ParseFloat(v, 64)
+		if perr != nil || f < 0 {
+			err = fmt.Errorf("%s must be a non-negative number: %w", name, apperrors.ErrValidation)
+		}
+		return f
+	}
+	count := func(name string, def, lo, hi int) int {
+		v := q.Get(name)
+		if v == "" || err != nil {
+			return def
+		}
+		n, perr := strconv.Atoi(v)
+		if perr != nil || n < lo || n > hi {
+			err = fmt.Errorf("%s must be an integer from %d to %d: %w", name, lo, hi, apperrors.ErrValidation)
+		}
+		return n
+	}
+	sq.minPrice = price("min_price", 0)
+	sq.maxPrice = price("max_price", math.Inf(1))
+	sq.limit = count("limit", defaultSearchLimit, 1, maxSearchLimit)
+	sq.offset = count("offset", 0, 0, 1<<30)
+	if err != nil {
+		return sq, err
+	}
+	if sq.maxPrice < sq.minPrice {
+		return sq, fmt.Errorf("max_price is below min_price: %w", apperrors.ErrValidation)
+	}
+
+	if s := q.Get("sort"); s != "" {
+		sq.descending = strings.HasPrefix(s, "-")
+		sq.sortBy = strings.TrimPrefix(s, "-")
+		if sq.sortBy != "id" && sq.sortBy != "name" && sq.sortBy != "price" {
+			return sq, fmt.Errorf("sort must be id, name or price, optionally prefixed with -: %w", apperrors.ErrValidation)
+		}
+	}
+	return sq, nil
+}
+
+func (sq searchQuery) matches(p models.Product) bool {
+	if sq.text != "" && !strings.Contains(strings.ToLower(p.Name), sq.text) &&
+		!strings.Contains(strings.ToLower(p.Description), sq.text) {
+		return false
+	}
+	return p.Price >= sq.minPrice && p.Price <= sq.maxPrice
+}
+
+// less orders by the sort key, then by ID so pages are stable
+func (sq searchQuery) less(a, b models.Product) bool {
+	var c int
+	switch sq.sortBy {
+	case "name":
+		c = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case "price":
+		switch {
+		case a.Price < b.Price:
+			c = -1
+		case a.Price > b.Price:
+			c = 1
+		}
+	}
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+	if sq.descending {
+		return c > 0
+	}
+	return c < 0
+}
+
+func searchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := productVersion(w, r)
+	if !ok {
+		return
+	}
+	sq, err := parseSearchQuery(r)
+	if err != nil {
+		apperrors.Write(w, err)
+		return
+	}
+
+	now := time.Now()
+	matched := []models.Product{}
+	for _, p := range catalog.List() {
+		resolved, err := resolveBundle(catalog.Get, p, map[string]bool{})
+		if err != nil {
+			apperrors.Write(w, fmt.Errorf("product %q: %v", p.ID, err))
+			return
+		}
+		if sq.matches(resolved) {
+			matched = append(matched, resolved.WithStatus(now))
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return sq.less(matched[i], matched[j]) })
+
+	page := matched[min(sq.offset, len(matched)):min(sq.offset+sq.limit, len(matched))]
+	jsonutil.Write(w, http.StatusOK, map[string]interface{}{
+		"total":  len(matched),
+		"limit":  sq.limit,
+		"offset": sq.offset,
+		"items":  models.EncodeList(version, page),
+	})
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// catalogState is the product catalog as seen by /admin/snapshot and
+// /admin/restore: a map of product ID to product
+type catalogState struct{}
+
+func (catalogState) Dump() interface{} {
+	return catalog.Dump()
+}
+
+func (catalogState) Restore(data json.RawMessage) error {
+	var products map[string]models.Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return err
+	}
+	if err := catalog.Replace(products); err != nil {
+		return err
+	}
+	catalogReset()
+	return nil
+}
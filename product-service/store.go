@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// ProductStore holds the catalog. Implementations are safe for concurrent
+// use and keep it consistent: every bundle's components exist and no
+// bundle contains itself.
+type ProductStore interface {
+	Get(id string) (models.Product, bool)
+	// List returns every product, sorted by ID
+	List() []models.Product
+	// Create fails with apperrors.ErrConflict if the ID is taken
+	Create(p models.Product) error
+	// Update fails with apperrors.ErrNotFound if the product doesn't exist
+	Update(p models.Product) error
+	// Delete fails with apperrors.ErrConflict while a bundle contains the product
+	Delete(id string) error
+	// Dump and Replace copy the whole catalog out and in (snapshots)
+	Dump() map[string]models.Product
+	Replace(catalog map[string]models.Product) error
+}
+
+// The catalog; main replaces it with the store DATABASE_URL selects
+var catalog ProductStore = newMemoryStore(seedProducts)
+
+// validateProduct checks the fields of a single product
+func validateProduct(p models.Product) error {
+	switch {
+	case p.ID == "":
+		return fmt.Errorf("id is required: %w", apperrors.ErrValidation)
+	case strings.ContainsAny(p.ID, "/?# "):
+		return fmt.Errorf("id %q may not contain '/', '?', '#' or spaces: %w", p.ID, apperrors.ErrValidation)
+	case strings.TrimSpace(p.Name) == "":
+		return fmt.Errorf("product %q has no name: %w", p.ID, apperrors.ErrValidation)
+	case p.Price < 0 || math.IsNaN(p.Price) || math.IsInf(p.Price, 0):
+		return fmt.Errorf("product %q has invalid price %v: %w", p.ID, p.Price, apperrors.ErrValidation)
+	}
+	for _, c := range p.Components {
+		if c.Quantity < 1 {
+			return fmt.Errorf("bundle %s: component %q has quantity %d: %w", p.ID, c.ProductID, c.Quantity, apperrors.ErrValidation)
+		}
+	}
+	if p.Availability != nil {
+		if err := p.Availability.Validate(); err != nil {
+			return fmt.Errorf("product %q: %v: %w", p.ID, err, apperrors.ErrValidation)
+		}
+	}
+	return nil
+}
+
+// checkBundles resolves every bundle in catalog, so dangling components
+// and cycles are caught before a change is accepted
+func checkBundles(catalog map[string]models.Product) error {
+	for _, p := range catalog {
+		if _, err := resolveBundle(mapLookup(catalog), p, map[string]bool{}); err != nil {
+			return fmt.Errorf("%v: %w", err, apperrors.ErrValidation)
+		}
+	}
+	return nil
+}
+
+func mapLookup(catalog map[string]models.Product) func(string) (models.Product, bool) {
+	return func(id string) (models.Product, bool) {
+		p, ok := catalog[id]
+		return p, ok
+	}
+}
+
+// memoryStore is the in-memory ProductStore
+type memoryStore struct {
+	mu       sync.RWMutex
+	products map[string]models.Product
+}
+
+func newMemoryStore(seed map[string]models.Product) *memoryStore {
+	return &memoryStore{products: maps.Clone(seed)}
+}
+
+func (s *memoryStore) Get(id string) (models.Product, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.products[id]
+	return p, ok
+}
+
+func (s *memoryStore) List() []models.Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := slices.Collect(maps.Values(s.products))
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *memoryStore) Create(p models.Product) error {
+	if err := validateProduct(p); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.products[p.ID]; exists {
+		return fmt.Errorf("product %q already exists: %w", p.ID, apperrors.ErrConflict)
+	}
+	return s.putLocked(p)
+}
+
+func (s *memoryStore) Update(p models.Product) error {
+	if err := validateProduct(p); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.products[p.ID]; !exists {
+		return fmt.Errorf("product %q: %w", p.ID, apperrors.ErrNotFound)
+	}
+	return s.putLocked(p)
+}
+
+// putLocked stores p, backing out if that breaks a bundle; s.mu must be
+// held
+func (s *memoryStore) putLocked(p models.Product) error {
+	old, existed := s.products[p.ID]
+	s.products[p.ID] = p
+	if err := checkBundles(s.products); err != nil {
+		if existed {
+			s.products[p.ID] = old
+		} else {
+			delete(s.products, p.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.products[id]; !exists {
+		return fmt.Errorf("product %q: %w", id, apperrors.ErrNotFound)
+	}
+	for _, p := range s.products {
+		for _, c := range p.Components {
+			if c.ProductID == id {
+				return fmt.Errorf("product %q is a component of bundle %q: %w", id, p.ID, apperrors.ErrConflict)
+			}
+		}
+	}
+	delete(s.products, id)
+	return nil
+}
+
+func (s *memoryStore) Dump() map[string]models.Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.products)
+}
+
+func (s *memoryStore) Replace(catalog map[string]models.Product) error {
+	for id, p := range catalog {
+		if p.ID != id {
+			return fmt.Errorf("product under key %q has id %q: %w", id, p.ID, apperrors.ErrValidation)
+		}
+		if err := validateProduct(p); err != nil {
+			return err
+		}
+	}
+	if err := checkBundles(catalog); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.products = maps.Clone(catalog)
+	s.mu.Unlock()
+	return nil
+}
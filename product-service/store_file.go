@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Persistent catalog. DATABASE_URL selects the ProductStore:
+//
+//	unset or memory:        in memory, seeded with the demo catalog; lost on restart
+//	file:/data/catalog.json a JSON file, rewritten atomically after every change
+//
+// SQL backends (sqlite:, postgres:) need a database driver this build
+// doesn't vendor, so they are rejected at startup rather than silently
+// falling back to memory.
+//
+// A missing file is created from the seed catalog. Existing files are
+// migrated to catalogSchemaVersion on startup (catalogMigrations) and
+// written back before the service starts serving.
+
+// catalogSchemaVersion is the version of catalogFile written by this build
+const catalogSchemaVersion = 1
+
+// catalogFile is the on-disk format of the file store
+type catalogFile struct {
+	SchemaVersion int                       `json:"schema_version"`
+	Products      map[string]models.Product `json:"products"`
+}
+
+// catalogMigrations[i] upgrades a version i file to version i+1
+var catalogMigrations = []func(data []byte) ([]byte, error){
+	// 0: a bare map of product ID to product, as in an /admin/snapshot state
+	func(data []byte) ([]byte, error) {
+		var products map[string]models.Product
+		if err := json.Unmarshal(data, &products); err != nil {
+			return nil, err
+		}
+		return json.Marshal(catalogFile{SchemaVersion: 1, Products: products})
+	},
+}
+
+// parseDatabaseURL returns the store kind ("memory" or "file") and, for
+// files, the path
+func parseDatabaseURL(v string) (kind, path string, err error) {
+	if v == "" {
+		return "memory", "", nil
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "memory":
+		return "memory", "", nil
+	case "file":
+		path = u.Path
+		if path == "" {
+			path = u.Opaque // file:catalog.json, relative to the working directory
+		}
+		if path == "" {
+			return "", "", errors.New("file: URL has no path")
+		}
+		return "file", path, nil
+	case "sqlite", "sqlite3", "postgres", "postgresql":
+		return "", "", fmt.Errorf("%s: no database driver in this build, use memory: or file:", u.Scheme)
+	}
+	return "", "", fmt.Errorf("unsupported scheme %q, use memory: or file:", u.Scheme)
+}
+
+// validDatabaseURL is the DATABASE_URL setting validator
+func validDatabaseURL(v string) error {
+	_, _, err := parseDatabaseURL(v)
+	return err
+}
+
+// openProductStore returns the store DATABASE_URL selects
+func openProductStore(databaseURL string) (ProductStore, error) {
+	kind, path, err := parseDatabaseURL(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "memory" {
+		return newMemoryStore(seedProducts), nil
+	}
+	return newFileStore(path)
+}
+
+// fileStore is a memoryStore saved to a JSON file after every change. A
+// change that can't be saved is rolled back and reported as an error, so
+// memory never holds what the file doesn't.
+type fileStore struct {
+	*memoryStore
+	path    string
+	writeMu sync.Mutex // Serializes changes with their saves, so a rollback can't undo another change
+}
+
+func newFileStore(path string) (*fileStore, error) {
+	s := &fileStore{memoryStore: newMemoryStore(seedProducts), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("Catalog file not found, creating it from the seed catalog", "path", path)
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	from, data, err := migrateCatalog(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var file catalogFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := s.memoryStore.Replace(file.Products); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if from < catalogSchemaVersion {
+		slog.Info("Migrated catalog file", "path", path, "from_version", from, "to_version", catalogSchemaVersion)
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	slog.Info("Catalog loaded from file", "path", path, "products", len(file.Products))
+	return s, nil
+}
+
+// migrateCatalog upgrades file data to catalogSchemaVersion, returning the
+// version it started at
+func migrateCatalog(data []byte) (int, []byte, error) {
+	var header struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, nil, err
+	}
+	from := 0 // Files predating schema_version
+	if header.SchemaVersion != nil {
+		from = *header.SchemaVersion
+	}
+	if from > catalogSchemaVersion {
+		return from, nil, fmt.Errorf("schema version %d is newer than this build supports (%d)", from, catalogSchemaVersion)
+	}
+	for v := from; v < catalogSchemaVersion; v++ {
+		var err error
+		if data, err = catalogMigrations[v](data); err != nil {
+			return from, nil, fmt.Errorf("migrating from schema version %d: %w", v, err)
+		}
+	}
+	return from, data, nil
+}
+
+// save writes the catalog atomically: to a temporary file, then renamed
+// over the old one. s.writeMu must be held, except while opening.
+func (s *fileStore) save() error {
+	data, err := json.MarshalIndent(catalogFile{SchemaVersion: catalogSchemaVersion, Products: s.Dump()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("saving catalog: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("saving catalog: %w", err)
+	}
+	return nil
+}
+
+// change applies a change to the catalog in memory and saves it, putting
+// the previous catalog back if the save fails
+func (s *fileStore) change(apply func() error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	before := s.memoryStore.Dump()
+	if err := apply(); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		s.memoryStore.mu.Lock()
+		s.products = before
+		s.memoryStore.mu.Unlock()
+		slog.Error("Catalog change rolled back", "path", s.path, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (s *fileStore) Create(p models.Product) error {
+	return s.change(func() error { return s.memoryStore.Create(p) })
+}
+
+func (s *fileStore) Update(p models.Product) error {
+	return s.change(func() error { return s.memoryStore.Update(p) })
+}
+
+func (s *fileStore) Delete(id string) error {
+	return s.change(func() error { return s.memoryStore.Delete(id) })
+}
+
+func (s *fileStore) Replace(catalog map[string]models.Product) error {
+	return s.change(func() error { return s.memoryStore.Replace(catalog) })
+}
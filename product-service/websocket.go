@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal RFC 6455 WebSocket server, enough for /ws: text frames out,
+// pings, pongs and close in. Client frames must be masked and small;
+// fragmented messages aren't accepted, since clients have nothing to send
+// but control frames.
+
+const (
+	wsGUID            = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxClientFrame  = 4 << 10
+	wsWriteTimeout    = 10 * time.Second
+	wsOpText          = 0x1
+	wsOpClose         = 0x8
+	wsOpPing          = 0x9
+	wsOpPong          = 0xA
+	wsCloseNormal     = 1000
+	wsCloseGoingAway  = 1001
+	wsCloseProtocol   = 1002
+	wsCloseTooBig     = 1009
+	wsCloseTryAgain   = 1013
+	wsCloseNoStatus   = 1005
+	wsCloseAbnormal   = 1006 // Reported only, never sent
+	wsCloseMessageMax = 123  // Control frame payloads are at most 125 bytes
+)
+
+// wsConn is an accepted WebSocket connection. Writes are serialized, so
+// the reader can answer pings while events are being sent.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// wsHeaderHas reports whether a comma-separated header lists token
+func wsHeaderHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsAccept completes the opening handshake. On error nothing has been
+// hijacked and the caller still owns w.
+func wsAccept(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		return nil, errors.New("websocket handshake must be a GET")
+	case !wsHeaderHas(r.Header, "Connection", "upgrade") || !wsHeaderHas(r.Header, "Upgrade", "websocket"):
+		return nil, errors.New("not a websocket upgrade request")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, errors.New("unsupported websocket version")
+	}
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, errors.New("invalid Sec-WebSocket-Key")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("hijacking connection: %v", err)
+	}
+	// The connection outlives the request; drop any server deadlines
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("writing handshake: %v", err)
+	}
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// writeFrame sends one unfragmented, unmasked frame
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op // FIN
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := (&net.Buffers{header, payload}).WriteTo(c.conn)
+	return err
+}
+
+// WriteText sends a text message
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// Ping sends a ping; the client's pong is consumed by ReadLoop
+func (c *wsConn) Ping() error {
+	return c.writeFrame(wsOpPing, nil)
+}
+
+// Close sends a close frame with code and reason, then closes the
+// connection without waiting for the client's reply
+func (c *wsConn) Close(code int, reason string) {
+	if len(reason) > wsCloseMessageMax {
+		reason = reason[:wsCloseMessageMax]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.writeFrame(wsOpClose, append(payload, reason...))
+	c.Abort()
+}
+
+// Abort closes the connection without a close frame, for when the
+// connection is already broken
+func (c *wsConn) Abort() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.conn.Close()
+	}
+}
+
+// ReadLoop reads client frames until the connection ends, answering pings
+// and closes. It returns the close code: the client's, or one saying why
+// the server gave up.
+func (c *wsConn) ReadLoop() int {
+	for {
+		op, payload, err := c.readFrame()
+		var tooBig *wsFrameTooBig
+		switch {
+		case errors.As(err, &tooBig):
+			c.Close(wsCloseTooBig, err.Error())
+			return wsCloseTooBig
+		case errors.Is(err, errWSProtocol):
+			c.Close(wsCloseProtocol, err.Error())
+			return wsCloseProtocol
+		case err != nil:
+			c.Abort()
+			return wsCloseAbnormal
+		}
+
+		switch op {
+		case wsOpPing:
+			c.writeFrame(wsOpPong, payload)
+		case wsOpPong:
+		case wsOpClose:
+			code := wsCloseNoStatus
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.Close(wsCloseNormal, "")
+			return code
+		default:
+			// Data messages from clients are ignored
+		}
+	}
+}
+
+var errWSProtocol = errors.New("websocket protocol error")
+
+type wsFrameTooBig struct{ size uint64 }
+
+func (e *wsFrameTooBig) Error() string {
+	return fmt.Sprintf("frame of %d bytes exceeds the %d byte limit", e.size, wsMaxClientFrame)
+}
+
+// readFrame reads one client frame and unmasks it
+func (c *wsConn) readFrame() (op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	fin, op := head[0]&0x80 != 0, head[0]&0x0F
+	masked, size := head[1]&0x80 != 0, uint64(head[1]&0x7F)
+	switch {
+	case head[0]&0x70 != 0:
+		return 0, nil, fmt.Errorf("%w: reserved bits set", errWSProtocol)
+	case !masked:
+		return 0, nil, fmt.Errorf("%w: client frames must be masked", errWSProtocol)
+	case !fin:
+		return 0, nil, fmt.Errorf("%w: fragmented messages aren't supported", errWSProtocol)
+	}
+
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsOpClose && size > 125 {
+		return 0, nil, fmt.Errorf("%w: control frame too long", errWSProtocol)
+	}
+	if size > wsMaxClientFrame {
+		return 0, nil, &wsFrameTooBig{size: size}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Model versions. Every recommendations table the service has served (the
+// seed, each /admin/restore, each upload) is kept as a numbered artifact,
+// so a bad recomputation can be rolled back without re-uploading the old
+// one (admin token required):
+//
+//	GET  /admin/models                                   versions and the active one
+//	POST /admin/models           {"recommendations": {...}, "activate": true, "force": false}
+//	POST /admin/models/activate  {"version": "v3", "force": false}
+//	POST /admin/models/rollback                          back to the previously active version
+//	GET  /admin/models/shadow                            shadow evaluation of the candidate (see shadow.go)
+//
+// Activation is checked by the guardrail in guardrail.go unless forced.
+// Responses carry the active version in X-Model-Version. The newest
+// MODEL_MAX_VERSIONS (default 10) are kept; the active version is never
+// evicted.
+
+const modelVersionHeader = "X-Model-Version"
+
+type ModelVersion struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source"` // "seed", "restore", "upload", "consistency", "file" or "redis"
+	Products  int       `json:"products"`
+	Active    bool      `json:"active"`
+
+	table map[string][]models.Product
+}
+
+var modelStore = struct {
+	mu          sync.Mutex
+	versions    []*ModelVersion // Oldest first
+	next        int
+	active      string
+	previous    []string // Versions active before, most recent last
+	maxVersions int
+}{next: 1, maxVersions: 10}
+
+func loadModelStoreFromEnv() {
+	if v, err := strconv.Atoi(settings.Value("MODEL_MAX_VERSIONS")); err == nil && v > 0 {
+		modelStore.maxVersions = v
+	}
+	recommendationsMu.RLock()
+	seed := recommendations
+	recommendationsMu.RUnlock()
+	publishModel(seed, "seed", true, false)
+}
+
+// activeModelVersion is the version currently served
+func activeModelVersion() string {
+	modelStore.mu.Lock()
+	defer modelStore.mu.Unlock()
+	return modelStore.active
+}
+
+// validateTable checks a recommendations table before it can be published
+func validateTable(table map[string][]models.Product) error {
+	for id, recs := range table {
+		for _, p := range recs {
+			if p.ID == "" {
+				return fmt.Errorf("recommendation for %q has no id", id)
+			}
+			if p.Availability != nil {
+				if err := p.Availability.Validate(); err != nil {
+					return fmt.Errorf("recommendation %q for %q: %w", p.ID, id, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// publishModel stores table as a new version and optionally serves it.
+// With guard set, activation has to pass the guardrail; a version it
+// blocks is kept inactive and returned along with the error.
+func publishModel(table map[string][]models.Product, source string, activate, guard bool) (ModelVersion, error) {
+	modelStore.mu.Lock()
+	defer modelStore.mu.Unlock()
+	return publishModelLocked(table, source, activate, guard)
+}
+
+// errModelChanged means the version a table was derived from is no longer
+// the active one
+var errModelChanged = errors.New("active model version changed")
+
+// publishModelOver publishes and activates table, derived from version
+// base, unless another version has been activated since
+func publishModelOver(base string, table map[string][]models.Product, source string, guard bool) (ModelVersion, error) {
+	modelStore.mu.Lock()
+	defer modelStore.mu.Unlock()
+	if modelStore.active != base {
+		return ModelVersion{}, fmt.Errorf("%w: %s is active, not %s", errModelChanged, modelStore.active, base)
+	}
+	return publishModelLocked(table, source, true, guard)
+}
+
+// publishModelLocked is publishModel; modelStore.mu must be held
+func publishModelLocked(table map[string][]models.Product, source string, activate, guard bool) (ModelVersion, error) {
+	m := &ModelVersion{
+		Version:   "v" + strconv.Itoa(modelStore.next),
+		CreatedAt: time.Now().UTC(),
+		Source:    source,
+		Products:  len(table),
+		table:     table,
+	}
+	modelStore.next++
+	modelStore.versions = append(modelStore.versions, m)
+	var err error
+	if activate && guard {
+		err = checkGuardrailLocked(m)
+	}
+	if activate && err == nil {
+		activateLocked(m)
+	} else {
+		setShadowCandidate(m)
+	}
+	evictLocked()
+	v := *m
+	v.Active = m.Version == modelStore.active
+	return v, err
+}
+
+// activateLocked serves m; modelStore.mu must be held
+func activateLocked(m *ModelVersion) {
+	if modelStore.active != "" && modelStore.active != m.Version {
+		modelStore.previous = append(modelStore.previous, modelStore.active)
+	}
+	modelStore.active = m.Version
+	recommendationsMu.Lock()
+	recommendations = m.table
+	recommendationsMu.Unlock()
+}
+
+// evictLocked drops the oldest inactive versions beyond the limit
+func evictLocked() {
+	for len(modelStore.versions) > modelStore.maxVersions {
+		i := 0
+		if modelStore.versions[0].Version == modelStore.active {
+			i = 1
+		}
+		evicted := modelStore.versions[i].Version
+		clearShadowCandidate(evicted)
+		modelStore.versions = append(modelStore.versions[:i], modelStore.versions[i+1:]...)
+		kept := modelStore.previous[:0]
+		for _, v := range modelStore.previous {
+			if v != evicted {
+				kept = append(kept, v)
+			}
+		}
+		modelStore.previous = kept
+	}
+}
+
+func findModelLocked(version string) *ModelVersion {
+	for _, m := range modelStore.versions {
+		if m.Version == version {
+			return m
+		}
+	}
+	return nil
+}
+
+func listModels() map[string]interface{} {
+	modelStore.mu.Lock()
+	defer modelStore.mu.Unlock()
+	list := make([]ModelVersion, 0, len(modelStore.versions))
+	for _, m := range modelStore.versions {
+		v := *m
+		v.Active = m.Version == modelStore.active
+		list = append(list, v)
+	}
+	return map[string]interface{}{"active": modelStore.active, "versions": list}
+}
+
+func modelsHandler(w http.ResponseWriter, r *http.Request) {
+	audit := logging.For(r.Context(), slog.Default()).With("audit", true, "remote_addr", r.RemoteAddr)
+
+	switch r.Method {
+	case http.MethodGet:
+		jsonutil.Write(w, http.StatusOK, listModels())
+	case http.MethodPost:
+		var req struct {
+			Recommendations map[string][]models.Product `json:"recommendations"`
+			Activate        bool                        `json:"activate"`
+			Force           bool                        `json:"force"` // Skip the guardrail
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apperrors.Write(w, fmt.Errorf("invalid JSON: %v: %w", err, apperrors.ErrValidation))
+			return
+		}
+		if req.Recommendations == nil {
+			apperrors.Write(w, fmt.Errorf("recommendations is required: %w", apperrors.ErrValidation))
+			return
+		}
+		if err := validateTable(req.Recommendations); err != nil {
+			apperrors.Write(w, fmt.Errorf("%v: %w", err, apperrors.ErrValidation))
+			return
+		}
+		m, err := publishModel(req.Recommendations, "upload", req.Activate, !req.Force)
+		audit.Info("Model version uploaded", "version", m.Version, "products", m.Products,
+			"activated", m.Active, "forced", req.Force)
+		var blocked *guardrailError
+		if errors.As(err, &blocked) {
+			audit.Warn("Model activation blocked by guardrail", "version", m.Version, "changed_pct", blocked.ChangedPct)
+			writeGuardrailError(w, blocked)
+			return
+		}
+		jsonutil.Write(w, http.StatusCreated, m)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func activateModelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Version string `json:"version"`
+		Force   bool   `json:"force"` // Skip the guardrail
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperrors.Write(w, fmt.Errorf("invalid JSON: %v: %w", err, apperrors.ErrValidation))
+		return
+	}
+
+	audit := logging.For(r.Context(), slog.Default()).With("audit", true, "remote_addr", r.RemoteAddr)
+	modelStore.mu.Lock()
+	prev := modelStore.active
+	m := findModelLocked(req.Version)
+	var err error
+	if m != nil && !req.Force {
+		err = checkGuardrailLocked(m)
+	}
+	if m != nil && err == nil {
+		activateLocked(m)
+	}
+	modelStore.mu.Unlock()
+	if m == nil {
+		apperrors.Write(w, fmt.Errorf("model version %q: %w", req.Version, apperrors.ErrNotFound))
+		return
+	}
+	var blocked *guardrailError
+	if errors.As(err, &blocked) {
+		audit.Warn("Model activation blocked by guardrail", "version", req.Version, "changed_pct", blocked.ChangedPct)
+		writeGuardrailError(w, blocked)
+		return
+	}
+
+	if report, ok := clearShadowCandidate(req.Version); ok {
+		audit.Info("Shadow evaluation finished", "version", req.Version, "report", report)
+	}
+	audit.Info("Model version activated", "version", req.Version, "previous", prev, "forced", req.Force)
+	jsonutil.Write(w, http.StatusOK, listModels())
+}
+
+func rollbackModelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	modelStore.mu.Lock()
+	from := modelStore.active
+	var to *ModelVersion
+	if n := len(modelStore.previous); n > 0 {
+		to = findModelLocked(modelStore.previous[n-1])
+		modelStore.previous = modelStore.previous[:n-1]
+		// Rolling back isn't a new activation to return to
+		modelStore.active = ""
+		activateLocked(to)
+	}
+	modelStore.mu.Unlock()
+	if to == nil {
+		apperrors.Write(w, fmt.Errorf("no previous model version to roll back to: %w", apperrors.ErrValidation))
+		return
+	}
+
+	logging.For(r.Context(), slog.Default()).Warn("Model version rolled back", "audit", true,
+		"remote_addr", r.RemoteAddr, "from", from, "to", to.Version)
+	jsonutil.Write(w, http.StatusOK, listModels())
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Strategy selection. RECOMMENDATION_MODE picks how recommendations are
+// produced: always from the table, always by embedding similarity, or, with
+// "bandit", by an epsilon-greedy multi-armed bandit choosing per request
+// between the two. The bandit serves the arm with the best mean reward per
+// impression and explores a random arm with probability BANDIT_EPSILON.
+// Rewards are feedback events, weighted like feedback scores (purchases
+// count more than clicks).
+//
+//	BANDIT_EPSILON     exploration rate (default 0.1)
+//	BANDIT_STATE_PATH  JSON file the arm statistics persist to (unset = memory only)
+//
+// Responses name the arm in X-Recommendations-Strategy. Feedback is credited
+// to its strategy field when that names an arm, otherwise to the arm that
+// last served the recommended product on that page. GET /admin/bandit
+// (admin token required) shows the arms and current traffic allocation.
+
+const (
+	strategyTable     = "table"
+	strategyEmbedding = "embedding"
+)
+
+const (
+	banditSaveInterval = 30 * time.Second
+	maxServedBy        = 10000 // Attribution entries kept before starting over
+)
+
+type armStats struct {
+	Impressions float64 `json:"impressions"`
+	Reward      float64 `json:"reward"`
+}
+
+func (a armStats) mean() float64 {
+	if a.Impressions == 0 {
+		return 0
+	}
+	return a.Reward / a.Impressions
+}
+
+var bandit = struct {
+	mu       sync.Mutex
+	enabled  bool
+	epsilon  float64
+	path     string
+	arms     map[string]*armStats
+	servedBy map[string]string // product ID + "/" + recommended ID -> arm
+	dirty    bool
+}{epsilon: 0.1, arms: map[string]*armStats{}, servedBy: map[string]string{}}
+
+func loadBanditFromEnv() {
+	bandit.enabled = settings.Value("RECOMMENDATION_MODE") == "bandit"
+	if !bandit.enabled {
+		return
+	}
+	if v, err := strconv.ParseFloat(settings.Value("BANDIT_EPSILON"), 64); err == nil && v >= 0 && v <= 1 {
+		bandit.epsilon = v
+	}
+	for _, arm := range []string{strategyTable, strategyEmbedding} {
+		bandit.arms[arm] = &armStats{}
+	}
+
+	bandit.path = settings.Value("BANDIT_STATE_PATH")
+	if bandit.path != "" {
+		if data, err := os.ReadFile(bandit.path); err == nil {
+			var saved map[string]armStats
+			if err := json.Unmarshal(data, &saved); err != nil {
+				slog.Warn("Ignoring unreadable bandit state", "path", bandit.path, "error", err)
+			}
+			for arm, stats := range saved {
+				if a, ok := bandit.arms[arm]; ok {
+					*a = stats
+				}
+			}
+		} else if !os.IsNotExist(err) {
+			slog.Warn("Couldn't read bandit state", "path", bandit.path, "error", err)
+		}
+		go func() {
+			for range time.Tick(banditSaveInterval) {
+				saveBanditState()
+			}
+		}()
+	}
+	slog.Info("Bandit strategy selection enabled", "epsilon", bandit.epsilon, "state_path", bandit.path)
+}
+
+// chooseStrategy picks the strategy for one request
+func chooseStrategy() string {
+	switch {
+	case bandit.enabled:
+	case embedding.enabled:
+		return strategyEmbedding
+	default:
+		return strategyTable
+	}
+
+	bandit.mu.Lock()
+	defer bandit.mu.Unlock()
+	if rand.Float64() < bandit.epsilon {
+		if rand.IntN(2) == 0 {
+			return strategyTable
+		}
+		return strategyEmbedding
+	}
+	return bestArmLocked()
+}
+
+// bestArmLocked is the arm with the highest mean reward, table on ties;
+// bandit.mu must be held
+func bestArmLocked() string {
+	if bandit.arms[strategyEmbedding].mean() > bandit.arms[strategyTable].mean() {
+		return strategyEmbedding
+	}
+	return strategyTable
+}
+
+// banditServed records an impression of recs for arm on id's page
+func banditServed(arm, id string, recs []models.Product) {
+	if !bandit.enabled {
+		return
+	}
+	bandit.mu.Lock()
+	defer bandit.mu.Unlock()
+	bandit.arms[arm].Impressions++
+	if len(bandit.servedBy) >= maxServedBy {
+		bandit.servedBy = map[string]string{}
+	}
+	for _, p := range recs {
+		bandit.servedBy[id+"/"+p.ID] = arm
+	}
+	bandit.dirty = true
+}
+
+// banditReward credits feedback to the arm that earned it
+func banditReward(fb models.Feedback, weight float64) {
+	if !bandit.enabled {
+		return
+	}
+	bandit.mu.Lock()
+	defer bandit.mu.Unlock()
+	arm := fb.Strategy
+	if _, ok := bandit.arms[arm]; !ok {
+		if arm, ok = bandit.servedBy[fb.ProductID+"/"+fb.RecommendedID]; !ok {
+			return
+		}
+	}
+	bandit.arms[arm].Reward += weight
+	bandit.dirty = true
+}
+
+// saveBanditState writes the arm statistics if they changed, atomically
+func saveBanditState() {
+	bandit.mu.Lock()
+	if !bandit.dirty || bandit.path == "" {
+		bandit.mu.Unlock()
+		return
+	}
+	saved := make(map[string]armStats, len(bandit.arms))
+	for arm, stats := range bandit.arms {
+		saved[arm] = *stats
+	}
+	bandit.dirty = false
+	bandit.mu.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err == nil {
+		tmp := filepath.Join(filepath.Dir(bandit.path), "."+filepath.Base(bandit.path)+".tmp")
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, bandit.path)
+		}
+	}
+	if err != nil {
+		slog.Warn("Couldn't save bandit state", "path", bandit.path, "error", err)
+		bandit.mu.Lock()
+		bandit.dirty = true
+		bandit.mu.Unlock()
+	}
+}
+
+func banditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	type armView struct {
+		armStats
+		MeanReward float64 `json:"mean_reward"`
+		Allocation float64 `json:"allocation"` // Share of traffic it currently gets
+	}
+
+	bandit.mu.Lock()
+	defer bandit.mu.Unlock()
+	arms := map[string]armView{}
+	if bandit.enabled {
+		best := bestArmLocked()
+		for name, stats := range bandit.arms {
+			alloc := bandit.epsilon / float64(len(bandit.arms))
+			if name == best {
+				alloc += 1 - bandit.epsilon
+			}
+			arms[name] = armView{armStats: *stats, MeanReward: round3(stats.mean()), Allocation: round3(alloc)}
+		}
+	}
+	jsonutil.Write(w, http.StatusOK, map[string]interface{}{
+		"enabled": bandit.enabled,
+		"epsilon": bandit.epsilon,
+		"arms":    arms,
+	})
+}
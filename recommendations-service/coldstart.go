@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Cold-start recommendations. A product with no recommendations entry (new
+// to the catalog, or no behavioral data yet) gets a popularity list seeded
+// from catalog signals instead of an empty one. Candidates are every
+// product known to the service, scored as
+//
+//	category weight x newness boost x price-band affinity
+//
+//	COLD_START_CATEGORY_WEIGHTS  e.g. "accessories=1.5,audio=1.2" (unlisted categories weigh 1)
+//	COLD_START_NEW_DAYS          products released within this many days, or upcoming, count as new (default 90)
+//	COLD_START_LIMIT             items returned (default 5)
+//
+// Price bands are orders of magnitude ($10s, $100s, ...): products in the
+// viewed product's band score higher, neighbouring bands a little higher.
+
+const (
+	newnessBoost       = 1.5
+	samePriceBandBoost = 1.5
+	nearPriceBandBoost = 1.2
+)
+
+var coldStart = struct {
+	categoryWeights map[string]float64
+	newDays         int
+	limit           int
+}{categoryWeights: map[string]float64{}, newDays: 90, limit: 5}
+
+func loadColdStartFromEnv() {
+	for _, pair := range strings.Split(settings.Value("COLD_START_CATEGORY_WEIGHTS"), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if w, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && w >= 0 {
+			coldStart.categoryWeights[strings.TrimSpace(k)] = w
+		}
+	}
+	if v, err := strconv.Atoi(settings.Value("COLD_START_NEW_DAYS")); err == nil && v >= 0 {
+		coldStart.newDays = v
+	}
+	if v, err := strconv.Atoi(settings.Value("COLD_START_LIMIT")); err == nil && v > 0 {
+		coldStart.limit = v
+	}
+}
+
+// catalogProducts returns every distinct product in the recommendations
+// table, in ID order
+func catalogProducts() []models.Product {
+	recommendationsMu.RLock()
+	seen := map[string]models.Product{}
+	for _, recs := range recommendations {
+		for _, p := range recs {
+			seen[p.ID] = p
+		}
+	}
+	recommendationsMu.RUnlock()
+
+	products := make([]models.Product, 0, len(seen))
+	for _, p := range seen {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products
+}
+
+func priceBand(price float64) int {
+	return int(math.Floor(math.Log10(max(price, 1))))
+}
+
+// isNew reports whether p was released within the newness window or hasn't
+// been released yet
+func isNew(p models.Product, now time.Time) bool {
+	if p.Availability == nil || p.Availability.ReleaseDate == "" {
+		return false
+	}
+	cutoff := now.UTC().AddDate(0, 0, -coldStart.newDays).Format(models.DateLayout)
+	return p.Availability.ReleaseDate >= cutoff
+}
+
+func coldStartScore(p models.Product, viewed *models.Product, now time.Time) float64 {
+	score := 1.0
+	if w, ok := coldStart.categoryWeights[p.Category]; ok {
+		score = w
+	}
+	if isNew(p, now) {
+		score *= newnessBoost
+	}
+	if viewed != nil {
+		switch d := priceBand(p.Price) - priceBand(viewed.Price); {
+		case d == 0:
+			score *= samePriceBandBoost
+		case d == 1 || d == -1:
+			score *= nearPriceBandBoost
+		}
+	}
+	return score
+}
+
+// coldStartRecommendations seeds a list for id from catalog signals
+func coldStartRecommendations(id string, now time.Time) []models.Product {
+	var viewed *models.Product
+	if p, ok := knownProduct(id); ok {
+		viewed = &p
+	}
+
+	type scored struct {
+		p     models.Product
+		score float64
+	}
+	var candidates []scored
+	for _, p := range catalogProducts() {
+		if p.ID == id {
+			continue
+		}
+		if s := coldStartScore(p, viewed, now); s > 0 {
+			candidates = append(candidates, scored{p, s})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	recs := make([]models.Product, 0, min(len(candidates), coldStart.limit))
+	for _, c := range candidates[:min(len(candidates), coldStart.limit)] {
+		recs = append(recs, c.p)
+	}
+	slog.Debug("Cold-start recommendations", "product_id", id, "candidates", len(candidates), "returned", len(recs))
+	return recs
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// setTable replaces the recommendations table and the cold-start settings
+// for the rest of the test
+func setTable(t *testing.T, table map[string][]models.Product) {
+	t.Helper()
+	recommendationsMu.Lock()
+	saved, savedCold := recommendations, coldStart
+	recommendations = table
+	recommendationsMu.Unlock()
+	coldStart.categoryWeights = map[string]float64{}
+	coldStart.newDays, coldStart.limit = 90, 5
+	t.Cleanup(func() {
+		recommendationsMu.Lock()
+		recommendations, coldStart = saved, savedCold
+		recommendationsMu.Unlock()
+	})
+}
+
+func ids(products []models.Product) []string {
+	out := make([]string, len(products))
+	for i, p := range products {
+		out[i] = p.ID
+	}
+	return out
+}
+
+// A fresh deployment: products are known but none has behavioral data
+var freshTable = map[string][]models.Product{
+	"1": {},
+	"2": {},
+	"seed": {
+		{ID: "1", Name: "Laptop", Price: 999.99, Category: "computers"},
+		{ID: "2", Name: "Mouse", Price: 29.99, Category: "accessories"},
+		{ID: "3", Name: "Keyboard", Price: 79.99, Category: "accessories"},
+		{ID: "4", Name: "Monitor", Price: 299.99, Category: "displays"},
+	},
+}
+
+func TestColdStartNeverEmpty(t *testing.T) {
+	setTable(t, freshTable)
+	now := time.Now()
+
+	for _, id := range []string{"1", "unknown"} {
+		recs := coldStartRecommendations(id, now)
+		if len(recs) == 0 {
+			t.Errorf("product %s: no cold-start recommendations", id)
+		}
+		for _, p := range recs {
+			if p.ID == id {
+				t.Errorf("product %s recommended to itself", id)
+			}
+		}
+	}
+}
+
+func TestColdStartEmptyCatalog(t *testing.T) {
+	setTable(t, map[string][]models.Product{})
+	recs := coldStartRecommendations("1", time.Now())
+	if recs == nil || len(recs) != 0 {
+		t.Errorf("got %v, want an empty, non-nil list", recs)
+	}
+}
+
+func TestColdStartScoring(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	setTable(t, map[string][]models.Product{
+		"seed": {
+			{ID: "viewed", Price: 50, Category: "accessories"},
+			{ID: "far-band", Price: 5000, Category: "computers"},
+			{ID: "same-band", Price: 20, Category: "computers"},
+			{ID: "near-band", Price: 400, Category: "computers"},
+			{ID: "new", Price: 5000, Category: "computers",
+				Availability: &models.Availability{ReleaseDate: now.AddDate(0, 0, -10).Format(models.DateLayout)}},
+			{ID: "weighted", Price: 5000, Category: "audio"},
+			{ID: "excluded", Price: 20, Category: "refurbished"},
+		},
+	})
+	coldStart.categoryWeights = map[string]float64{"audio": 2, "refurbished": 0}
+	coldStart.limit = 10
+
+	// weighted 2, new 1.5, same-band 1.5, near-band 1.2, far-band 1, ties
+	// in ID order; a zero category weight removes the product
+	got := ids(coldStartRecommendations("viewed", now))
+	want := []string{"weighted", "new", "same-band", "near-band", "far-band"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	coldStart.limit = 2
+	if got := coldStartRecommendations("viewed", now); len(got) != 2 {
+		t.Errorf("COLD_START_LIMIT 2: got %d items", len(got))
+	}
+}
+
+func TestHandlerServesColdStartWithoutData(t *testing.T) {
+	setTable(t, freshTable)
+
+	for _, id := range []string{"1", "unknown"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/recommendations/"+id+"?strategy="+strategyTable, nil)
+		getRecommendationsHandler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("product %s: status %d, body %s", id, rec.Code, rec.Body)
+		}
+		if src := rec.Header().Get("X-Recommendations-Source"); src != "cold-start" {
+			t.Errorf("product %s: X-Recommendations-Source = %q, want cold-start", id, src)
+		}
+		var recs []models.Product
+		if err := json.Unmarshal(rec.Body.Bytes(), &recs); err != nil {
+			t.Fatal(err)
+		}
+		if len(recs) == 0 {
+			t.Errorf("product %s: empty recommendations on a fresh deployment", id)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/chaos"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+)
+
+// Environment variables read by the service. Loaders read them through
+// settings.Value, so the defaults here are the only ones.
+var settings = config.Settings{
+	{Name: "LISTEN_ADDR", Default: ":8082", Validate: config.Addr},
+	{Name: "SIMULATE_FAILURE", Default: "false", Validate: config.Bool},
+	{Name: "SIMULATE_CORRUPTION", Default: "none", Validate: config.Enum(chaos.Modes...)},
+	{Name: "ADMIN_TOKEN", Secret: true}, // Bearer token for /admin/ endpoints (unset = disabled)
+	{Name: "LOG_FORMAT", Default: "json", Validate: config.Enum(logging.Formats...)},
+	{Name: "LOG_LEVEL", Default: "info", Validate: config.Enum(logging.Levels...)},
+	{Name: "SHUTDOWN_TIMEOUT", Default: "15s", Validate: config.Duration},
+	{Name: "SHUTDOWN_DELAY", Default: "0s", Validate: config.DurationOrZero},
+	{Name: "WATCHDOG_THRESHOLD", Default: "10s", Validate: config.Duration},
+	{Name: "PRODUCT_SERVICE_URL", Default: "http://localhost:8081", Validate: config.URL},
+	{Name: "CATALOG_CHECK_INTERVAL", Default: "", Validate: config.Optional(config.Duration)},
+	{Name: "CATALOG_CHECK_REMOVE", Default: "false", Validate: config.Bool},
+	{Name: "RECOMMENDATIONS_FILE", Default: ""},
+	{Name: "REDIS_URL", Default: "", Validate: validRedisURL, Secret: true}, // May carry a password
+	{Name: "REDIS_KEY", Default: "recommendations"},
+	{Name: "RECOMMENDATIONS_RELOAD_INTERVAL", Default: "10s", Validate: config.Duration},
+	{Name: "MODEL_MAX_VERSIONS", Default: "10", Validate: config.Int(1)},
+	{Name: "SHADOW_MIN_SAMPLES", Default: "50", Validate: config.Int(1)},
+	{Name: "ACTIVATION_MAX_CHANGE_PCT", Default: "50", Validate: config.Float(0, 100)},
+	{Name: "GUARDRAIL_TOP_K", Default: "3", Validate: config.Int(1)},
+	{Name: "RECOMMENDATION_MODE", Default: "table", Validate: config.Enum("table", "embedding", "bandit")},
+	{Name: "BANDIT_EPSILON", Default: "0.1", Validate: config.Float(0, 1)},
+	{Name: "BANDIT_STATE_PATH", Default: "", Validate: config.Optional(config.WritablePath)},
+	{Name: "EMBEDDER", Default: "hashing", Validate: config.Enum("hashing", "api")},
+	{Name: "EMBEDDING_DIMS", Default: "1024", Validate: config.Int(1)},
+	{Name: "EMBEDDING_API_URL", Default: "", Validate: config.URL},
+	{Name: "EMBEDDING_NEIGHBORS", Default: "5", Validate: config.Int(1)},
+	{Name: "COLD_START_CATEGORY_WEIGHTS", Default: "", Validate: config.KeyValueList},
+	{Name: "COLD_START_NEW_DAYS", Default: "90", Validate: config.Int(0)},
+	{Name: "COLD_START_LIMIT", Default: "5", Validate: config.Int(1)},
+}
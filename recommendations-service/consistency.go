@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Catalog consistency check. Every CATALOG_CHECK_INTERVAL the service looks
+// up each product ID in its recommendations table (pages and recommended
+// items) in product-service:
+//
+//	orphan  product-service answers 404: the table points at a product that
+//	        no longer exists
+//	stale   the product exists but its name or price differ from the copy
+//	        in the table
+//
+// With CATALOG_CHECK_REMOVE=true, orphans are dropped by publishing a
+// cleaned copy of the table as a new model version (source "consistency"),
+// so the removal can be rolled back like any other. The new version has to
+// pass the guardrail, and is dropped if another version was activated
+// while the check ran. Lookups that fail any
+// other way are counted as errors and never cause removals.
+//
+//	PRODUCT_SERVICE_URL     default http://localhost:8081
+//	CATALOG_CHECK_INTERVAL  e.g. 5m (unset = only on demand)
+//	CATALOG_CHECK_REMOVE    true|false (default false)
+//
+// GET /admin/catalog-check returns the last report, POST runs a check now
+// (admin token required). Counts are exported on /metrics.
+
+const catalogLookupTimeout = 2 * time.Second
+
+var catalogCheck = struct {
+	productURL string
+	remove     bool
+	client     *http.Client
+
+	run     sync.Mutex // One check at a time
+	mu      sync.Mutex
+	last    *CatalogReport
+	removed int // Orphan references removed since startup
+}{productURL: "http://localhost:8081", client: &http.Client{Timeout: catalogLookupTimeout}}
+
+type CatalogIssue struct {
+	ProductID    string   `json:"product_id"`
+	ReferencedBy []string `json:"referenced_by,omitempty"` // Pages recommending it
+	HasPage      bool     `json:"has_page"`                // It has its own recommendations entry
+	Detail       string   `json:"detail,omitempty"`
+}
+
+type CatalogReport struct {
+	CheckedAt       time.Time      `json:"checked_at"`
+	ModelVersion    string         `json:"model_version"`
+	ProductsChecked int            `json:"products_checked"`
+	Orphans         []CatalogIssue `json:"orphans"`
+	Stale           []CatalogIssue `json:"stale"`
+	Errors          int            `json:"errors"`
+	RemovedVersion  string         `json:"removed_version,omitempty"` // Version published without the orphans
+}
+
+func loadCatalogCheckFromEnv() {
+	if v := settings.Value("PRODUCT_SERVICE_URL"); v != "" {
+		catalogCheck.productURL = strings.TrimSuffix(v, "/")
+	}
+	catalogCheck.remove = settings.Value("CATALOG_CHECK_REMOVE") == "true"
+	if v, err := time.ParseDuration(settings.Value("CATALOG_CHECK_INTERVAL")); err == nil && v > 0 {
+		go func() {
+			for range time.Tick(v) {
+				runCatalogCheck(context.Background())
+			}
+		}()
+		slog.Info("Catalog consistency check scheduled", "interval", v.String(), "remove_orphans", catalogCheck.remove)
+	}
+}
+
+// catalogLookup fetches one product; found is false on a 404
+func catalogLookup(ctx context.Context, id string) (p models.Product, found bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, catalogLookupTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, catalogCheck.productURL+"/product/"+url.PathEscape(id), nil)
+	if err != nil {
+		return p, false, err
+	}
+	resp, err := catalogCheck.client.Do(req)
+	if err != nil {
+		return p, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return p, false, err
+		}
+		p, err = models.DecodeProduct(data, false)
+		return p, err == nil, err
+	case http.StatusNotFound:
+		return p, false, nil
+	default:
+		return p, false, fmt.Errorf("product-service returned status %d", resp.StatusCode)
+	}
+}
+
+// runCatalogCheck checks the active table and, if configured, removes
+// orphans
+func runCatalogCheck(ctx context.Context) CatalogReport {
+	catalogCheck.run.Lock()
+	defer catalogCheck.run.Unlock()
+
+	version := activeModelVersion()
+	recommendationsMu.RLock()
+	table := recommendations
+	recommendationsMu.RUnlock()
+
+	// Every ID, with the pages recommending it and its table copy
+	referencedBy := map[string][]string{}
+	copies := map[string]models.Product{}
+	for page, recs := range table {
+		if _, ok := referencedBy[page]; !ok {
+			referencedBy[page] = nil
+		}
+		for _, p := range recs {
+			referencedBy[p.ID] = append(referencedBy[p.ID], page)
+			copies[p.ID] = p
+		}
+	}
+	ids := make([]string, 0, len(referencedBy))
+	for id := range referencedBy {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	report := CatalogReport{
+		CheckedAt:       time.Now().UTC(),
+		ModelVersion:    version,
+		ProductsChecked: len(ids),
+		Orphans:         []CatalogIssue{},
+		Stale:           []CatalogIssue{},
+	}
+	orphaned := map[string]bool{}
+	for _, id := range ids {
+		_, hasPage := table[id]
+		refs := referencedBy[id]
+		sort.Strings(refs)
+		actual, found, err := catalogLookup(ctx, id)
+		switch {
+		case err != nil:
+			slog.Warn("Catalog lookup failed", "product_id", id, "error", err)
+			report.Errors++
+		case !found:
+			orphaned[id] = true
+			report.Orphans = append(report.Orphans, CatalogIssue{ProductID: id, ReferencedBy: refs, HasPage: hasPage})
+		default:
+			c, ok := copies[id]
+			if !ok {
+				continue
+			}
+			var diffs []string
+			if c.Name != actual.Name {
+				diffs = append(diffs, fmt.Sprintf("name %q, catalog has %q", c.Name, actual.Name))
+			}
+			if c.Price != actual.Price {
+				diffs = append(diffs, fmt.Sprintf("price %.2f, catalog has %.2f", c.Price, actual.Price))
+			}
+			if len(diffs) > 0 {
+				report.Stale = append(report.Stale, CatalogIssue{ProductID: id, ReferencedBy: refs, HasPage: hasPage,
+					Detail: strings.Join(diffs, "; ")})
+			}
+		}
+	}
+
+	removed := 0
+	if catalogCheck.remove && len(orphaned) > 0 {
+		cleaned := make(map[string][]models.Product, len(table))
+		for page, recs := range table {
+			if orphaned[page] {
+				continue
+			}
+			kept := slices.DeleteFunc(slices.Clone(recs), func(p models.Product) bool { return orphaned[p.ID] })
+			removed += len(recs) - len(kept)
+			cleaned[page] = kept
+		}
+		removed += len(table) - len(cleaned)
+		// Lookups are slow: don't revert a version activated meanwhile
+		if m, err := publishModelOver(version, cleaned, "consistency", true); errors.Is(err, errModelChanged) {
+			slog.Warn("Model changed during the catalog check, orphans not removed", "checked_version", version, "error", err)
+			removed = 0
+		} else if err != nil {
+			slog.Error("Couldn't publish table without orphans", "error", err)
+			removed = 0
+		} else {
+			report.RemovedVersion = m.Version
+			slog.Warn("Removed orphaned catalog references", "orphans", len(orphaned), "references", removed, "version", m.Version)
+		}
+	}
+
+	slog.Info("Catalog consistency check finished", "checked", report.ProductsChecked,
+		"orphans", len(report.Orphans), "stale", len(report.Stale), "errors", report.Errors)
+	catalogCheck.mu.Lock()
+	catalogCheck.last = &report
+	catalogCheck.removed += removed
+	catalogCheck.mu.Unlock()
+	return report
+}
+
+func catalogCheckHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		catalogCheck.mu.Lock()
+		last := catalogCheck.last
+		catalogCheck.mu.Unlock()
+		if last == nil {
+			jsonutil.Write(w, http.StatusOK, map[string]interface{}{"checked_at": nil})
+			return
+		}
+		jsonutil.Write(w, http.StatusOK, last)
+	case http.MethodPost:
+		jsonutil.Write(w, http.StatusOK, runCatalogCheck(r.Context()))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// metricsHandler serves the catalog check counts in the Prometheus text
+// format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	catalogCheck.mu.Lock()
+	last, removed := catalogCheck.last, catalogCheck.removed
+	catalogCheck.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, "# HELP recommendations_catalog_orphan_references_removed_total Orphaned references removed from the table.\n# TYPE recommendations_catalog_orphan_references_removed_total counter\n")
+	fmt.Fprintf(w, "recommendations_catalog_orphan_references_removed_total %d\n", removed)
+	if last == nil {
+		return
+	}
+	for _, g := range []struct {
+		name, help string
+		value      float64
+	}{
+		{"recommendations_catalog_orphans", "Products in the table that product-service doesn't know, at the last check.", float64(len(last.Orphans))},
+		{"recommendations_catalog_stale", "Products whose name or price differ from product-service, at the last check.", float64(len(last.Stale))},
+		{"recommendations_catalog_check_errors", "Lookups that failed during the last check.", float64(last.Errors)},
+		{"recommendations_catalog_last_check_timestamp_seconds", "When the last check ran.", float64(last.CheckedAt.Unix())},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name,
+			strconv.FormatFloat(g.value, 'f', -1, 64))
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/circuitbreaker"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Embedding-based similarity. With RECOMMENDATION_MODE=embedding, each
+// catalog product's name, category and description are embedded into a
+// vector and kept in an in-memory index; a product's recommendations are
+// its nearest neighbours by cosine similarity. Products the index can't
+// answer for, or any embedder failure, fall back to the table.
+//
+//	RECOMMENDATION_MODE  table|embedding|bandit (default table; bandit is in bandit.go)
+//	EMBEDDER             hashing|api (default hashing)
+//	EMBEDDING_DIMS       vector size of the hashing embedder (default 1024)
+//	EMBEDDING_API_URL    api embedder endpoint: POST {"input": text} -> {"embedding": [...]}
+//	EMBEDDING_NEIGHBORS  recommendations returned (default 5)
+//
+// The hashing embedder is local and deterministic (hashed bag of words), so
+// it works offline. The api embedder calls an external model behind its own
+// circuit breaker. The index re-embeds only products whose text changed, so
+// a restored table is picked up on the next request.
+
+const embeddingAPITimeout = 2 * time.Second
+
+var embedding = struct {
+	enabled   bool     // Always serve by similarity
+	embedder  Embedder // Set in embedding and bandit modes
+	neighbors int
+}{neighbors: 5}
+
+// Embedder turns product text into a vector
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+func loadEmbeddingFromEnv() {
+	mode := settings.Value("RECOMMENDATION_MODE")
+	embedding.enabled = mode == "embedding"
+	if mode != "embedding" && mode != "bandit" {
+		return
+	}
+	if v, err := strconv.Atoi(settings.Value("EMBEDDING_NEIGHBORS")); err == nil && v > 0 {
+		embedding.neighbors = v
+	}
+	switch settings.Value("EMBEDDER") {
+	case "api":
+		embedding.embedder = newAPIEmbedder(settings.Value("EMBEDDING_API_URL"))
+	default:
+		dims := 1024
+		if v, err := strconv.Atoi(settings.Value("EMBEDDING_DIMS")); err == nil && v > 0 {
+			dims = v
+		}
+		embedding.embedder = hashingEmbedder{dims: dims}
+	}
+	slog.Info("Embedding recommendations available", "embedder", fmt.Sprintf("%T", embedding.embedder),
+		"neighbors", embedding.neighbors)
+}
+
+// hashingEmbedder hashes each word into one of dims buckets (feature
+// hashing); the sign comes from a second hash bit so collisions tend to
+// cancel out
+type hashingEmbedder struct {
+	dims int
+}
+
+func (e hashingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vec := make([]float64, e.dims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vec[sum%uint64(e.dims)] += sign
+	}
+	return normalize(vec), nil
+}
+
+// apiEmbedder calls an external embedding service
+type apiEmbedder struct {
+	url     string
+	client  *http.Client
+	breaker *circuitbreaker.CircuitBreaker
+}
+
+func newAPIEmbedder(url string) *apiEmbedder {
+	return &apiEmbedder{
+		url:     url,
+		client:  &http.Client{Timeout: embeddingAPITimeout},
+		breaker: circuitbreaker.NewCircuitBreaker(circuitbreaker.DefaultConfig()),
+	}
+}
+
+func (e *apiEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	var vec []float64
+	err := e.breaker.Execute(func() error {
+		body, err := json.Marshal(map[string]string{"input": text})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("embedding API returned status %d", resp.StatusCode)
+		}
+		var out struct {
+			Embedding []float64 `json:"embedding"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return fmt.Errorf("invalid embedding response: %v", err)
+		}
+		if len(out.Embedding) == 0 {
+			return fmt.Errorf("embedding API returned an empty vector")
+		}
+		vec = normalize(out.Embedding)
+		return nil
+	})
+	return vec, err
+}
+
+func normalize(vec []float64) []float64 {
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range vec {
+			vec[i] /= norm
+		}
+	}
+	return vec
+}
+
+// cosine of two unit vectors; vectors of different sizes (an embedder
+// change) are unrelated
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+func embeddingText(p models.Product) string {
+	return strings.Join([]string{p.Name, p.Category, p.Description}, " ")
+}
+
+type indexEntry struct {
+	product models.Product
+	text    string
+	vector  []float64
+}
+
+// vectorIndex is a brute-force nearest-neighbour index over the catalog,
+// which is small enough that scanning beats maintaining a tree
+type vectorIndex struct {
+	mu      sync.RWMutex
+	entries map[string]indexEntry // Keyed by product ID
+}
+
+var productIndex = &vectorIndex{entries: map[string]indexEntry{}}
+
+// sync makes the index match products, embedding new or changed ones
+func (ix *vectorIndex) sync(ctx context.Context, e Embedder, products []models.Product) error {
+	ix.mu.RLock()
+	var stale []models.Product
+	indexed := 0
+	for _, p := range products {
+		entry, ok := ix.entries[p.ID]
+		if ok {
+			indexed++
+		}
+		if !ok || entry.text != embeddingText(p) {
+			stale = append(stale, p)
+		}
+	}
+	removed := len(ix.entries) - indexed
+	ix.mu.RUnlock()
+	if len(stale) == 0 && removed == 0 {
+		return nil
+	}
+
+	fresh := make(map[string]indexEntry, len(stale))
+	for _, p := range stale {
+		text := embeddingText(p)
+		vec, err := e.Embed(ctx, text)
+		if err != nil {
+			return fmt.Errorf("embedding product %s: %w", p.ID, err)
+		}
+		fresh[p.ID] = indexEntry{product: p, text: text, vector: vec}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	entries := make(map[string]indexEntry, len(products))
+	for _, p := range products {
+		if entry, ok := fresh[p.ID]; ok {
+			entries[p.ID] = entry
+		} else if entry, ok := ix.entries[p.ID]; ok {
+			entries[p.ID] = entry
+		}
+	}
+	ix.entries = entries
+	slog.Debug("Vector index synced", "products", len(entries), "embedded", len(fresh))
+	return nil
+}
+
+// nearest returns up to k products most similar to id, or false when id
+// isn't indexed
+func (ix *vectorIndex) nearest(id string, k int) ([]models.Product, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	target, ok := ix.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	type scored struct {
+		p          models.Product
+		similarity float64
+	}
+	candidates := make([]scored, 0, len(ix.entries))
+	for otherID, entry := range ix.entries {
+		if otherID != id {
+			candidates = append(candidates, scored{entry.product, cosine(target.vector, entry.vector)})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].similarity != candidates[j].similarity {
+			return candidates[i].similarity > candidates[j].similarity
+		}
+		return candidates[i].p.ID < candidates[j].p.ID
+	})
+
+	recs := make([]models.Product, 0, min(k, len(candidates)))
+	for _, c := range candidates[:min(k, len(candidates))] {
+		recs = append(recs, c.p)
+	}
+	return recs, true
+}
+
+// similarRecommendations answers from the vector index; false means the
+// caller should fall back to the table
+func similarRecommendations(ctx context.Context, id string) ([]models.Product, bool, error) {
+	if err := productIndex.sync(ctx, embedding.embedder, catalogProducts()); err != nil {
+		return nil, false, err
+	}
+	recs, ok := productIndex.nearest(id, embedding.neighbors)
+	return recs, ok, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Feedback scoring. POST /feedback (forwarded by the gateway) credits a
+// recommended product on a product's page; recommendations are then served
+// highest score first, before availability ranking and editorial overrides
+// are applied. Purchases count for more than clicks. Both IDs must be in
+// the active recommendations table, so unauthenticated callers can't grow
+// the scores without bound.
+
+var feedbackWeights = map[string]float64{
+	models.FeedbackClick:    1,
+	models.FeedbackPurchase: 5,
+}
+
+var feedbackScores = struct {
+	mu     sync.RWMutex
+	scores map[string]map[string]float64 // product ID -> recommended ID -> score
+}{scores: map[string]map[string]float64{}}
+
+// rankByFeedback orders recs by score, keeping the table order for ties
+func rankByFeedback(id string, recs []models.Product) []models.Product {
+	feedbackScores.mu.RLock()
+	defer feedbackScores.mu.RUnlock()
+	scores := feedbackScores.scores[id]
+	if len(scores) == 0 {
+		return recs
+	}
+
+	ranked := append([]models.Product(nil), recs...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].ID] > scores[ranked[j].ID]
+	})
+	return ranked
+}
+
+// inTable reports whether id has a page or is recommended anywhere in the
+// recommendations table
+func inTable(id string) bool {
+	recommendationsMu.RLock()
+	_, ok := recommendations[id]
+	recommendationsMu.RUnlock()
+	if ok {
+		return true
+	}
+	_, ok = knownProduct(id)
+	return ok
+}
+
+func feedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var fb models.Feedback
+	if err := json.NewDecoder(r.Body).Decode(&fb); err != nil {
+		apperrors.Write(w, fmt.Errorf("invalid JSON: %v: %w", err, apperrors.ErrValidation))
+		return
+	}
+	weight, ok := feedbackWeights[fb.Event]
+	if !ok || fb.ProductID == "" || fb.RecommendedID == "" {
+		apperrors.Write(w, fmt.Errorf("feedback needs product_id, recommended_id and a click or purchase event: %w", apperrors.ErrValidation))
+		return
+	}
+
+	for _, id := range []string{fb.ProductID, fb.RecommendedID} {
+		if !inTable(id) {
+			apperrors.Write(w, fmt.Errorf("product %q is unknown: %w", id, apperrors.ErrValidation))
+			return
+		}
+	}
+
+	feedbackScores.mu.Lock()
+	if feedbackScores.scores[fb.ProductID] == nil {
+		feedbackScores.scores[fb.ProductID] = map[string]float64{}
+	}
+	feedbackScores.scores[fb.ProductID][fb.RecommendedID] += weight
+	score := feedbackScores.scores[fb.ProductID][fb.RecommendedID]
+	feedbackScores.mu.Unlock()
+	banditReward(fb, weight)
+
+	logging.For(r.Context(), slog.Default()).Info("Feedback recorded", "product_id", fb.ProductID,
+		"recommended_id", fb.RecommendedID, "event", fb.Event, "strategy", fb.Strategy, "score", score)
+	jsonutil.Write(w, http.StatusAccepted, map[string]interface{}{"score": score})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+func TestFeedbackRejectsUnknownProducts(t *testing.T) {
+	setTable(t, map[string][]models.Product{
+		"1": {{ID: "2", Name: "Mouse"}},
+	})
+	feedbackScores.mu.Lock()
+	saved := feedbackScores.scores
+	feedbackScores.scores = map[string]map[string]float64{}
+	feedbackScores.mu.Unlock()
+	t.Cleanup(func() {
+		feedbackScores.mu.Lock()
+		feedbackScores.scores = saved
+		feedbackScores.mu.Unlock()
+	})
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"product_id": "1", "recommended_id": "2", "event": "click"}`, http.StatusAccepted},
+		{`{"product_id": "2", "recommended_id": "1", "event": "click"}`, http.StatusAccepted}, // Both in the table
+		{`{"product_id": "nope", "recommended_id": "2", "event": "click"}`, http.StatusBadRequest},
+		{`{"product_id": "1", "recommended_id": "nope", "event": "purchase"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		feedbackHandler(rec, httptest.NewRequest(http.MethodPost, "/feedback", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d; body %s", tt.body, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	feedbackScores.mu.RLock()
+	defer feedbackScores.mu.RUnlock()
+	if _, ok := feedbackScores.scores["nope"]; ok || len(feedbackScores.scores["1"]) != 1 {
+		t.Errorf("scores = %v, want only known products", feedbackScores.scores)
+	}
+}
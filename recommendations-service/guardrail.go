@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Rate-of-change guardrail. Activating a model version through
+// /admin/models compares its top recommendations with the active version's
+// and refuses (409) when more than ACTIVATION_MAX_CHANGE_PCT of them
+// changed, which is what a corrupt recomputation usually looks like. A
+// blocked upload is still stored, inactive, so it can be shadow-evaluated
+// and then activated with "force": true.
+//
+//	ACTIVATION_MAX_CHANGE_PCT  share of top slots allowed to change (default 50, 100 = off)
+//	GUARDRAIL_TOP_K            slots per product compared (default 3)
+//
+// Rollbacks and /admin/restore skip the guardrail: they are how an
+// operator gets out of trouble.
+
+var guardrail = struct {
+	maxChangePct float64
+	topK         int
+}{maxChangePct: 50, topK: 3}
+
+func loadGuardrailFromEnv() {
+	if v, err := strconv.ParseFloat(settings.Value("ACTIVATION_MAX_CHANGE_PCT"), 64); err == nil && v >= 0 && v <= 100 {
+		guardrail.maxChangePct = v
+	}
+	if v, err := strconv.Atoi(settings.Value("GUARDRAIL_TOP_K")); err == nil && v > 0 {
+		guardrail.topK = v
+	}
+}
+
+// guardrailError reports an activation the guardrail refused
+type guardrailError struct {
+	Version    string
+	ChangedPct float64
+}
+
+func (e *guardrailError) Error() string {
+	return fmt.Sprintf("activating %s would change %.1f%% of top-%d recommendations (limit %.0f%%); pass \"force\": true to override",
+		e.Version, e.ChangedPct, guardrail.topK, guardrail.maxChangePct)
+}
+
+// topChangePct is the percentage of top-k slots that differ between the
+// two tables. A slot counts as changed when its product isn't among the
+// other table's top k for the same product, whatever its position.
+// Products only one table has count as entirely changed.
+func topChangePct(from, to map[string][]models.Product, k int) float64 {
+	top := func(recs []models.Product) []string {
+		ids := make([]string, 0, k)
+		for _, p := range recs[:min(k, len(recs))] {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	var slots, changed int
+	seen := map[string]bool{}
+	for _, table := range []map[string][]models.Product{from, to} {
+		for id := range table {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			before, after := top(from[id]), top(to[id])
+			kept := 0
+			for _, rec := range after {
+				if slices.Contains(before, rec) {
+					kept++
+				}
+			}
+			slots += max(len(before), len(after))
+			changed += max(len(before), len(after)) - kept
+		}
+	}
+	if slots == 0 {
+		return 0
+	}
+	return float64(changed) / float64(slots) * 100
+}
+
+// checkGuardrailLocked refuses activating m unless the output moves less
+// than the limit; modelStore.mu must be held
+func checkGuardrailLocked(m *ModelVersion) error {
+	if guardrail.maxChangePct >= 100 || modelStore.active == "" {
+		return nil
+	}
+	active := findModelLocked(modelStore.active)
+	if active == nil {
+		return nil
+	}
+	if pct := topChangePct(active.table, m.table, guardrail.topK); pct > guardrail.maxChangePct {
+		return &guardrailError{Version: m.Version, ChangedPct: pct}
+	}
+	return nil
+}
+
+func writeGuardrailError(w http.ResponseWriter, err *guardrailError) {
+	apperrors.WriteProblem(w, apperrors.Problem{
+		Type:   "/problems/activation-guardrail",
+		Title:  "Activation blocked by guardrail",
+		Status: http.StatusConflict,
+		Detail: err.Error(),
+	})
+}
@@ -1,54 +1,60 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
-)
 
-type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	Description string  `json:"description"`
-}
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/chaos"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/config"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/httpserver"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/snapshot"
+)
 
-var recommendations = map[string][]Product{
+var recommendations = map[string][]models.Product{
 	"1": {
-		{ID: "3", Name: "Keyboard", Price: 79.99, Description: "Mechanical keyboard"},
-		{ID: "2", Name: "Mouse", Price: 29.99, Description: "Wireless mouse"},
+		{ID: "6", Name: "VR Headset", Price: 499.99, Description: "Standalone VR headset", Category: "vr",
+			Availability: &models.Availability{PreorderDate: models.DaysFromNow(-7), ReleaseDate: models.DaysFromNow(30)}},
+		{ID: "3", Name: "Keyboard", Price: 79.99, Description: "Mechanical keyboard", Category: "accessories"},
+		{ID: "2", Name: "Mouse", Price: 29.99, Description: "Wireless mouse", Category: "accessories"},
 	},
 	"2": {
-		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop"},
-		{ID: "4", Name: "Monitor", Price: 299.99, Description: "4K display"},
+		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop", Category: "computers"},
+		{ID: "4", Name: "Monitor", Price: 299.99, Description: "4K display", Category: "displays"},
 	},
 	"3": {
-		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop"},
-		{ID: "2", Name: "Mouse", Price: 29.99, Description: "Wireless mouse"},
+		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop", Category: "computers"},
+		{ID: "2", Name: "Mouse", Price: 29.99, Description: "Wireless mouse", Category: "accessories"},
 	},
 	"4": {
-		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop"},
-		{ID: "5", Name: "Headphones", Price: 149.99, Description: "Noise-cancelling headphones"},
+		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop", Category: "computers"},
+		{ID: "5", Name: "Headphones", Price: 149.99, Description: "Noise-cancelling headphones", Category: "audio"},
 	},
 	"5": {
-		{ID: "4", Name: "Monitor", Price: 299.99, Description: "4K display"},
-		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop"},
+		{ID: "4", Name: "Monitor", Price: 299.99, Description: "4K display", Category: "displays"},
+		{ID: "1", Name: "Laptop", Price: 999.99, Description: "High-performance laptop", Category: "computers"},
 	},
 }
 
 func getRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if we should simulate failure
-	failureMode := os.Getenv("SIMULATE_FAILURE")
-	log.Printf("SIMULATE_FAILURE env var: '%s'", failureMode)
+	logger := logging.For(r.Context(), slog.Default())
+	failureMode := settings.Value("SIMULATE_FAILURE")
+	logger.Debug("Checked failure mode", "simulate_failure", failureMode)
 	
 	if failureMode == "true" {
-		log.Println("⚠️  Simulating failure - hanging for 30 seconds...")
+		logger.Warn("Simulating failure - hanging for 30 seconds")
 		// Simulate a stuck database query or downstream service timeout
 		time.Sleep(30 * time.Second)
-		log.Println("⚠️  Timeout complete, returning error")
+		logger.Warn("Simulated timeout complete, returning error")
 		http.Error(w, "Service timeout", http.StatusRequestTimeout)
 		return
 	}
@@ -56,35 +62,130 @@ func getRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from path
 	path := strings.TrimPrefix(r.URL.Path, "/recommendations/")
 	id := strings.TrimSpace(path)
+	// Product model version the client reads (internal/models/version.go)
+	version, err := models.ParseProductVersion(r.Header.Get(models.ProductVersionHeader))
+	if err != nil {
+		apperrors.Write(w, fmt.Errorf("%v: %w", err, apperrors.ErrValidation))
+		return
+	}
+	w.Header().Set(models.ProductVersionHeader, strconv.Itoa(version))
 
-	recs, exists := recommendations[id]
-	if !exists {
-		// Return empty list if no recommendations
-		recs = []Product{}
+	now := time.Now()
+	w.Header().Set(modelVersionHeader, activeModelVersion())
+	// ?strategy= pins the strategy for offline evaluation (cmd/evaluate);
+	// such requests stay out of the bandit and shadow statistics
+	strategy, live := chooseStrategy(), true
+	if q := r.URL.Query().Get("strategy"); q != "" {
+		if q != strategyTable && (q != strategyEmbedding || embedding.embedder == nil) {
+			apperrors.Write(w, fmt.Errorf("strategy %q is not available: %w", q, apperrors.ErrValidation))
+			return
+		}
+		strategy, live = q, false
+	}
+	w.Header().Set("X-Recommendations-Strategy", strategy)
+	if strategy == strategyEmbedding {
+		recs, ok, err := similarRecommendations(r.Context(), id)
+		if err != nil {
+			logger.Warn("Embedding recommendations failed, using table", "product_id", id, "error", err)
+		}
+		if ok {
+			w.Header().Set("X-Recommendations-Source", "embedding")
+			logger.Info("Embedding recommendations", "product_id", id, "count", len(recs))
+			recs = applyOverride(id, rankByAvailability(rankByFeedback(id, recs), now), now)
+			if live {
+				banditServed(strategy, id, recs)
+			}
+			jsonutil.Write(w, http.StatusOK, models.EncodeList(version, recs))
+			return
+		}
+	}
+
+	recs, exists := lookupRecommendations(id)
+	logger.Info("Recommendations lookup", "product_id", id, "count", len(recs))
+	if !exists || len(recs) == 0 {
+		// No behavioral data yet; seed from catalog signals
+		recs = coldStartRecommendations(id, now)
+		w.Header().Set("X-Recommendations-Source", "cold-start")
+		logger.Info("Serving cold-start recommendations", "product_id", id, "count", len(recs))
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(recs)
+	recs = rankByAvailability(rankByFeedback(id, recs), now)
+	if live {
+		shadowCompare(id, recs, now)
+	}
+	recs = applyOverride(id, recs, now)
+	if live {
+		banditServed(strategy, id, recs)
+	}
+	jsonutil.Write(w, http.StatusOK, models.EncodeList(version, recs))
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// rankByAvailability moves items that can't ship yet (unreleased or on
+// preorder) behind released ones, keeping the order within each group
+func rankByAvailability(recs []models.Product, now time.Time) []models.Product {
+	ranked := make([]models.Product, 0, len(recs))
+	var later []models.Product
+	for _, p := range recs {
+		p = p.WithStatus(now)
+		if p.Availability != nil && p.Availability.Unreleased(now) {
+			later = append(later, p)
+			continue
+		}
+		ranked = append(ranked, p)
+	}
+	return append(ranked, later...)
 }
 
 func main() {
-	failureMode := os.Getenv("SIMULATE_FAILURE")
+	flag.Parse()
+	logging.Setup("recommendations-service")
+	config.RunSelfCheck(settings, nil)
+	settings.MustValidate()
+	loadColdStartFromEnv()
+	loadEmbeddingFromEnv()
+	loadModelStoreFromEnv()
+	loadShadowFromEnv()
+	loadGuardrailFromEnv()
+	loadBanditFromEnv()
+	loadCatalogCheckFromEnv()
+	loadSourceFromEnv()
+	httpserver.OnShutdown(saveBanditState)
+
+	failureMode := settings.Value("SIMULATE_FAILURE")
 	if failureMode == "true" {
-		log.Println("⚠️  RUNNING IN FAILURE MODE - Will timeout on all requests")
+		slog.Warn("Running in failure mode - will time out on all requests")
 	} else {
-		log.Println("Running in normal mode")
+		slog.Info("Running in normal mode")
 	}
 
-	http.HandleFunc("/recommendations/", getRecommendationsHandler)
-	http.HandleFunc("/health", healthHandler)
+	http.Handle("/recommendations/", chaos.Corrupt(http.HandlerFunc(getRecommendationsHandler)))
+	http.HandleFunc("/feedback", feedbackHandler)
+	http.HandleFunc("/health", httpserver.HealthHandler)
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/debug/runtime", httpserver.RuntimeHandler)
 
-	log.Println("Recommendations Service starting on :8082")
-	if err := http.ListenAndServe(":8082", nil); err != nil {
-		log.Fatal(err)
-	}
+	// Resource pressure simulation, admin only
+	pressure := httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), chaos.PressureHandler())
+	http.Handle("/admin/pressure", pressure)
+	http.Handle("/admin/pressure/", pressure)
+
+	// Recommendations snapshot / restore, admin only
+	snapshots := httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), snapshot.Handler("recommendations-service", recommendationsState{}))
+	http.Handle("/admin/snapshot", snapshots)
+	http.Handle("/admin/restore", snapshots)
+
+	// Editorial pins and blocks, admin only
+	http.Handle("/admin/overrides", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(overridesHandler)))
+
+	// Model versions and rollback, admin only
+	http.Handle("/admin/models", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(modelsHandler)))
+	http.Handle("/admin/models/activate", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(activateModelHandler)))
+	http.Handle("/admin/catalog-check", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(catalogCheckHandler)))
+	http.Handle("/admin/bandit", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(banditHandler)))
+	http.Handle("/admin/models/shadow", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(shadowReportHandler)))
+	http.Handle("/admin/models/rollback", httpserver.RequireToken(settings.Value("ADMIN_TOKEN"), http.HandlerFunc(rollbackModelHandler)))
+
+	addr := settings.Value("LISTEN_ADDR")
+	slog.Info("Recommendations Service starting", "addr", addr)
+	httpserver.Run(addr, logging.RequestID(httpserver.Watchdog(http.DefaultServeMux)))
 }
\ No newline at end of file
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/apperrors"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/logging"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Editorial overrides let merchandisers pin or block recommendations per
+// product, on /admin/overrides (admin token required):
+//
+//	GET    /admin/overrides                  every override
+//	PUT    /admin/overrides  {"product_id": "1", "pinned": ["5"], "blocked": ["2"]}
+//	DELETE /admin/overrides?product_id=1
+//
+// Pinned products lead the list in the order given, ahead of the ranked
+// recommendations; blocked products are never returned, whatever else says
+// so. A pinned product has to appear somewhere in the recommendations table,
+// which is where its details come from. Every change is logged with
+// audit=true, including the previous override.
+
+type Override struct {
+	ProductID string    `json:"product_id"`
+	Pinned    []string  `json:"pinned"`
+	Blocked   []string  `json:"blocked"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var overrides = struct {
+	mu      sync.RWMutex
+	entries map[string]Override // Keyed by product ID
+}{entries: map[string]Override{}}
+
+func lookupOverride(id string) (Override, bool) {
+	overrides.mu.RLock()
+	defer overrides.mu.RUnlock()
+	o, ok := overrides.entries[id]
+	return o, ok
+}
+
+// knownProduct finds a product anywhere in the recommendations table
+func knownProduct(id string) (models.Product, bool) {
+	recommendationsMu.RLock()
+	defer recommendationsMu.RUnlock()
+	for _, recs := range recommendations {
+		for _, p := range recs {
+			if p.ID == id {
+				return p, true
+			}
+		}
+	}
+	return models.Product{}, false
+}
+
+func (o Override) validate() error {
+	if o.ProductID == "" {
+		return fmt.Errorf("product_id is required: %w", apperrors.ErrValidation)
+	}
+	for i, id := range o.Pinned {
+		if slices.Contains(o.Pinned[:i], id) {
+			return fmt.Errorf("product %q is pinned twice: %w", id, apperrors.ErrValidation)
+		}
+		if slices.Contains(o.Blocked, id) {
+			return fmt.Errorf("product %q is both pinned and blocked: %w", id, apperrors.ErrValidation)
+		}
+		if id == o.ProductID {
+			return fmt.Errorf("product %q can't recommend itself: %w", id, apperrors.ErrValidation)
+		}
+		if _, ok := knownProduct(id); !ok {
+			return fmt.Errorf("pinned product %q is unknown: %w", id, apperrors.ErrValidation)
+		}
+	}
+	return nil
+}
+
+// applyOverride puts pinned products first and drops blocked ones. now
+// sets the pinned products' availability status.
+func applyOverride(id string, recs []models.Product, now time.Time) []models.Product {
+	o, ok := lookupOverride(id)
+	if !ok {
+		return recs
+	}
+
+	out := make([]models.Product, 0, len(recs)+len(o.Pinned))
+	for _, pid := range o.Pinned {
+		if p, ok := knownProduct(pid); ok {
+			out = append(out, p.WithStatus(now))
+		}
+	}
+	for _, p := range recs {
+		if !slices.Contains(o.Pinned, p.ID) && !slices.Contains(o.Blocked, p.ID) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func overridesHandler(w http.ResponseWriter, r *http.Request) {
+	audit := logging.For(r.Context(), slog.Default()).With("audit", true, "remote_addr", r.RemoteAddr)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var o Override
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			apperrors.Write(w, fmt.Errorf("invalid JSON: %v: %w", err, apperrors.ErrValidation))
+			return
+		}
+		if err := o.validate(); err != nil {
+			apperrors.Write(w, err)
+			return
+		}
+		if o.Pinned == nil {
+			o.Pinned = []string{}
+		}
+		if o.Blocked == nil {
+			o.Blocked = []string{}
+		}
+		o.UpdatedAt = time.Now().UTC()
+
+		overrides.mu.Lock()
+		prev, existed := overrides.entries[o.ProductID]
+		overrides.entries[o.ProductID] = o
+		overrides.mu.Unlock()
+		audit.Info("Recommendation override set", "product_id", o.ProductID,
+			"pinned", o.Pinned, "blocked", o.Blocked,
+			"previous_pinned", prev.Pinned, "previous_blocked", prev.Blocked, "replaced", existed)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("product_id")
+		overrides.mu.Lock()
+		prev, existed := overrides.entries[id]
+		delete(overrides.entries, id)
+		overrides.mu.Unlock()
+		if !existed {
+			apperrors.Write(w, fmt.Errorf("no override for product %q: %w", id, apperrors.ErrNotFound))
+			return
+		}
+		audit.Info("Recommendation override removed", "product_id", id,
+			"previous_pinned", prev.Pinned, "previous_blocked", prev.Blocked)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	overrides.mu.RLock()
+	list := make([]Override, 0, len(overrides.entries))
+	for _, o := range overrides.entries {
+		list = append(list, o)
+	}
+	overrides.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ProductID < list[j].ProductID })
+	jsonutil.Write(w, http.StatusOK, list)
+}
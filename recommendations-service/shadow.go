@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/jsonutil"
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Shadow evaluation. A model version uploaded without "activate" becomes
+// the candidate: every table-served request also computes the candidate's
+// list (never served) and compares the two. GET /admin/models/shadow
+// reports, per model:
+//
+//	overlap        Jaccard similarity of the two lists, averaged over requests
+//	diversity      distinct categories per recommended item
+//	predicted_ctr  share of the product's observed click/purchase feedback the
+//	               list would capture, discounted by position (products with
+//	               feedback only)
+//
+// and a verdict: "promote" once SHADOW_MIN_SAMPLES requests (default 50) show
+// the candidate at least as engaging and nearly as diverse as the active
+// model, "hold" if not, "insufficient_data" before that. Activating the
+// candidate logs its final report. Editorial overrides apply to both models
+// alike and are left out of the comparison.
+
+var shadowMinSamples = 50
+
+// Below these ratios to the active model the candidate is held back
+const (
+	shadowCTRTolerance       = 1.0
+	shadowDiversityTolerance = 0.9
+)
+
+type shadowStats struct {
+	samples   int
+	diversity float64 // Sum over samples
+	ctr       float64 // Sum over samples with feedback
+	ctrCount  int
+}
+
+func (s shadowStats) report() map[string]interface{} {
+	out := map[string]interface{}{"diversity": 0.0, "predicted_ctr": nil}
+	if s.samples > 0 {
+		out["diversity"] = round3(s.diversity / float64(s.samples))
+	}
+	if s.ctrCount > 0 {
+		out["predicted_ctr"] = round3(s.ctr / float64(s.ctrCount))
+	}
+	return out
+}
+
+var shadow = struct {
+	mu        sync.Mutex
+	candidate *ModelVersion
+	since     time.Time
+	active    shadowStats
+	shadowed  shadowStats
+	overlap   float64 // Sum over samples
+	misses    int     // Requests the candidate had no list for
+}{}
+
+func loadShadowFromEnv() {
+	if v, err := strconv.Atoi(settings.Value("SHADOW_MIN_SAMPLES")); err == nil && v > 0 {
+		shadowMinSamples = v
+	}
+}
+
+// setShadowCandidate starts evaluating m, discarding any earlier candidate
+func setShadowCandidate(m *ModelVersion) {
+	shadow.mu.Lock()
+	defer shadow.mu.Unlock()
+	shadow.candidate = m
+	shadow.since = time.Now().UTC()
+	shadow.active, shadow.shadowed = shadowStats{}, shadowStats{}
+	shadow.overlap, shadow.misses = 0, 0
+}
+
+// clearShadowCandidate stops evaluating version once it is activated or
+// evicted, returning its last report
+func clearShadowCandidate(version string) (map[string]interface{}, bool) {
+	shadow.mu.Lock()
+	defer shadow.mu.Unlock()
+	if shadow.candidate == nil || shadow.candidate.Version != version {
+		return nil, false
+	}
+	report := shadowReportLocked()
+	shadow.candidate = nil
+	return report, true
+}
+
+// shadowCompare evaluates the candidate on a request the active model
+// answered with served
+func shadowCompare(id string, served []models.Product, now time.Time) {
+	shadow.mu.Lock()
+	candidate := shadow.candidate
+	shadow.mu.Unlock()
+	if candidate == nil {
+		return
+	}
+
+	recs, ok := candidate.table[id]
+	if !ok || len(recs) == 0 {
+		shadow.mu.Lock()
+		if shadow.candidate == candidate {
+			shadow.misses++
+		}
+		shadow.mu.Unlock()
+		return
+	}
+	candidateRecs := rankByAvailability(rankByFeedback(id, recs), now)
+	activeCTR, activeHasFeedback := predictedCTR(id, served)
+	candidateCTR, _ := predictedCTR(id, candidateRecs)
+
+	shadow.mu.Lock()
+	defer shadow.mu.Unlock()
+	if shadow.candidate != candidate {
+		return
+	}
+	shadow.overlap += overlap(served, candidateRecs)
+	for _, side := range []struct {
+		stats *shadowStats
+		recs  []models.Product
+		ctr   float64
+	}{{&shadow.active, served, activeCTR}, {&shadow.shadowed, candidateRecs, candidateCTR}} {
+		side.stats.samples++
+		side.stats.diversity += diversity(side.recs)
+		if activeHasFeedback {
+			side.stats.ctr += side.ctr
+			side.stats.ctrCount++
+		}
+	}
+}
+
+// overlap is the Jaccard similarity of the two lists' product IDs
+func overlap(a, b []models.Product) float64 {
+	ids := map[string]int{}
+	for _, p := range a {
+		ids[p.ID] |= 1
+	}
+	for _, p := range b {
+		ids[p.ID] |= 2
+	}
+	if len(ids) == 0 {
+		return 1
+	}
+	both := 0
+	for _, in := range ids {
+		if in == 3 {
+			both++
+		}
+	}
+	return float64(both) / float64(len(ids))
+}
+
+// diversity is distinct categories per item; uncategorized items count as
+// one category
+func diversity(recs []models.Product) float64 {
+	if len(recs) == 0 {
+		return 0
+	}
+	categories := map[string]bool{}
+	for _, p := range recs {
+		categories[p.Category] = true
+	}
+	return float64(len(categories)) / float64(len(recs))
+}
+
+// predictedCTR is the share of id's feedback score that recs captures,
+// weighting each position like DCG (1/log2(rank+1)). false when id has no
+// feedback yet.
+func predictedCTR(id string, recs []models.Product) (float64, bool) {
+	feedbackScores.mu.RLock()
+	defer feedbackScores.mu.RUnlock()
+	scores := feedbackScores.scores[id]
+	var total float64
+	for _, s := range scores {
+		total += s
+	}
+	if total == 0 {
+		return 0, false
+	}
+	var captured float64
+	for i, p := range recs {
+		captured += scores[p.ID] / math.Log2(float64(i+2))
+	}
+	return captured / total, true
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// shadowReportLocked summarizes the evaluation; shadow.mu must be held
+func shadowReportLocked() map[string]interface{} {
+	if shadow.candidate == nil {
+		return map[string]interface{}{"candidate": nil}
+	}
+	samples := shadow.shadowed.samples
+	activeReport, candidateReport := shadow.active.report(), shadow.shadowed.report()
+
+	verdict := "insufficient_data"
+	if samples >= shadowMinSamples {
+		verdict = "promote"
+		if candidateReport["diversity"].(float64) < activeReport["diversity"].(float64)*shadowDiversityTolerance {
+			verdict = "hold"
+		}
+		if shadow.shadowed.ctrCount > 0 && shadow.shadowed.ctr < shadow.active.ctr*shadowCTRTolerance {
+			verdict = "hold"
+		}
+	}
+
+	report := map[string]interface{}{
+		"candidate":       shadow.candidate.Version,
+		"since":           shadow.since,
+		"samples":         samples,
+		"misses":          shadow.misses,
+		"min_samples":     shadowMinSamples,
+		"overlap":         0.0,
+		"active_model":    activeReport,
+		"candidate_model": candidateReport,
+		"verdict":         verdict,
+	}
+	if samples > 0 {
+		report["overlap"] = round3(shadow.overlap / float64(samples))
+	}
+	return report
+}
+
+func shadowReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	shadow.mu.Lock()
+	report := shadowReportLocked()
+	shadow.mu.Unlock()
+	report["active"] = activeModelVersion()
+	jsonutil.Write(w, http.StatusOK, report)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Guards recommendations, which /admin/restore can replace at runtime
+var recommendationsMu sync.RWMutex
+
+func lookupRecommendations(id string) ([]models.Product, bool) {
+	recommendationsMu.RLock()
+	defer recommendationsMu.RUnlock()
+	recs, ok := recommendations[id]
+	return recs, ok
+}
+
+// recommendationsState is the product ID -> recommended products table as
+// seen by /admin/snapshot and /admin/restore
+type recommendationsState struct{}
+
+func (recommendationsState) Dump() interface{} {
+	recommendationsMu.RLock()
+	defer recommendationsMu.RUnlock()
+	return maps.Clone(recommendations)
+}
+
+func (recommendationsState) Restore(data json.RawMessage) error {
+	var table map[string][]models.Product
+	if err := json.Unmarshal(data, &table); err != nil {
+		return err
+	}
+	if err := validateTable(table); err != nil {
+		return err
+	}
+
+	// Restores are model versions too, so a bad one can be rolled back
+	m, _ := publishModel(table, "restore", true, false)
+	slog.Info("Recommendations restored", "version", m.Version, "products", m.Products)
+	return nil
+}
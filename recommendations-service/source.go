@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afroCoderHanane/Midterm-Mastery/internal/models"
+)
+
+// Recommendation sources. Besides uploads to /admin/models, the table can
+// be fed from outside the service and reloaded while it runs, without a
+// redeploy:
+//
+//	RECOMMENDATIONS_FILE             JSON file (product ID -> recommended products), watched for changes
+//	REDIS_URL                        redis://[user:password@]host:port[/db] (or rediss:// for TLS)
+//	REDIS_KEY                        key holding the same JSON (default "recommendations")
+//	RECOMMENDATIONS_RELOAD_INTERVAL  how often the source is polled (default 10s)
+//
+// REDIS_URL wins when both are set. The first table read replaces the
+// built-in one at startup. After that, a changed table is published as a
+// new model version (source "file" or "redis") and activated through the
+// guardrail; one the guardrail blocks stays inactive as the shadow
+// candidate until an operator activates it. Unreadable or invalid data is
+// logged and the active version keeps serving.
+
+const sourceTimeout = 3 * time.Second
+
+// RecommendationSource is somewhere a recommendations table is read from
+type RecommendationSource interface {
+	// Name is the model version source, e.g. "file"
+	Name() string
+	// Fetch returns the table as JSON
+	Fetch(ctx context.Context) ([]byte, error)
+}
+
+func loadSourceFromEnv() {
+	var src RecommendationSource
+	if v := settings.Value("REDIS_URL"); v != "" {
+		rs, err := newRedisSource(v, settings.Value("REDIS_KEY"))
+		if err != nil {
+			slog.Error("Ignoring REDIS_URL", "error", err)
+			return
+		}
+		src = rs
+	} else if path := settings.Value("RECOMMENDATIONS_FILE"); path != "" {
+		src = fileSource{path: path}
+	} else {
+		return
+	}
+
+	interval := 10 * time.Second
+	if v, err := time.ParseDuration(settings.Value("RECOMMENDATIONS_RELOAD_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+	w := &sourceWatcher{src: src}
+	w.reload()
+	go func() {
+		for range time.Tick(interval) {
+			w.reload()
+		}
+	}()
+	slog.Info("Watching recommendations source", "source", src.Name(), "interval", interval.String())
+}
+
+// sourceWatcher publishes the source's table whenever its content changes
+type sourceWatcher struct {
+	src    RecommendationSource
+	last   [sha256.Size]byte // Content last published or rejected
+	loaded bool              // A table from src has been activated
+}
+
+func (w *sourceWatcher) reload() {
+	ctx, cancel := context.WithTimeout(context.Background(), sourceTimeout)
+	defer cancel()
+	data, err := w.src.Fetch(ctx)
+	if err != nil {
+		slog.Warn("Couldn't read recommendations source", "source", w.src.Name(), "error", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	if sum == w.last {
+		return
+	}
+	w.last = sum // Bad content is reported once, not every poll
+
+	var table map[string][]models.Product
+	if err := json.Unmarshal(data, &table); err != nil {
+		slog.Error("Invalid recommendations from source", "source", w.src.Name(), "error", err)
+		return
+	}
+	if err := validateTable(table); err != nil {
+		slog.Error("Invalid recommendations from source", "source", w.src.Name(), "error", err)
+		return
+	}
+	m, err := publishModel(table, w.src.Name(), true, w.loaded)
+	var blocked *guardrailError
+	switch {
+	case errors.As(err, &blocked):
+		slog.Warn("Reloaded recommendations blocked by guardrail, kept as shadow candidate",
+			"source", w.src.Name(), "version", m.Version, "changed_pct", blocked.ChangedPct)
+	case err != nil:
+		slog.Error("Couldn't publish reloaded recommendations", "source", w.src.Name(), "error", err)
+	default:
+		w.loaded = true
+		slog.Info("Reloaded recommendations", "source", w.src.Name(), "version", m.Version, "products", m.Products)
+	}
+}
+
+type fileSource struct {
+	path string
+}
+
+func (fileSource) Name() string { return "file" }
+
+func (s fileSource) Fetch(context.Context) ([]byte, error) {
+	return os.ReadFile(s.path)
+}
+
+// redisSource reads the table with GET over a connection per fetch. It
+// speaks just enough RESP for AUTH, SELECT and GET.
+type redisSource struct {
+	addr     string
+	tls      bool
+	user     string
+	password string
+	db       int
+	key      string
+}
+
+func newRedisSource(rawURL, key string) (*redisSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("scheme must be redis or rediss")
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	s := &redisSource{addr: u.Host, tls: u.Scheme == "rediss", key: key}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("database %q is not a number", db)
+		}
+	}
+	if s.key == "" {
+		s.key = "recommendations"
+	}
+	return s, nil
+}
+
+// validRedisURL is the REDIS_URL setting validator
+func validRedisURL(v string) error {
+	if v == "" {
+		return nil
+	}
+	_, err := newRedisSource(v, "")
+	return err
+}
+
+func (*redisSource) Name() string { return "redis" }
+
+func (s *redisSource) Fetch(ctx context.Context) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: sourceTimeout}
+	var conn net.Conn
+	var err error
+	if s.tls {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(conn)
+	if s.password != "" {
+		args := []string{"AUTH", s.password}
+		if s.user != "" {
+			args = []string{"AUTH", s.user, s.password}
+		}
+		if _, err := redisDo(conn, r, args...); err != nil {
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := redisDo(conn, r, "SELECT", strconv.Itoa(s.db)); err != nil {
+			return nil, err
+		}
+	}
+	data, err := redisDo(conn, r, "GET", s.key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("key %q is not set", s.key)
+	}
+	return data, nil
+}
+
+// redisDo sends one command and reads its reply. Bulk and simple string
+// replies are returned as is, a nil bulk string as nil.
+func redisDo(w io.Writer, r *bufio.Reader, args ...string) ([]byte, error) {
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(w, cmd.String()); err != nil {
+		return nil, err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2) // Payload and trailing CRLF
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}